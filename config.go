@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config holds answers given up front, such as on the command line, so that their prompts can be skipped
+type Config struct {
+	KubeConfig string
+	Context    string
+	Namespace  string
+	// Selector limits the pods checked to those matching a label selector
+	Selector string
+	// SelectorLabel is the label key to match controllers on alone when the service's whole selector matches none
+	SelectorLabel string
+	Service       string
+	// Pod is the name of a single pod to diagnose, instead of following a service or Deployment
+	Pod string
+	// Port is the name or number of the service port
+	Port      string
+	Path      string
+	LocalPort int
+	// ReadyThreshold is the percentage of the controller's pods that have to be ready to pass, warning when some still
+	// aren't, or 0 to need all of them
+	ReadyThreshold int
+	// Only is the categories of checks to make, as listed in onlyCategories, or empty for all of them
+	Only []string
+	// Output is the output format; OutputJSON, OutputJSONLines, or the usual text
+	Output string
+	// Quiet skips the welcome text
+	Quiet bool
+	// NoColor turns off colored output, which is also off when NO_COLOR is set or output isn't a terminal
+	NoColor bool
+	// AllNamespaces counts problem pods across the whole cluster, without asking first, before picking a namespace
+	AllNamespaces bool
+	// CheckDNS resolves the service's name from inside one of its pods without asking first
+	CheckDNS bool
+	// DryRun makes only read-only checks, saying what the port-forward and DNS lookup would do instead of doing them
+	DryRun bool
+	// Watch re-prints the pending, running, and ready summary whenever the pods change once we finish, until interrupted
+	Watch bool
+	// Metrics prints how often each state was entered when we finish
+	Metrics bool
+	// MetricsAddr is the address to serve the checks made as Prometheus metrics on, once a headless run finishes
+	MetricsAddr string
+	// Debug prints the Kubernetes objects each step works from
+	Debug bool
+	// Concurrency is how many pods' ports to probe at once, or 0 for the default
+	Concurrency int
+	// Retries is how many times to try an API call that fails in a way that may pass, or 0 for the default
+	Retries int
+	// Timeout is how long the whole run may take, or 0 for no limit
+	Timeout time.Duration
+	// Transcript is the path of a file to record the whole session to
+	Transcript string
+}
+
+// NonInteractive returns if there are enough answers to troubleshoot without prompting at all. Any other
+// prompts take their defaults.
+func (c Config) NonInteractive() bool {
+	return c.Namespace != "" && (c.Service != "" && c.Port != "" || c.Pod != "")
+}
+
+// Runs returns if the category of checks is one to make
+func (c Config) Runs(category string) bool {
+	if len(c.Only) == 0 {
+		return true
+	}
+	for _, o := range c.Only {
+		if o == category {
+			return true
+		}
+	}
+	return false
+}
+
+// the categories of checks that -only can limit a run to
+const (
+	onlyPending   = "pending"
+	onlyRunning   = "running"
+	onlyReady     = "ready"
+	onlyEndpoints = "endpoints"
+	onlyPort      = "port"
+	onlyIngress   = "ingress"
+)
+
+// onlyCategories lists the categories of checks in the order they're made
+var onlyCategories = []string{onlyPending, onlyRunning, onlyReady, onlyEndpoints, onlyPort, onlyIngress}
+
+// onlyDescriptions say what each category of checks looks for
+var onlyDescriptions = map[string]string{
+	onlyPending:   "for pending pods",
+	onlyRunning:   "for pods that aren't running or are crash looping",
+	onlyReady:     "for pods that aren't ready",
+	onlyEndpoints: "the service's endpoints and selector",
+	onlyPort:      "that the container port is accessible",
+	onlyIngress:   "the Ingress routing to the service",
+}
+
+// parseOnly splits a comma separated list of categories of checks, rejecting any it doesn't know
+func parseOnly(list string) ([]string, error) {
+	result := []string{}
+	for _, category := range strings.Split(list, ",") {
+		category = strings.TrimSpace(category)
+		if category == "" {
+			continue
+		}
+		if _, ok := onlyDescriptions[category]; !ok {
+			return nil, fmt.Errorf("unknown check category '%s'; choose from %s", category, strings.Join(onlyCategories, ", "))
+		}
+		result = append(result, category)
+	}
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOnly(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+		err  string
+	}{
+		{"port", []string{onlyPort}, ""},
+		{"pending, ready,port", []string{onlyPending, onlyReady, onlyPort}, ""},
+		// empty items, as from a trailing comma, are ignored
+		{"endpoints,,", []string{onlyEndpoints}, ""},
+		{"", []string{}, ""},
+		{"port,ports", nil, "unknown check category 'ports'; choose from pending, running, ready, endpoints, port, ingress"},
+		{"Port", nil, "unknown check category 'Port'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, err := parseOnly(tt.list)
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Errorf("parseOnly = %v, %v; want an error saying %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseOnly = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuns(t *testing.T) {
+	for _, category := range onlyCategories {
+		if !(Config{}).Runs(category) {
+			t.Errorf("a run without -only doesn't make the %s checks", category)
+		}
+	}
+	cfg := Config{Only: []string{onlyPort, onlyIngress}}
+	for _, category := range onlyCategories {
+		if want := category == onlyPort || category == onlyIngress; cfg.Runs(category) != want {
+			t.Errorf("-only port,ingress Runs(%s) = %v, want %v", category, !want, want)
+		}
+	}
+}
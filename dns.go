@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/deprecated/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// clusterDomain is the DNS domain services are assumed to live under
+const clusterDomain = "cluster.local"
+
+// serviceFQDN returns the fully qualified DNS name of a service
+func serviceFQDN(svc corev1.Service) string {
+	return fmt.Sprintf("%s.%s.svc.%s", svc.GetName(), svc.GetNamespace(), clusterDomain)
+}
+
+// dnsLookupCommand returns a command that resolves name with whichever of getent and nslookup the image has
+func dnsLookupCommand(name string) []string {
+	return []string{"sh", "-c", fmt.Sprintf("getent hosts %s || nslookup %s", name, name)}
+}
+
+// execRequest builds the request that runs command in a container of the pod
+func execRequest(client rest.Interface, namespace, podName, containerName string, command []string) *rest.Request {
+	return client.Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: containerName,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+}
+
+// ExecInPod runs command in a container of the named pod, returning what it wrote to stdout and stderr
+func (k *K8sContext) ExecInPod(ctx context.Context, podName, containerName string, command []string) (string, string, error) {
+	client, err := rest.RESTClientFor(k.config)
+	if err != nil {
+		return "", "", err
+	}
+	req := execRequest(client, k.namespace, podName, containerName, command)
+	exec, err := remotecommand.NewSPDYExecutor(k.config, "POST", req.URL())
+	if err != nil {
+		return "", "", err
+	}
+
+	// the executor can't be cancelled, so stop waiting on it instead
+	var stdout, stderr bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- exec.Stream(remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+	}()
+	select {
+	case err := <-done:
+		return stdout.String(), stderr.String(), err
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	}
+}
+
+// ipAddress matches the IPv4 addresses in lookup output
+var ipAddress = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+// resolvedAddresses returns the addresses in the output of dnsLookupCommand, leaving out nslookup's own server
+func resolvedAddresses(output string) []string {
+	result := []string{}
+	// nslookup starts with the server it asked, in a format that varies between implementations, and only lists
+	// addresses it resolved after the name
+	if strings.HasPrefix(strings.TrimSpace(output), "Server:") {
+		i := strings.Index(output, "\nName:")
+		if i < 0 {
+			return result
+		}
+		output = output[i:]
+	}
+	for _, ip := range ipAddress.FindAllString(output, -1) {
+		if !contains(result, ip) {
+			result = append(result, ip)
+		}
+	}
+	return result
+}
+
+// CoreDNSReady returns how many of the cluster DNS pods in kube-system are ready, out of how many there are
+func (k *K8sContext) CoreDNSReady(ctx context.Context) (int, int, error) {
+	var pods *corev1.PodList
+	err := k.retry(ctx, func() (err error) {
+		pods, err = k.k8sClient.CoreV1().Pods(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{LabelSelector: "k8s-app=kube-dns"})
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	ready := 0
+	for _, p := range pods.Items {
+		if IsReady(p) {
+			ready++
+		}
+	}
+	return ready, len(pods.Items), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/caseyhadden/kubetrbl/report"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	fakerest "k8s.io/client-go/rest/fake"
+)
+
+func TestExecRequest(t *testing.T) {
+	client := &fakerest.RESTClient{GroupVersion: corev1.SchemeGroupVersion, NegotiatedSerializer: scheme.Codecs.WithoutConversion()}
+	name := serviceFQDN(*testService())
+	if name != "web.default.svc.cluster.local" {
+		t.Errorf("serviceFQDN = %q", name)
+	}
+
+	u := execRequest(client, testNamespace, "web-1", "app", dnsLookupCommand(name)).URL()
+
+	if want := "/namespaces/default/pods/web-1/exec"; !strings.HasSuffix(u.Path, want) {
+		t.Errorf("exec request is to %q, want %q", u.Path, want)
+	}
+	q := u.Query()
+	wantCommand := []string{"sh", "-c", "getent hosts web.default.svc.cluster.local || nslookup web.default.svc.cluster.local"}
+	if !reflect.DeepEqual(q["command"], wantCommand) {
+		t.Errorf("exec command = %q, want %q", q["command"], wantCommand)
+	}
+	if q.Get("container") != "app" || q.Get("stdout") != "true" || q.Get("stderr") != "true" || q.Get("stdin") != "" || q.Get("tty") != "" {
+		t.Errorf("exec request has query %v, want the app container's stdout and stderr only", q)
+	}
+}
+
+func TestResolvedAddresses(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{"getent", "10.100.1.2      web.default.svc.cluster.local\n", []string{"10.100.1.2"}},
+		{"nslookup", "Server:\t\t10.96.0.10\nAddress:\t10.96.0.10#53\n\nName:\tweb.default.svc.cluster.local\nAddress: 10.100.1.2\n", []string{"10.100.1.2"}},
+		{"busybox nslookup", "Server:    10.96.0.10\nAddress 1: 10.96.0.10 kube-dns.kube-system.svc.cluster.local\n\nName:      web.default.svc.cluster.local\nAddress 1: 10.100.1.2 web.default.svc.cluster.local\n", []string{"10.100.1.2"}},
+		// a headless service resolves to each of its pods
+		{"several", "Server:\t\t10.96.0.10\nAddress:\t10.96.0.10#53\n\nName:\tweb.default.svc.cluster.local\nAddress: 10.1.0.4\nName:\tweb.default.svc.cluster.local\nAddress: 10.1.0.5\n", []string{"10.1.0.4", "10.1.0.5"}},
+		{"not found", "Server:\t\t10.96.0.10\nAddress:\t10.96.0.10#53\n\n** server can't find web.default.svc.cluster.local: NXDOMAIN\n", []string{}},
+		{"busybox not found", "Server:    10.96.0.10\nAddress 1: 10.96.0.10 kube-dns.kube-system.svc.cluster.local\n\nnslookup: can't resolve 'web.default.svc.cluster.local'\n", []string{}},
+		{"no tools", "sh: nslookup: not found\n", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolvedAddresses(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolvedAddresses = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoreDNSReady(t *testing.T) {
+	dns := func(name string, ready bool) *corev1.Pod {
+		pod := testPod(name, corev1.PodRunning)
+		pod.Namespace = metav1.NamespaceSystem
+		pod.Labels = map[string]string{"k8s-app": "kube-dns"}
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+		return pod
+	}
+	proxy := dns("kube-proxy-1", true)
+	proxy.Labels = map[string]string{"k8s-app": "kube-proxy"}
+	k := NewK8sContextWithClient(fakeClient(dns("coredns-1", true), dns("coredns-2", false), proxy), testNamespace)
+
+	ready, total, err := k.CoreDNSReady(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready != 1 || total != 2 {
+		t.Errorf("CoreDNSReady = %d of %d, want 1 of 2", ready, total)
+	}
+}
+
+func TestCheckDNSDryRun(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	cfg := answered
+	cfg.Only = []string{onlyEndpoints}
+	cfg.CheckDNS = true
+	cfg.DryRun = true
+
+	k, _ := troubleshoot(t, cfg, "getNamespace", "", testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), ready, testDeployment("web", 1))
+
+	c := wantCheck(t, k, checkDNS, "web", report.StatusSkip)
+	if want := "Dry run: would run 'sh -c getent hosts web.default.svc.cluster.local || nslookup web.default.svc.cluster.local' in pod 'web-1'."; c.Message != want {
+		t.Errorf("DNS check said %q, want %q", c.Message, want)
+	}
+}
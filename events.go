@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// eventSelector returns the field selector for the events about the named object of the given kind
+func eventSelector(kind, name string) string {
+	return fields.AndSelectors(
+		fields.OneTermEqualSelector("involvedObject.kind", kind),
+		fields.OneTermEqualSelector("involvedObject.name", name),
+	).String()
+}
+
+// GetEventsFor returns the events about the named object of the given kind, such as "Pod" or "Deployment", most
+// recent first. A limit above 0 keeps only that many of the most recent.
+func (k *K8sContext) GetEventsFor(ctx context.Context, kind, name string, limit int) ([]corev1.Event, error) {
+	result := []corev1.Event{}
+	opts := metav1.ListOptions{FieldSelector: eventSelector(kind, name), Limit: listPageSize}
+	for {
+		var evts *corev1.EventList
+		err := k.retry(ctx, func() (err error) {
+			evts, err = k.k8sClient.CoreV1().Events(k.namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return []corev1.Event{}, err
+		}
+		result = append(result, evts.Items...)
+		if evts.Continue == "" {
+			break
+		}
+		opts.Continue = evts.Continue
+	}
+
+	sortEvents(result)
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// sortEvents sorts events most recent first
+func sortEvents(evts []corev1.Event) {
+	sort.SliceStable(evts, func(i, j int) bool {
+		return evts[j].LastTimestamp.Before(&evts[i].LastTimestamp)
+	})
+}
+
+// formatEvent describes an event by its type, reason, and message
+func formatEvent(e corev1.Event) string {
+	return fmt.Sprintf("%s %s: %s", e.Type, e.Reason, e.Message)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestEventSelector(t *testing.T) {
+	if got, want := eventSelector("Pod", "web-1"), "involvedObject.kind=Pod,involvedObject.name=web-1"; got != want {
+		t.Errorf("eventSelector = %q, want %q", got, want)
+	}
+}
+
+func TestSortEvents(t *testing.T) {
+	now := time.Now()
+	evts := []corev1.Event{
+		*testEvent("web-1", "Scheduled", "", now.Add(-time.Hour)),
+		*testEvent("web-1", "BackOff", "", now),
+		*testEvent("web-1", "Pulled", "", now.Add(-time.Minute)),
+		// events at the same time stay in the order listed
+		*testEvent("web-1", "Created", "", now.Add(-time.Minute)),
+	}
+
+	sortEvents(evts)
+
+	got := []string{}
+	for _, e := range evts {
+		got = append(got, e.Reason)
+	}
+	if want := []string{"BackOff", "Pulled", "Created", "Scheduled"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sortEvents = %v, want %v", got, want)
+	}
+}
+
+func TestGetEventsFor(t *testing.T) {
+	now := time.Now()
+	scheduled := testEvent("web-1", "Scheduled", "Successfully assigned default/web-1", now.Add(-time.Hour))
+	scheduled.Type = corev1.EventTypeNormal
+	backOff := testEvent("web-1", "BackOff", "Back-off restarting failed container", now)
+	failed := testEvent("web-1", "Failed", "Error: ImagePullBackOff", now.Add(-time.Minute))
+	// the API returns the events a page at a time, in no particular order. The fake's list actions don't carry
+	// the continue token, so each call gets the next page.
+	pages := []*corev1.EventList{
+		{Items: []corev1.Event{*scheduled, *backOff}},
+		{Items: []corev1.Event{*failed}},
+	}
+	pages[0].Continue = "page-2"
+	client := fakeClient()
+	var selectors []string
+	client.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selectors = append(selectors, action.(k8stesting.ListAction).GetListRestrictions().Fields.String())
+		return true, pages[(len(selectors)-1)%len(pages)], nil
+	})
+	k := NewK8sContextWithClient(client, testNamespace)
+
+	evts, err := k.GetEventsFor(context.Background(), "Pod", "web-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, e := range evts {
+		got = append(got, formatEvent(e))
+	}
+	want := []string{
+		"Warning BackOff: Back-off restarting failed container",
+		"Warning Failed: Error: ImagePullBackOff",
+		"Normal Scheduled: Successfully assigned default/web-1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetEventsFor = %q, want %q", got, want)
+	}
+	if len(selectors) != 2 {
+		t.Errorf("listed events %d times, want once for each page", len(selectors))
+	}
+	for _, s := range selectors {
+		if s != "involvedObject.kind=Pod,involvedObject.name=web-1" {
+			t.Errorf("listed events with field selector %q", s)
+		}
+	}
+
+	// the limit keeps the most recent across every page
+	evts, err = k.GetEventsFor(context.Background(), "Pod", "web-1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evts) != 2 || evts[0].Reason != "BackOff" || evts[1].Reason != "Failed" {
+		t.Errorf("GetEventsFor with a limit of 2 = %v, want BackOff and Failed", evts)
+	}
+}
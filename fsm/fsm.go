@@ -1,38 +1,115 @@
 package fsm
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoHistory is returned by Back when there is no previous State to return to.
+var ErrNoHistory = errors.New("fsm: no previous state")
 
 // State is a basic struct that implements the State interface.
 type State struct {
 	Enter  func() error
 	Update func() error
 	Exit   func() error
+	// Timeout, when set, is how long Enter may run before the FSM gives up on it; see StateWithCtx.
+	Timeout time.Duration
+	// Fallback is the State to change to when Enter runs past its Timeout.
+	Fallback string
+}
+
+// StateWithCtx is a State whose callbacks receive the context value the State was entered with, letting a
+// State hand data to the next one without sharing fields on some outer struct.
+//
+// When Timeout is set, Enter runs in its own goroutine. If it hasn't returned or moved on to another State within
+// the Timeout, a *TimeoutError goes to the ErrorHandler and the FSM changes to Fallback, if there is one. The FSM
+// can't stop the Enter that's still running, so it should watch StateContext and return once that's done; any
+// error it returns after being given up on is ignored.
+type StateWithCtx struct {
+	Enter  func(ctx interface{}) error
+	Update func(ctx interface{}) error
+	Exit   func(ctx interface{}) error
+
+	Timeout  time.Duration
+	Fallback string
+}
+
+// WithCtx adapts a State to a StateWithCtx whose callbacks ignore the context value.
+func (s State) WithCtx() StateWithCtx {
+	return StateWithCtx{
+		Enter:    ignoreCtx(s.Enter),
+		Update:   ignoreCtx(s.Update),
+		Exit:     ignoreCtx(s.Exit),
+		Timeout:  s.Timeout,
+		Fallback: s.Fallback,
+	}
+}
+
+func ignoreCtx(fn func() error) func(interface{}) error {
+	if fn == nil {
+		return nil
+	}
+	return func(interface{}) error {
+		return fn()
+	}
 }
 
 // FSM represents a Finite State Machine, which can have one State active at a time.
+//
+// An FSM is safe for concurrent use as long as State and StateDirectory are only touched through its methods.
+// The Enter, Update, and Exit callbacks, as well as the ErrorHandler, are invoked without the FSM's lock held,
+// so a callback is free to call Change (or any other method) without deadlocking.
 type FSM struct {
 	State          string
-	StateDirectory map[string]State
+	StateDirectory map[string]StateWithCtx
 	ErrorHandler   func(*FSM, error)
+	// Transitions maps a State's name to the names of the States it may change to.
+	Transitions map[string][]string
+	// Logger, when set, is told about every State entered and exited and every error handled.
+	Logger Logger
+	// BaseContext is the parent of every StateContext; it defaults to context.Background().
+	BaseContext context.Context
+
+	mu        sync.RWMutex
+	ctx       interface{}
+	history   []step
+	entry     *entry
+	observers []func(event, state string)
+}
+
+// step is an entry in the history of previously active States.
+type step struct {
+	state string
+	ctx   interface{}
 }
 
 // NewFSM creates a new FSM and returns it.
 func NewFSM() *FSM {
 	fsm := &FSM{}
-	fsm.StateDirectory = make(map[string]State, 0)
+	fsm.StateDirectory = make(map[string]StateWithCtx, 0)
+	fsm.Transitions = make(map[string][]string, 0)
 	fsm.ErrorHandler = func(f *FSM, err error) {
 		fmt.Println("Error: " + err.Error())
 	}
 	return fsm
 }
 
-// Update runs the Update() on the active State.
+// Update runs the Update() on the active State, supplying the context value the State was entered with.
 func (f *FSM) Update() {
-	if f.State != "" && f.StateDirectory[f.State].Update != nil {
-		err := f.StateDirectory[f.State].Update()
-		if err != nil {
-			f.ErrorHandler(f, err)
-		}
+	f.mu.RLock()
+	update := f.StateDirectory[f.State].Update
+	active := f.State != ""
+	ctx := f.ctx
+	f.mu.RUnlock()
+
+	if active && update != nil {
+		f.call(update, ctx)
 	} else {
 		fmt.Println("Update() called on FSM without active state.")
 	}
@@ -40,44 +117,349 @@ func (f *FSM) Update() {
 
 // Register registers a State with its name.
 func (f *FSM) Register(name string, state State) {
+	f.RegisterWithCtx(name, state.WithCtx())
+}
+
+// RegisterWithCtx registers a StateWithCtx with its name.
+func (f *FSM) RegisterWithCtx(name string, state StateWithCtx) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.StateDirectory[name] = state
 }
 
 // Unregister removes a State from the FSM using its name.
 func (f *FSM) Unregister(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	delete(f.StateDirectory, name)
 }
 
 // HasState returns if the FSM has a State associated with the name in its directory.
 func (f *FSM) HasState(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 	_, hasKey := f.StateDirectory[name]
 	return hasKey
 }
 
-// Change allows you to change the current, "main" State assigned to the FSM. If you run Change(), it will call
-// Exit() on the previous State and Enter() on the next State.
-func (f *FSM) Change(stateName string) {
+// States returns the names of the registered States, sorted.
+func (f *FSM) States() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.states()
+}
 
-	if f.State != "" && f.StateDirectory[f.State].Exit != nil {
-		err := f.StateDirectory[f.State].Exit()
-		if err != nil {
-			f.ErrorHandler(f, err)
+// states returns the sorted State names. It must be called with the lock held.
+func (f *FSM) states() []string {
+	names := make([]string, 0, len(f.StateDirectory))
+	for name := range f.StateDirectory {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Current returns the name of the active State, or "" if there is none.
+func (f *FSM) Current() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.State
+}
+
+// Allow records that the State named from may change to the State named to. Once a State has at least one
+// allowed transition, Change refuses to move from it to any State that was not allowed.
+func (f *FSM) Allow(from, to string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.Transitions[from] {
+		if t == to {
+			return
 		}
 	}
+	f.Transitions[from] = append(f.Transitions[from], to)
+}
 
-	_, hasKey := f.StateDirectory[stateName]
-	if !hasKey {
-		fmt.Println("FSM object", f, "has no state", stateName)
-		panic("Error!")
+// CanTransition returns if the active State may change to the State named to.
+func (f *FSM) CanTransition(to string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if _, hasKey := f.StateDirectory[to]; !hasKey {
+		return false
 	}
+	return f.allowed(f.State, to)
+}
 
-	f.State = stateName
+// allowed reports if from may change to to. Re-entering a State is always allowed, as is leaving a State
+// with no recorded transitions. It must be called with the lock held.
+func (f *FSM) allowed(from, to string) bool {
+	rules, hasRules := f.Transitions[from]
+	if from == "" || from == to || !hasRules {
+		return true
+	}
+	for _, t := range rules {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Events passed to the observers registered with OnAny.
+const (
+	EventEnter = "enter"
+	EventExit  = "exit"
+	EventError = "error"
+)
 
-	if f.State != "" && f.StateDirectory[f.State].Enter != nil {
-		err := f.StateDirectory[f.State].Enter()
-		if err != nil {
-			f.ErrorHandler(f, err)
+// OnAny registers fn to be called whenever any State is entered or exited, or has an error handled, with the
+// event and the State's name. Observers are called in the order they were registered, after the Logger.
+func (f *FSM) OnAny(fn func(event, state string)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.observers = append(f.observers, fn)
+}
+
+// notify tells the Logger and observers about an event. It must be called without the lock held.
+func (f *FSM) notify(event, state string, err error) {
+	if f.Logger != nil {
+		switch event {
+		case EventEnter:
+			f.Logger.OnEnter(state)
+		case EventExit:
+			f.Logger.OnExit(state)
+		case EventError:
+			f.Logger.OnError(state, err)
 		}
 	}
+	f.mu.RLock()
+	observers := f.observers
+	f.mu.RUnlock()
+	for _, fn := range observers {
+		fn(event, state)
+	}
+}
+
+// ExportDOT writes the FSM as a Graphviz digraph, with a node for each registered State and an edge for each
+// transition recorded with Allow.
+func (f *FSM) ExportDOT(w io.Writer) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	names := f.states()
+
+	if _, err := fmt.Fprintln(w, "digraph fsm {"); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "\t%q;\n", name); err != nil {
+			return err
+		}
+	}
+	for _, from := range names {
+		for _, to := range f.Transitions[from] {
+			if _, err := fmt.Fprintf(w, "\t%q -> %q;\n", from, to); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// Context returns the context value the active State was entered with.
+func (f *FSM) Context() interface{} {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.ctx
+}
+
+// Change allows you to change the current, "main" State assigned to the FSM. If you run Change(), it will call
+// Exit() on the previous State and Enter() on the next State. Changing to a State that has not been registered
+// leaves the FSM untouched and returns an error, which is also passed to the ErrorHandler. The same is true of
+// changing to a State the active State has not been allowed to change to.
+func (f *FSM) Change(stateName string) error {
+	return f.ChangeWith(stateName, nil)
+}
+
+// ChangeWith works like Change, but enters the next State with the given context value. The value is handed
+// to the State's Enter() and Exit(), and to Update() for as long as the State stays active.
+func (f *FSM) ChangeWith(stateName string, ctx interface{}) error {
+	if !f.HasState(stateName) {
+		err := fmt.Errorf("fsm: unknown state %q", stateName)
+		f.handleError(err)
+		return err
+	}
+
+	f.mu.RLock()
+	from := f.State
+	allowed := f.allowed(from, stateName)
+	f.mu.RUnlock()
+	if !allowed {
+		err := fmt.Errorf("fsm: transition from %q to %q is not allowed", from, stateName)
+		f.handleError(err)
+		return err
+	}
+
+	f.exit()
+
+	f.mu.Lock()
+	// re-entering the active State does not count as a step in the history
+	if f.State != "" && f.State != stateName {
+		f.history = append(f.history, step{state: f.State, ctx: f.ctx})
+	}
+	f.State = stateName
+	f.ctx = ctx
+	f.mu.Unlock()
+
+	f.enter()
+
+	return nil
+}
+
+// Back returns to the previously active State, calling Exit() on the current State and Enter() on the
+// previous one with the context value it was originally entered with. If there is no previous State, ErrNoHistory is passed to the ErrorHandler and returned.
+func (f *FSM) Back() error {
+	f.mu.RLock()
+	empty := len(f.history) == 0
+	f.mu.RUnlock()
+	if empty {
+		f.handleError(ErrNoHistory)
+		return ErrNoHistory
+	}
+
+	f.exit()
+
+	f.mu.Lock()
+	prev := f.history[len(f.history)-1]
+	f.State = prev.state
+	f.ctx = prev.ctx
+	f.history = f.history[:len(f.history)-1]
+	f.mu.Unlock()
+
+	f.enter()
+
+	return nil
+}
+
+// BackTo returns to the most recent time the named State was active, the way repeated calls to Back would, but
+// without entering any of the States in between. If the State isn't in the history, ErrNoHistory is passed to the
+// ErrorHandler and returned.
+func (f *FSM) BackTo(stateName string) error {
+	f.mu.RLock()
+	i := len(f.history) - 1
+	for i >= 0 && f.history[i].state != stateName {
+		i--
+	}
+	f.mu.RUnlock()
+	if i < 0 {
+		f.handleError(ErrNoHistory)
+		return ErrNoHistory
+	}
+
+	f.exit()
+
+	f.mu.Lock()
+	prev := f.history[i]
+	f.State = prev.state
+	f.ctx = prev.ctx
+	f.history = f.history[:i]
+	f.mu.Unlock()
+
+	f.enter()
+
+	return nil
+}
+
+// Stop calls Exit() on the active State and leaves the FSM without an active State. Calling Stop on an FSM
+// without an active State does nothing.
+func (f *FSM) Stop() {
+	f.exit()
+
+	f.mu.Lock()
+	f.State = ""
+	f.ctx = nil
+	f.mu.Unlock()
+}
+
+// Reset calls Exit() on the active State and returns the FSM to how it was before the first Change, forgetting
+// its history but keeping its registered States and transitions.
+func (f *FSM) Reset() {
+	f.exit()
+
+	f.mu.Lock()
+	f.State = ""
+	f.ctx = nil
+	f.history = nil
+	f.mu.Unlock()
+}
+
+// History returns the names of the previously active States, oldest first.
+func (f *FSM) History() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	result := make([]string, len(f.history))
+	for i, s := range f.history {
+		result[i] = s.state
+	}
+	return result
+}
+
+func (f *FSM) enter() {
+	f.mu.Lock()
+	st := f.StateDirectory[f.State]
+	state := f.State
+	active := state != ""
+	ctx := f.ctx
+	e := f.newEntry(st.Timeout)
+	f.mu.Unlock()
+
+	if active {
+		f.notify(EventEnter, state, nil)
+	}
+	if !active || st.Enter == nil {
+		return
+	}
+	if st.Timeout <= 0 {
+		f.call(st.Enter, ctx)
+		return
+	}
+	f.enterWithTimeout(e, state, st, ctx)
+}
+
+func (f *FSM) exit() {
+	f.mu.RLock()
+	exit := f.StateDirectory[f.State].Exit
+	state := f.State
+	active := state != ""
+	ctx := f.ctx
+	e := f.entry
+	f.mu.RUnlock()
+
+	if active && exit != nil {
+		f.call(exit, ctx)
+	}
+	if active {
+		f.notify(EventExit, state, nil)
+	}
+	if e != nil {
+		e.leave()
+	}
+}
+
+// call runs a State callback, passing any error to the ErrorHandler. It must be called without the lock held.
+func (f *FSM) call(fn func(interface{}) error, ctx interface{}) {
+	err := fn(ctx)
+	if err != nil {
+		f.handleError(err)
+	}
+}
 
+// handleError tells the Logger and observers about an error in the active State before passing it to the
+// ErrorHandler. It must be called without the lock held.
+func (f *FSM) handleError(err error) {
+	f.mu.RLock()
+	state := f.State
+	f.mu.RUnlock()
+	f.notify(EventError, state, err)
+	f.ErrorHandler(f, err)
 }
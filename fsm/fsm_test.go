@@ -0,0 +1,335 @@
+package fsm
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var (
+	errEnter = errors.New("enter failed")
+	errExit  = errors.New("exit failed")
+)
+
+// recordErrors sets an ErrorHandler on f that collects the errors it's given
+func recordErrors(f *FSM) *[]error {
+	errs := []error{}
+	f.ErrorHandler = func(_ *FSM, err error) {
+		errs = append(errs, err)
+	}
+	return &errs
+}
+
+func TestChangeUnknownState(t *testing.T) {
+	f := NewFSM()
+	errs := recordErrors(f)
+
+	err := f.Change("nope")
+	if err == nil || !strings.HasPrefix(err.Error(), "fsm: unknown state") {
+		t.Fatalf("Change(\"nope\") = %v, want an unknown state error", err)
+	}
+	if len(*errs) != 1 || (*errs)[0] != err {
+		t.Errorf("ErrorHandler got %v, want [%v]", *errs, err)
+	}
+	if f.Current() != "" {
+		t.Errorf("Current() = %q, want no active state", f.Current())
+	}
+}
+
+func TestChangeCallbackErrors(t *testing.T) {
+	f := NewFSM()
+	errs := recordErrors(f)
+	f.Register("a", State{Exit: func() error { return errExit }})
+	f.Register("b", State{Enter: func() error { return errEnter }})
+
+	if err := f.Change("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Change("b"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*errs) != 2 || (*errs)[0] != errExit || (*errs)[1] != errEnter {
+		t.Errorf("ErrorHandler got %v, want [%v %v]", *errs, errExit, errEnter)
+	}
+}
+
+// TestConcurrentChange is meant to be run with -race
+func TestConcurrentChange(t *testing.T) {
+	f := NewFSM()
+	recordErrors(f)
+	names := []string{"a", "b", "c"}
+	for _, name := range names {
+		f.Register(name, State{})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				name := names[(i+j)%len(names)]
+				if err := f.Change(name); err != nil {
+					t.Error(err)
+				}
+				if !f.HasState(name) {
+					t.Errorf("HasState(%q) = false", name)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if !f.HasState(f.Current()) {
+		t.Errorf("Current() = %q, want a registered state", f.Current())
+	}
+}
+
+func TestChangeFromCallback(t *testing.T) {
+	f := NewFSM()
+	recordErrors(f)
+	f.Register("b", State{})
+	f.Register("a", State{Enter: func() error { return f.Change("b") }})
+
+	// a callback that changes State would deadlock if the lock were held around it
+	if err := f.Change("a"); err != nil {
+		t.Fatal(err)
+	}
+	if f.Current() != "b" {
+		t.Errorf("Current() = %q, want %q", f.Current(), "b")
+	}
+}
+
+func TestExportDOT(t *testing.T) {
+	f := NewFSM()
+	f.Register("welcome", State{})
+	f.Register("check", State{})
+	f.Register("finish", State{})
+	f.Allow("welcome", "check")
+	f.Allow("check", "finish")
+	f.Allow("check", "welcome")
+
+	var b bytes.Buffer
+	if err := f.ExportDOT(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "three-states.dot")
+	if *update {
+		if err := ioutil.WriteFile(golden, b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("ExportDOT wrote\n%s\nwant\n%s", b.Bytes(), want)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	f := NewFSM()
+	errs := recordErrors(f)
+	for _, name := range []string{"welcome", "check", "finish"} {
+		f.Register(name, State{})
+	}
+	f.Allow("welcome", "check")
+	if err := f.Change("welcome"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !f.CanTransition("check") {
+		t.Error(`CanTransition("check") = false, want true`)
+	}
+	if f.CanTransition("finish") {
+		t.Error(`CanTransition("finish") = true, want false`)
+	}
+	if f.CanTransition("nope") {
+		t.Error(`CanTransition("nope") = true, want false`)
+	}
+	if !f.CanTransition("welcome") {
+		t.Error(`CanTransition("welcome") = false, want re-entering to be allowed`)
+	}
+
+	err := f.Change("finish")
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Fatalf(`Change("finish") = %v, want a not allowed error`, err)
+	}
+	if len(*errs) != 1 || (*errs)[0] != err {
+		t.Errorf("ErrorHandler got %v, want [%v]", *errs, err)
+	}
+	if f.Current() != "welcome" {
+		t.Errorf("Current() = %q after a rejected change, want %q", f.Current(), "welcome")
+	}
+
+	if err := f.Change("check"); err != nil {
+		t.Fatal(err)
+	}
+	// check has no rules of its own, so it may change to anything
+	if err := f.Change("finish"); err != nil {
+		t.Errorf(`Change("finish") from a state without rules = %v`, err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	f := NewFSM()
+	recordErrors(f)
+	exits := 0
+	f.Register("finish", State{Exit: func() error {
+		exits++
+		return nil
+	}})
+	if err := f.Change("finish"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Stop()
+	if exits != 1 {
+		t.Errorf("Exit ran %d times on Stop, want 1", exits)
+	}
+	if f.Current() != "" {
+		t.Errorf("Current() = %q after Stop, want no active state", f.Current())
+	}
+
+	f.Stop()
+	if exits != 1 {
+		t.Errorf("Exit ran %d times after a second Stop, want 1", exits)
+	}
+}
+
+func TestReset(t *testing.T) {
+	f := NewFSM()
+	recordErrors(f)
+	welcomes, exits := 0, 0
+	f.Register("welcome", State{Enter: func() error {
+		welcomes++
+		return nil
+	}})
+	f.Register("finish", State{Exit: func() error {
+		exits++
+		return nil
+	}})
+	f.Allow("welcome", "finish")
+	f.Change("welcome")
+	f.Change("finish")
+
+	f.Reset()
+	if exits != 1 {
+		t.Errorf("Exit ran %d times on Reset, want 1", exits)
+	}
+	if f.Current() != "" || len(f.History()) != 0 {
+		t.Errorf("after Reset Current() = %q and History() = %q, want neither", f.Current(), f.History())
+	}
+	if !f.HasState("welcome") || !f.CanTransition("welcome") {
+		t.Fatal("Reset forgot the registered states")
+	}
+
+	if err := f.Change("welcome"); err != nil {
+		t.Fatal(err)
+	}
+	if welcomes != 2 {
+		t.Errorf("welcome entered %d times, want 2", welcomes)
+	}
+	if err := f.Change("finish"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.History(); !reflect.DeepEqual(got, []string{"welcome"}) {
+		t.Errorf("History() = %q, want [welcome]", got)
+	}
+}
+
+func TestStates(t *testing.T) {
+	f := NewFSM()
+	recordErrors(f)
+	for _, name := range []string{"welcome", "finish", "check"} {
+		f.Register(name, State{})
+	}
+
+	want := []string{"check", "finish", "welcome"}
+	if got := f.States(); !reflect.DeepEqual(got, want) {
+		t.Errorf("States() = %q, want %q", got, want)
+	}
+
+	if f.Current() != "" {
+		t.Errorf("Current() = %q before any Change, want none", f.Current())
+	}
+	f.Change("welcome")
+	f.Change("check")
+	if f.Current() != "check" {
+		t.Errorf("Current() = %q, want %q", f.Current(), "check")
+	}
+}
+
+func TestOnAny(t *testing.T) {
+	f := NewFSM()
+	recordErrors(f)
+	f.Register("a", State{})
+	f.Register("b", State{Enter: func() error { return errEnter }})
+	var first, second []string
+	f.OnAny(func(event, state string) {
+		first = append(first, event+" "+state)
+	})
+	f.OnAny(func(event, state string) {
+		second = append(second, event+" "+state)
+	})
+
+	f.Change("a")
+	f.Change("b")
+	f.Back()
+
+	want := []string{
+		"enter a",
+		"exit a",
+		"enter b",
+		"error b",
+		"exit b",
+		"enter a",
+	}
+	if !reflect.DeepEqual(first, want) {
+		t.Errorf("first observer got %q, want %q", first, want)
+	}
+	if !reflect.DeepEqual(second, want) {
+		t.Errorf("second observer got %q, want %q", second, want)
+	}
+}
+
+func TestChangeWithLaterState(t *testing.T) {
+	// what the states find out, as a troubleshooting session gathers it
+	type session struct{ pods []string }
+	f := NewFSM()
+	recordErrors(f)
+	var seen []string
+	f.RegisterWithCtx("report", StateWithCtx{Enter: func(ctx interface{}) error {
+		seen = ctx.(*session).pods
+		return nil
+	}})
+	f.RegisterWithCtx("check", StateWithCtx{Enter: func(ctx interface{}) error {
+		return f.ChangeWith("report", ctx)
+	}})
+	f.RegisterWithCtx("gather", StateWithCtx{Enter: func(ctx interface{}) error {
+		s := ctx.(*session)
+		s.pods = append(s.pods, "web-1", "web-2")
+		return f.ChangeWith("check", s)
+	}})
+
+	if err := f.ChangeWith("gather", &session{}); err != nil {
+		t.Fatal(err)
+	}
+	// set in one state, the data is what a state two changes later sees
+	if want := []string{"web-1", "web-2"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("report saw pods %v, want %v", seen, want)
+	}
+	if s, ok := f.Context().(*session); !ok || len(s.pods) != 2 {
+		t.Errorf("Context() = %v in the last state", f.Context())
+	}
+}
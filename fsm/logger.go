@@ -0,0 +1,50 @@
+package fsm
+
+import "log"
+
+// Logger is told about every State the FSM enters and exits, and every error it hands to the ErrorHandler.
+type Logger interface {
+	OnEnter(state string)
+	OnExit(state string)
+	OnError(state string, err error)
+}
+
+// NopLogger is a Logger that ignores everything.
+type NopLogger struct{}
+
+// OnEnter does nothing.
+func (NopLogger) OnEnter(state string) {}
+
+// OnExit does nothing.
+func (NopLogger) OnExit(state string) {}
+
+// OnError does nothing.
+func (NopLogger) OnError(state string, err error) {}
+
+// StdLogger is a Logger that writes a line per event to a standard library log.Logger, which timestamps them.
+type StdLogger struct {
+	Log *log.Logger
+}
+
+// NewStdLogger creates a StdLogger writing to l, or to the standard logger if l is nil.
+func NewStdLogger(l *log.Logger) *StdLogger {
+	if l == nil {
+		l = log.New(log.Writer(), "", log.LstdFlags)
+	}
+	return &StdLogger{Log: l}
+}
+
+// OnEnter logs that state was entered.
+func (s *StdLogger) OnEnter(state string) {
+	s.Log.Printf("fsm: enter %q", state)
+}
+
+// OnExit logs that state was exited.
+func (s *StdLogger) OnExit(state string) {
+	s.Log.Printf("fsm: exit %q", state)
+}
+
+// OnError logs the error raised in state.
+func (s *StdLogger) OnError(state string, err error) {
+	s.Log.Printf("fsm: error in %q: %v", state, err)
+}
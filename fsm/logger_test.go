@@ -0,0 +1,62 @@
+package fsm
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"testing"
+)
+
+// recordingLogger is a Logger that remembers each event as a line
+type recordingLogger struct {
+	events []string
+}
+
+func (r *recordingLogger) OnEnter(state string) {
+	r.events = append(r.events, "enter "+state)
+}
+
+func (r *recordingLogger) OnExit(state string) {
+	r.events = append(r.events, "exit "+state)
+}
+
+func (r *recordingLogger) OnError(state string, err error) {
+	r.events = append(r.events, "error "+state+": "+err.Error())
+}
+
+func TestLogger(t *testing.T) {
+	f := NewFSM()
+	recordErrors(f)
+	logger := &recordingLogger{}
+	f.Logger = logger
+	f.Register("a", State{})
+	f.Register("b", State{Enter: func() error { return errEnter }})
+
+	f.Change("a")
+	f.Change("b")
+	f.Stop()
+
+	want := []string{
+		"enter a",
+		"exit a",
+		"enter b",
+		"error b: enter failed",
+		"exit b",
+	}
+	if !reflect.DeepEqual(logger.events, want) {
+		t.Errorf("logged %q, want %q", logger.events, want)
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := NewStdLogger(log.New(&b, "", 0))
+	l.OnEnter("a")
+	l.OnExit("a")
+	l.OnError("b", errEnter)
+
+	want := "fsm: enter \"a\"\nfsm: exit \"a\"\nfsm: error in \"b\": enter failed\n"
+	if b.String() != want {
+		t.Errorf("logged %q, want %q", b.String(), want)
+	}
+}
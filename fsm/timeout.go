@@ -0,0 +1,111 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TimeoutError is passed to the ErrorHandler when a State's Enter runs past its Timeout. It wraps
+// context.DeadlineExceeded.
+type TimeoutError struct {
+	State   string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("fsm: state %q did not finish within %s", e.State, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// entry is a single time a State was entered, with the context its callbacks should watch.
+type entry struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// base is the BaseContext the entry's ctx derives from, whose own deadline isn't the State's Timeout
+	base context.Context
+
+	mu   sync.Mutex
+	left bool
+}
+
+// newEntry starts a new entry into the active State, ending the budget of the one before. It must be called with
+// the lock held.
+func (f *FSM) newEntry(timeout time.Duration) *entry {
+	base := f.BaseContext
+	if base == nil {
+		base = context.Background()
+	}
+	e := &entry{base: base}
+	if timeout > 0 {
+		e.ctx, e.cancel = context.WithTimeout(base, timeout)
+	} else {
+		e.ctx, e.cancel = context.WithCancel(base)
+	}
+	f.entry = e
+	return e
+}
+
+// leave records that the FSM moved on from the entry, so the time spent afterwards doesn't count against it.
+func (e *entry) leave() {
+	e.mu.Lock()
+	e.left = true
+	e.mu.Unlock()
+	e.cancel()
+}
+
+// StateContext returns a context that's done once the active State is exited, runs past its Timeout, or
+// BaseContext is done.
+func (f *FSM) StateContext() context.Context {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.entry == nil {
+		if f.BaseContext != nil {
+			return f.BaseContext
+		}
+		return context.Background()
+	}
+	return f.entry.ctx
+}
+
+// enterWithTimeout runs Enter in a goroutine, giving up on it if it neither returns nor changes State in time.
+// Enter's error is handed back rather than handled in the goroutine, so that it's only reported if the FSM hasn't
+// given up on it. It must be called without the lock held.
+func (f *FSM) enterWithTimeout(e *entry, state string, st StateWithCtx, ctx interface{}) {
+	done := make(chan error, 1)
+	go func() {
+		done <- st.Enter(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		f.reportEnter(err)
+		return
+	case <-e.ctx.Done():
+	}
+
+	e.mu.Lock()
+	timedOut := !e.left && e.ctx.Err() == context.DeadlineExceeded && e.base.Err() == nil
+	e.mu.Unlock()
+	if !timedOut {
+		// Enter moved on to another State, or BaseContext was cancelled, so it's no longer ours to time
+		f.reportEnter(<-done)
+		return
+	}
+
+	f.handleError(&TimeoutError{State: state, Timeout: st.Timeout})
+	if st.Fallback != "" {
+		f.Change(st.Fallback)
+	}
+}
+
+// reportEnter passes an error from Enter to the ErrorHandler. It must be called without the lock held.
+func (f *FSM) reportEnter(err error) {
+	if err != nil {
+		f.handleError(err)
+	}
+}
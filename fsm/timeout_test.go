@@ -0,0 +1,64 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeoutFallback(t *testing.T) {
+	f := NewFSM()
+	errs := recordErrors(f)
+	fellBack := false
+	f.Register("probe", State{
+		Enter: func() error {
+			<-f.StateContext().Done()
+			return f.StateContext().Err()
+		},
+		Timeout:  10 * time.Millisecond,
+		Fallback: "giveUp",
+	})
+	f.Register("giveUp", State{Enter: func() error {
+		fellBack = true
+		return nil
+	}})
+
+	if err := f.Change("probe"); err != nil {
+		t.Fatal(err)
+	}
+	if !fellBack || f.Current() != "giveUp" {
+		t.Errorf("Current() = %q, want the fallback %q", f.Current(), "giveUp")
+	}
+	if len(*errs) != 1 {
+		t.Fatalf("ErrorHandler got %v, want just the timeout", *errs)
+	}
+	var timeout *TimeoutError
+	if !errors.As((*errs)[0], &timeout) || timeout.State != "probe" {
+		t.Errorf("ErrorHandler got %v, want a *TimeoutError for %q", (*errs)[0], "probe")
+	}
+	if !errors.Is((*errs)[0], context.DeadlineExceeded) {
+		t.Errorf("%v doesn't wrap context.DeadlineExceeded", (*errs)[0])
+	}
+}
+
+func TestTimeoutNotReached(t *testing.T) {
+	f := NewFSM()
+	errs := recordErrors(f)
+	f.Register("quick", State{
+		Enter:    func() error { return nil },
+		Timeout:  time.Second,
+		Fallback: "giveUp",
+	})
+	f.Register("giveUp", State{})
+
+	if err := f.Change("quick"); err != nil {
+		t.Fatal(err)
+	}
+	if f.Current() != "quick" || len(*errs) != 0 {
+		t.Errorf("Current() = %q with errors %v, want %q without any", f.Current(), *errs, "quick")
+	}
+	if err := f.StateContext().Err(); err != nil {
+		t.Errorf("StateContext().Err() = %v while the state is still active", err)
+	}
+}
@@ -1,15 +1,18 @@
 module github.com/caseyhadden/kubetrbl
 
-go 1.14
+go 1.16
 
 require (
 	github.com/SolarLune/gofsm v0.0.0-20180925135138-d8db16fac19c
 	github.com/imdario/mergo v0.3.9 // indirect
 	github.com/mitchellh/go-homedir v1.1.0
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d // indirect
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
 	golang.org/x/time v0.0.0-20200416051211-89c76fbcd5d1 // indirect
 	k8s.io/api v0.18.3
 	k8s.io/apimachinery v0.18.3
 	k8s.io/client-go v0.18.3
+	k8s.io/metrics v0.18.3
 	k8s.io/utils v0.0.0-20200603063816-c1c6865ac451 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
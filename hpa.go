@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HPAForDeployment returns the HorizontalPodAutoscaler that scales the named Deployment, or nil if none does
+func (k *K8sContext) HPAForDeployment(ctx context.Context, name string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	var hpas *autoscalingv2.HorizontalPodAutoscalerList
+	err := k.retry(ctx, func() (err error) {
+		hpas, err = k.k8sClient.AutoscalingV2beta2().HorizontalPodAutoscalers(k.namespace).List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, hpa := range hpas.Items {
+		ref := hpa.Spec.ScaleTargetRef
+		if ref.Kind == "Deployment" && ref.Name == name {
+			return &hpas.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// hpaTargets describes what each of the autoscaler's metrics aims for
+func hpaTargets(hpa *autoscalingv2.HorizontalPodAutoscaler) []string {
+	result := []string{}
+	for _, m := range hpa.Spec.Metrics {
+		var name string
+		var target autoscalingv2.MetricTarget
+		switch {
+		case m.Resource != nil:
+			name, target = string(m.Resource.Name), m.Resource.Target
+		case m.Pods != nil:
+			name, target = m.Pods.Metric.Name, m.Pods.Target
+		case m.Object != nil:
+			name, target = m.Object.Metric.Name, m.Object.Target
+		case m.External != nil:
+			name, target = m.External.Metric.Name, m.External.Target
+		default:
+			result = append(result, string(m.Type))
+			continue
+		}
+		switch {
+		case target.AverageUtilization != nil:
+			result = append(result, fmt.Sprintf("%s at %d%% utilization", name, *target.AverageUtilization))
+		case target.AverageValue != nil:
+			result = append(result, fmt.Sprintf("%s averaging %s", name, target.AverageValue.String()))
+		case target.Value != nil:
+			result = append(result, fmt.Sprintf("%s at %s", name, target.Value.String()))
+		default:
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// hpaProblems describes the autoscaler's conditions that stop it scaling, such as being unable to fetch metrics
+func hpaProblems(hpa *autoscalingv2.HorizontalPodAutoscaler) []string {
+	result := []string{}
+	for _, c := range hpa.Status.Conditions {
+		if c.Type != autoscalingv2.ScalingActive && c.Type != autoscalingv2.AbleToScale {
+			continue
+		}
+		if c.Status != corev1.ConditionFalse {
+			continue
+		}
+		line := fmt.Sprintf("%s is False", c.Type)
+		if c.Reason != "" {
+			line += fmt.Sprintf(" (%s)", c.Reason)
+		}
+		if c.Message != "" {
+			line += ": " + c.Message
+		}
+		result = append(result, line)
+	}
+	return result
+}
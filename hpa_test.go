@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/caseyhadden/kubetrbl/report"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// testHPA makes an autoscaler of the named Deployment aiming for 70% CPU, with the conditions
+func testHPA(name, deployment string, conds ...autoscalingv2.HorizontalPodAutoscalerCondition) *autoscalingv2.HorizontalPodAutoscaler {
+	minReplicas, utilization := int32(2), int32(70)
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: deployment, APIVersion: "apps/v1"},
+			MinReplicas:    &minReplicas,
+			MaxReplicas:    10,
+			Metrics: []autoscalingv2.MetricSpec{{
+				Type:     autoscalingv2.ResourceMetricSourceType,
+				Resource: &autoscalingv2.ResourceMetricSource{Name: corev1.ResourceCPU, Target: autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: &utilization}},
+			}},
+		},
+		Status: autoscalingv2.HorizontalPodAutoscalerStatus{CurrentReplicas: 2, DesiredReplicas: 2, Conditions: conds},
+	}
+}
+
+// unableToFetch is the condition of an autoscaler that can't read its metrics
+var unableToFetch = autoscalingv2.HorizontalPodAutoscalerCondition{
+	Type:    autoscalingv2.ScalingActive,
+	Status:  corev1.ConditionFalse,
+	Reason:  "FailedGetResourceMetric",
+	Message: "the HPA was unable to compute the replica count: unable to get metrics for resource cpu: no metrics returned from resource metrics API",
+}
+
+func TestHPAForDeployment(t *testing.T) {
+	statefulSet := testHPA("db", "db")
+	statefulSet.Spec.ScaleTargetRef.Kind = "StatefulSet"
+	k := NewK8sContextWithClient(fakeClient(statefulSet, testHPA("api", "api"), testHPA("web", "web")), testNamespace)
+
+	hpa, err := k.HPAForDeployment(context.Background(), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hpa == nil || hpa.Name != "web" {
+		t.Errorf("HPAForDeployment(web) = %v, want web", hpa)
+	}
+	// a StatefulSet of the same name isn't the Deployment
+	if hpa, err := k.HPAForDeployment(context.Background(), "db"); err != nil || hpa != nil {
+		t.Errorf("HPAForDeployment(db) = %v, %v; want none", hpa, err)
+	}
+}
+
+func TestHPATargets(t *testing.T) {
+	hpa := testHPA("web", "web")
+	value, average := resource.MustParse("100"), resource.MustParse("500m")
+	hpa.Spec.Metrics = append(hpa.Spec.Metrics,
+		autoscalingv2.MetricSpec{Type: autoscalingv2.PodsMetricSourceType, Pods: &autoscalingv2.PodsMetricSource{
+			Metric: autoscalingv2.MetricIdentifier{Name: "requests_per_second"},
+			Target: autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType, AverageValue: &average},
+		}},
+		autoscalingv2.MetricSpec{Type: autoscalingv2.ExternalMetricSourceType, External: &autoscalingv2.ExternalMetricSource{
+			Metric: autoscalingv2.MetricIdentifier{Name: "queue_depth"},
+			Target: autoscalingv2.MetricTarget{Type: autoscalingv2.ValueMetricType, Value: &value},
+		}},
+	)
+
+	want := []string{"cpu at 70% utilization", "requests_per_second averaging 500m", "queue_depth at 100"}
+	if got := hpaTargets(hpa); !reflect.DeepEqual(got, want) {
+		t.Errorf("hpaTargets = %q, want %q", got, want)
+	}
+}
+
+func TestHPAProblems(t *testing.T) {
+	hpa := testHPA("web", "web",
+		autoscalingv2.HorizontalPodAutoscalerCondition{Type: autoscalingv2.AbleToScale, Status: corev1.ConditionTrue, Reason: "SucceededGetScale"},
+		unableToFetch,
+		// being within or held to its range doesn't stop the autoscaler working
+		autoscalingv2.HorizontalPodAutoscalerCondition{Type: autoscalingv2.ScalingLimited, Status: corev1.ConditionFalse, Reason: "DesiredWithinRange"},
+	)
+
+	want := []string{"ScalingActive is False (FailedGetResourceMetric): " + unableToFetch.Message}
+	if got := hpaProblems(hpa); !reflect.DeepEqual(got, want) {
+		t.Errorf("hpaProblems = %q, want %q", got, want)
+	}
+	if got := hpaProblems(testHPA("web", "web")); len(got) != 0 {
+		t.Errorf("hpaProblems of a healthy autoscaler = %q, want none", got)
+	}
+}
+
+func TestCheckHPA(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	cfg := answered
+	cfg.Only = []string{onlyEndpoints}
+	objs := []runtime.Object{testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), ready, testDeployment("web", 2)}
+
+	k, out := troubleshoot(t, cfg, "getNamespace", "", append(objs, testHPA("web", "web", unableToFetch))...)
+
+	c := wantCheck(t, k, checkHPA, "web", report.StatusFail)
+	if !strings.Contains(c.Message, "can't scale: ScalingActive is False (FailedGetResourceMetric)") {
+		t.Errorf("HPA check said %q", c.Message)
+	}
+	if want := "HorizontalPodAutoscaler 'web' scales Deployment 'web' between 2 and 10 replicas; it has 2 and wants 2.\n  Targets: cpu at 70% utilization\n"; !strings.Contains(out, want) {
+		t.Errorf("didn't describe the autoscaler:\n%s", out)
+	}
+
+	// a Deployment without an autoscaler says nothing about one
+	k, out = troubleshoot(t, cfg, "getNamespace", "", objs...)
+	if len(checksNamed(k, checkHPA)) != 0 || strings.Contains(out, "HorizontalPodAutoscaler") {
+		t.Errorf("reported on an autoscaler that isn't there: %+v\n%s", checksNamed(k, checkHPA), out)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// IngressRoute is a host and path an Ingress sends to a service port. The default backend has no host or path.
+type IngressRoute struct {
+	Host string
+	Path string
+	Port intstr.IntOrString
+}
+
+// IngressesForService returns the Ingresses in the namespace with a rule or default backend that sends traffic to
+// the named service
+func (k *K8sContext) IngressesForService(ctx context.Context, svcName string) ([]networkingv1beta1.Ingress, error) {
+	result := []networkingv1beta1.Ingress{}
+	opts := metav1.ListOptions{Limit: listPageSize}
+	for {
+		var ings *networkingv1beta1.IngressList
+		err := k.retry(ctx, func() (err error) {
+			ings, err = k.k8sClient.NetworkingV1beta1().Ingresses(k.namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return []networkingv1beta1.Ingress{}, err
+		}
+		for _, ing := range ings.Items {
+			if len(ingressRoutes(ing, svcName)) > 0 {
+				result = append(result, ing)
+			}
+		}
+		if ings.Continue == "" {
+			return result, nil
+		}
+		opts.Continue = ings.Continue
+	}
+}
+
+// ingressRoutes returns the routes of the Ingress that send traffic to the named service
+func ingressRoutes(ing networkingv1beta1.Ingress, svcName string) []IngressRoute {
+	result := []IngressRoute{}
+	if b := ing.Spec.Backend; b != nil && b.ServiceName == svcName {
+		result = append(result, IngressRoute{Port: b.ServicePort})
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			if p.Backend.ServiceName == svcName {
+				result = append(result, IngressRoute{Host: rule.Host, Path: p.Path, Port: p.Backend.ServicePort})
+			}
+		}
+	}
+	return result
+}
+
+// servicePortFor returns the port of the service an Ingress's port refers to, either by number or by name
+func servicePortFor(svc corev1.Service, port intstr.IntOrString) (corev1.ServicePort, bool) {
+	for _, p := range svc.Spec.Ports {
+		if (port.Type == intstr.Int && p.Port == port.IntVal) || (port.Type == intstr.String && p.Name == port.StrVal) {
+			return p, true
+		}
+	}
+	return corev1.ServicePort{}, false
+}
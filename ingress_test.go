@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/caseyhadden/kubetrbl/report"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// backend makes an Ingress backend sending traffic to the port of the named service
+func backend(svc string, port intstr.IntOrString) networkingv1beta1.IngressBackend {
+	return networkingv1beta1.IngressBackend{ServiceName: svc, ServicePort: port}
+}
+
+// testIngress makes an Ingress with a rule for the host sending each of the paths to its backend
+func testIngress(name, host string, paths map[string]networkingv1beta1.IngressBackend) *networkingv1beta1.Ingress {
+	rule := networkingv1beta1.IngressRule{Host: host, IngressRuleValue: networkingv1beta1.IngressRuleValue{HTTP: &networkingv1beta1.HTTPIngressRuleValue{}}}
+	for _, path := range []string{"/", "/api", "/static"} {
+		if b, ok := paths[path]; ok {
+			rule.HTTP.Paths = append(rule.HTTP.Paths, networkingv1beta1.HTTPIngressPath{Path: path, Backend: b})
+		}
+	}
+	return &networkingv1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec:       networkingv1beta1.IngressSpec{Rules: []networkingv1beta1.IngressRule{rule}},
+	}
+}
+
+func TestIngressRoutes(t *testing.T) {
+	ing := testIngress("site", "example.com", map[string]networkingv1beta1.IngressBackend{
+		"/":       backend("web", intstr.FromString("http")),
+		"/api":    backend("api", intstr.FromInt(8080)),
+		"/static": backend("web", intstr.FromInt(80)),
+	})
+	def := backend("web", intstr.FromInt(80))
+	ing.Spec.Backend = &def
+	// a rule without HTTP paths routes nothing
+	ing.Spec.Rules = append(ing.Spec.Rules, networkingv1beta1.IngressRule{Host: "tcp.example.com"})
+
+	want := []IngressRoute{
+		{Port: intstr.FromInt(80)},
+		{Host: "example.com", Path: "/", Port: intstr.FromString("http")},
+		{Host: "example.com", Path: "/static", Port: intstr.FromInt(80)},
+	}
+	if got := ingressRoutes(*ing, "web"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ingressRoutes(web) = %+v, want %+v", got, want)
+	}
+	if got := ingressRoutes(*ing, "db"); len(got) != 0 {
+		t.Errorf("ingressRoutes(db) = %+v, want none", got)
+	}
+}
+
+func TestServicePortFor(t *testing.T) {
+	svc := testService()
+	svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Name: "metrics", Port: 9090})
+	tests := []struct {
+		port intstr.IntOrString
+		want string
+		ok   bool
+	}{
+		{intstr.FromString("http"), "http", true},
+		{intstr.FromInt(9090), "metrics", true},
+		// a number is the service's port, never its target port or a name
+		{intstr.FromInt(8080), "", false},
+		{intstr.FromString("80"), "", false},
+		{intstr.FromString("grpc"), "", false},
+	}
+	for _, tt := range tests {
+		p, ok := servicePortFor(*svc, tt.port)
+		if ok != tt.ok || p.Name != tt.want {
+			t.Errorf("servicePortFor(%s) = %q, %v; want %q, %v", tt.port.String(), p.Name, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIngressesForService(t *testing.T) {
+	k := NewK8sContextWithClient(fakeClient(
+		testIngress("site", "example.com", map[string]networkingv1beta1.IngressBackend{"/": backend("web", intstr.FromString("http"))}),
+		testIngress("api", "api.example.com", map[string]networkingv1beta1.IngressBackend{"/": backend("api", intstr.FromInt(80))}),
+	), testNamespace)
+
+	ings, err := k.IngressesForService(context.Background(), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ings) != 1 || ings[0].Name != "site" {
+		t.Errorf("IngressesForService(web) = %v, want only site", ings)
+	}
+}
+
+func TestCheckIngress(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	site := testIngress("site", "example.com", map[string]networkingv1beta1.IngressBackend{
+		"/":    backend("web", intstr.FromString("http")),
+		"/api": backend("web", intstr.FromInt(8080)),
+	})
+	site.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}}
+	pending := testIngress("pending", "", map[string]networkingv1beta1.IngressBackend{"/": backend("web", intstr.FromInt(80))})
+	cfg := answered
+	cfg.Only = []string{onlyIngress}
+
+	k, out := troubleshoot(t, cfg, "getNamespace", "", testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), ready, testDeployment("web", 1), site, pending)
+
+	c := wantCheck(t, k, checkIngress, "site", report.StatusFail)
+	if !strings.Contains(c.Message, "sends example.com/api to port '8080'") {
+		t.Errorf("ingress check said %q, want the route to the port the service doesn't expose", c.Message)
+	}
+	wantCheck(t, k, checkIngress, "site", report.StatusPass)
+	wantCheck(t, k, checkIngress, "pending", report.StatusWarn)
+	for _, want := range []string{"Ingress 'site' (class (default)) routes to the service:\n  example.com/ -> port http\n", "  */ -> port 80\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("didn't print %q:\n%s", want, out)
+		}
+	}
+}
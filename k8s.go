@@ -2,42 +2,110 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mitchellh/go-homedir"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/client-go/deprecated/scheme"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
 // K8sContext contains data about the path the user took through the troubleshooting
 type K8sContext struct {
 	kubeConfigPath string
-	k8sClient      *kubernetes.Clientset
+	contextName    string
+	k8sClient      kubernetes.Interface
 	namespace      string
+	// retryAttempts is how many times an API call is tried when it fails in a way that may pass
+	retryAttempts int
 
-	config        *rest.Config
+	config *rest.Config
+	// metricsClient reads the metrics API, which clusters only serve with an add-on like metrics-server
+	metricsClient metricsclient.Interface
+	// pods are every pod checked in the namespace, podList those the service sends traffic to
 	pods          []corev1.Pod
 	svc           corev1.Service
 	svcPort       corev1.ServicePort
-	controller    *appsv1.Deployment
+	controller    *Controller
 	containerPort corev1.ContainerPort
-	//podList       []corev1.Pod
-	podPort corev1.ContainerPort
+	podList       []corev1.Pod
+	// svcPorts are the service ports chosen to check, and ports those of them that can be probed; svcPort and
+	// containerPort are the first of these
+	svcPorts []corev1.ServicePort
+	ports    []PortMapping
+	// controllers are every workload whose pods the service selects; controller is the first of these
+	controllers []*Controller
 }
 
+// PortMapping pairs a service port with the container port it sends traffic to. Starting from a Deployment, there's
+// no service port.
+type PortMapping struct {
+	Service   corev1.ServicePort
+	Container corev1.ContainerPort
+}
+
+// Clear forgets everything gathered about the namespace being troubleshot, keeping the client to the cluster
+func (k *K8sContext) Clear() {
+	k.namespace = ""
+	k.pods = nil
+	k.svc = corev1.Service{}
+	k.svcPort = corev1.ServicePort{}
+	k.controller = nil
+	k.containerPort = corev1.ContainerPort{}
+	k.podList = nil
+	k.svcPorts = nil
+	k.ports = nil
+	k.controllers = nil
+}
+
+// inClusterConfig is the kubeconfig "path" that means to use the service account of the pod we're running in
+const inClusterConfig = "in-cluster"
+
 func NewK8sContext(config string) *K8sContext {
 	return &K8sContext{
 		kubeConfigPath: config,
+		retryAttempts:  defaultRetryAttempts,
+	}
+}
+
+// NewK8sContextWithClient creates a K8sContext for the namespace that uses an existing client, such as a fake one
+func NewK8sContextWithClient(client kubernetes.Interface, ns string) *K8sContext {
+	return &K8sContext{
+		k8sClient:     client,
+		namespace:     ns,
+		retryAttempts: defaultRetryAttempts,
 	}
 }
 
 func (k *K8sContext) InitClient() error {
-	// use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", k.kubeConfigPath)
+	var config *rest.Config
+	var err error
+	if k.InCluster() {
+		config, err = rest.InClusterConfig()
+	} else {
+		// use the chosen context in kubeconfig, or its current context if none was chosen
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			k.loadingRules(),
+			&clientcmd.ConfigOverrides{CurrentContext: k.contextName},
+		).ClientConfig()
+	}
 	if err != nil {
 		return err
 	}
@@ -64,83 +132,1043 @@ func (k *K8sContext) InitClient() error {
 	if err != nil {
 		return err
 	}
+	k.metricsClient, err = metricsclient.NewForConfig(config)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
-func (k *K8sContext) getNamespaces() ([]string, error) {
-	nms, err := k.k8sClient.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+// reachTimeout is how long CheckReachable waits on the API server
+const reachTimeout = 15 * time.Second
+
+// CheckReachable asks the API server for its version, so a cluster that's down or a kubeconfig that's wrong is
+// found out before anything relies on the connection. The client only has to be created for this, not connect.
+func (k *K8sContext) CheckReachable(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, reachTimeout)
+	defer cancel()
+	// ServerVersion doesn't take a context, so it's left to finish on its own if we stop waiting
+	type result struct {
+		version string
+		err     error
+	}
+	results := make(chan result, 1)
+	go func() {
+		v, err := k.ServerVersion()
+		results <- result{v, err}
+	}()
+	var r result
+	select {
+	case r = <-results:
+	case <-ctx.Done():
+		r.err = ctx.Err()
+	}
+	if r.err != nil {
+		return "", fmt.Errorf("cannot reach cluster at %s: %w", k.host(), r.err)
+	}
+	return r.version, nil
+}
+
+// ServerVersion returns the cluster's Kubernetes version, such as v1.29.3
+func (k *K8sContext) ServerVersion() (string, error) {
+	info, err := k.k8sClient.Discovery().ServerVersion()
+	if err != nil {
+		return "", err
+	}
+	return info.GitVersion, nil
+}
+
+// clientMinorVersion is the Kubernetes minor version of the client libraries we're built with
+const clientMinorVersion = 18
+
+// versionSkew returns how many minor versions the cluster's version is from the client libraries', negative when
+// the cluster is older. It's false if the version can't be parsed.
+func versionSkew(serverVersion string) (int, bool) {
+	v, err := utilversion.ParseGeneric(serverVersion)
+	if err != nil || v.Major() != 1 {
+		return 0, false
+	}
+	return int(v.Minor()) - clientMinorVersion, true
+}
+
+// host returns the API server the client connects to
+func (k *K8sContext) host() string {
+	if k.config == nil {
+		return "unknown host"
+	}
+	return k.config.Host
+}
+
+// InCluster returns if we connect using the service account of the pod we're running in
+func (k *K8sContext) InCluster() bool {
+	return k.kubeConfigPath == inClusterConfig
+}
+
+// runningInCluster returns if we appear to be running inside a Kubernetes pod
+func runningInCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != "" && os.Getenv("KUBERNETES_SERVICE_PORT") != ""
+}
+
+// loadingRules finds the kubeconfig at the given path or, when none was given, merges the kubeconfigs listed in
+// $KUBECONFIG or falls back to ~/.kube/config
+func (k *K8sContext) loadingRules() *clientcmd.ClientConfigLoadingRules {
+	if k.kubeConfigPath == "" {
+		return clientcmd.NewDefaultClientConfigLoadingRules()
+	}
+	return &clientcmd.ClientConfigLoadingRules{ExplicitPath: k.kubeConfigPath}
+}
+
+// defaultKubeConfigPath returns the kubeconfig we'll use when the user doesn't give one, or "" if there's none
+func defaultKubeConfigPath() string {
+	candidates := filepath.SplitList(os.Getenv(clientcmd.RecommendedConfigPathEnvVar))
+	if home, err := homedir.Dir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, clientcmd.RecommendedHomeDir, clientcmd.RecommendedFileName))
+	}
+
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c
+		}
+	}
+	return ""
+}
+
+// ListContexts returns the names of the contexts in the kubeconfig, sorted
+func (k *K8sContext) ListContexts() ([]string, error) {
+	cfg, err := k.loadingRules().Load()
 	if err != nil {
 		return []string{}, err
 	}
 
 	result := []string{}
-	for _, nm := range nms.Items {
-		result = append(result, nm.GetName())
+	for name := range cfg.Contexts {
+		result = append(result, name)
 	}
+	sort.Strings(result)
 	return result, nil
 }
 
-func (k *K8sContext) GetPods() ([]corev1.Pod, error) {
-	podList, err := k.k8sClient.CoreV1().Pods(k.namespace).List(context.TODO(), metav1.ListOptions{})
+// CurrentContext returns the name of the kubeconfig's current context
+func (k *K8sContext) CurrentContext() (string, error) {
+	cfg, err := k.loadingRules().Load()
 	if err != nil {
-		return []corev1.Pod{}, err
+		return "", err
 	}
+	return cfg.CurrentContext, nil
+}
 
-	pods := []corev1.Pod{}
-	for _, p := range podList.Items {
-		pods = append(pods, p)
+// listPageSize is how many objects we ask for at a time when listing
+const listPageSize = 100
+
+func (k *K8sContext) getNamespaces(ctx context.Context) ([]string, error) {
+	nms, err := k.GetNamespaceObjects(ctx)
+	if err != nil {
+		return []string{}, err
+	}
+	result := []string{}
+	for _, nm := range nms {
+		result = append(result, nm.GetName())
+	}
+	return result, nil
+}
+
+// GetNamespaceObjects returns every namespace in the cluster, with its status
+func (k *K8sContext) GetNamespaceObjects(ctx context.Context) ([]corev1.Namespace, error) {
+	result := []corev1.Namespace{}
+	opts := metav1.ListOptions{Limit: listPageSize}
+	for {
+		var nms *corev1.NamespaceList
+		err := k.retry(ctx, func() (err error) {
+			nms, err = k.k8sClient.CoreV1().Namespaces().List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return []corev1.Namespace{}, err
+		}
+		result = append(result, nms.Items...)
+		if nms.Continue == "" {
+			return result, nil
+		}
+		opts.Continue = nms.Continue
+	}
+}
+
+// GetNamespace returns the named namespace, or nil if it doesn't exist
+func (k *K8sContext) GetNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
+	var ns *corev1.Namespace
+	err := k.retry(ctx, func() (err error) {
+		ns, err = k.k8sClient.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return ns, err
+}
+
+// NamespaceExists returns if the named namespace exists
+func (k *K8sContext) NamespaceExists(ctx context.Context, name string) (bool, error) {
+	ns, err := k.GetNamespace(ctx, name)
+	return ns != nil, err
+}
+
+// terminating returns if the namespace is being deleted, along with everything in it
+func terminating(ns corev1.Namespace) bool {
+	return ns.Status.Phase == corev1.NamespaceTerminating
+}
+
+// GetPod returns the named pod, with a plain error if there's no such pod
+func (k *K8sContext) GetPod(ctx context.Context, name string) (*corev1.Pod, error) {
+	var pod *corev1.Pod
+	err := k.retry(ctx, func() (err error) {
+		pod, err = k.k8sClient.CoreV1().Pods(k.namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("pod '%s' not found in namespace '%s'", name, k.namespace)
+	}
+	return pod, err
+}
+
+func (k *K8sContext) GetPods(ctx context.Context) ([]corev1.Pod, error) {
+	return k.GetPodsBySelector(ctx, "")
+}
+
+// GetPodsBySelector works like GetPods, but only retrieves the pods matching the label selector
+func (k *K8sContext) GetPodsBySelector(ctx context.Context, selector string) ([]corev1.Pod, error) {
+	pods, err := k.listPods(ctx, selector)
+	if err != nil {
+		return pods, err
 	}
 	k.pods = pods
 	return pods, nil
 }
 
+// GetAllPods returns the pods in every namespace, which can be a lot of pods
+func (k *K8sContext) GetAllPods(ctx context.Context) ([]corev1.Pod, error) {
+	return k.listPodsIn(ctx, metav1.NamespaceAll, "")
+}
+
+// listPods returns the pods in the namespace matching the label selector, or every pod for an empty selector
+func (k *K8sContext) listPods(ctx context.Context, selector string) ([]corev1.Pod, error) {
+	return k.listPodsIn(ctx, k.namespace, selector)
+}
+
+// listPodsIn works like listPods for the given namespace, or for all of them with metav1.NamespaceAll
+func (k *K8sContext) listPodsIn(ctx context.Context, namespace, selector string) ([]corev1.Pod, error) {
+	result := []corev1.Pod{}
+	opts := metav1.ListOptions{LabelSelector: selector, Limit: listPageSize}
+	for {
+		var podList *corev1.PodList
+		err := k.retry(ctx, func() (err error) {
+			podList, err = k.k8sClient.CoreV1().Pods(namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return []corev1.Pod{}, err
+		}
+		result = append(result, podList.Items...)
+		if podList.Continue == "" {
+			return result, nil
+		}
+		opts.Continue = podList.Continue
+	}
+}
+
 func (k *K8sContext) GetPendingPods() ([]string, error) {
+	return pendingPods(k.pods), nil
+}
+
+func (k *K8sContext) GetNonrunningPods() ([]string, error) {
+	return nonrunningPods(k.pods), nil
+}
+
+func (k *K8sContext) GetNotReadyPods() ([]string, error) {
+	return notReadyPods(k.pods), nil
+}
+
+// pendingPods returns the names of the pods that are pending
+func pendingPods(pods []corev1.Pod) []string {
+	return podNames(pods, IsPending)
+}
+
+// nonrunningPods returns the names of the pods that aren't running
+func nonrunningPods(pods []corev1.Pod) []string {
+	return podNames(pods, func(pod corev1.Pod) bool { return !IsRunning(pod) })
+}
+
+// notReadyPods returns the names of the pods that aren't ready. A pod yet to report whether it's ready is still
+// being scheduled, and counts as pending instead.
+func notReadyPods(pods []corev1.Pod) []string {
+	return podNames(pods, func(pod corev1.Pod) bool { return hasCondition(pod, corev1.PodReady) && !IsReady(pod) })
+}
+
+// podNames returns the names of the pods matching the predicate
+func podNames(pods []corev1.Pod, matches func(corev1.Pod) bool) []string {
 	result := []string{}
-	for _, pod := range k.pods {
-		status := pod.Status
-		if status.Phase == corev1.PodPending {
+	for _, pod := range pods {
+		if matches(pod) {
 			result = append(result, pod.GetName())
 		}
 	}
+	return result
+}
+
+func (k *K8sContext) GetServices(ctx context.Context) ([]string, error) {
+	result := []string{}
+
+	svcs, err := k.listServices(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	for _, s := range svcs {
+		result = append(result, s.GetName())
+	}
+
 	return result, nil
 }
 
-func (k *K8sContext) GetNonrunningPods() ([]string, error) {
+// GetService returns the named service, with a plain error if there's no such service
+func (k *K8sContext) GetService(ctx context.Context, name string) (*corev1.Service, error) {
+	var svc *corev1.Service
+	err := k.retry(ctx, func() (err error) {
+		svc, err = k.k8sClient.CoreV1().Services(k.namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("service '%s' not found in namespace '%s'", name, k.namespace)
+	}
+	return svc, err
+}
+
+// ServicePortByName returns the port of the service with the given name, or number
+func ServicePortByName(svc corev1.Service, portName string) (corev1.ServicePort, error) {
+	for _, p := range svc.Spec.Ports {
+		if p.Name == portName || strconv.Itoa(int(p.Port)) == portName {
+			return p, nil
+		}
+	}
+	names := []string{}
+	for _, p := range svc.Spec.Ports {
+		names = append(names, fmt.Sprintf("%s (%d)", p.Name, p.Port))
+	}
+	return corev1.ServicePort{}, fmt.Errorf("service '%s' has no port '%s'; it has %s", svc.GetName(), portName, strings.Join(names, ", "))
+}
+
+// listServices returns every service in the namespace
+func (k *K8sContext) listServices(ctx context.Context) ([]corev1.Service, error) {
+	result := []corev1.Service{}
+	opts := metav1.ListOptions{Limit: listPageSize}
+	for {
+		var svcs *corev1.ServiceList
+		err := k.retry(ctx, func() (err error) {
+			svcs, err = k.k8sClient.CoreV1().Services(k.namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return []corev1.Service{}, err
+		}
+		result = append(result, svcs.Items...)
+		if svcs.Continue == "" {
+			return result, nil
+		}
+		opts.Continue = svcs.Continue
+	}
+}
+
+// GetPodEvents returns the events for the named pod, most recent first
+func (k *K8sContext) GetPodEvents(ctx context.Context, podName string) ([]corev1.Event, error) {
+	return k.GetEventsFor(ctx, "Pod", podName, 0)
+}
+
+// WaitReason is why a container is waiting to run
+type WaitReason struct {
+	Reason  string
+	Message string
+}
+
+// GetContainerWaitReasons returns, by container name, why any of the named pod's containers are waiting
+func (k *K8sContext) GetContainerWaitReasons(podName string) (map[string]WaitReason, error) {
+	result := map[string]WaitReason{}
+	pod, err := k.findPod(podName)
+	if err != nil {
+		return result, err
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil {
+			result[cs.Name] = WaitReason{
+				Reason:  cs.State.Waiting.Reason,
+				Message: cs.State.Waiting.Message,
+			}
+		}
+	}
+	return result, nil
+}
+
+// GetUnboundPVCs returns a description of each persistent volume claim used by the pod that isn't bound, including
+// the storage class it asked for
+func (k *K8sContext) GetUnboundPVCs(ctx context.Context, pod corev1.Pod) ([]string, error) {
 	result := []string{}
-	for _, pod := range k.pods {
-		status := pod.Status
-		if status.Phase != corev1.PodRunning {
-			result = append(result, pod.GetName())
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		name := v.PersistentVolumeClaim.ClaimName
+		var pvc *corev1.PersistentVolumeClaim
+		err := k.retry(ctx, func() (err error) {
+			pvc, err = k.k8sClient.CoreV1().PersistentVolumeClaims(pod.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			result = append(result, fmt.Sprintf("claim '%s' does not exist", name))
+			continue
+		}
+		if err != nil {
+			return []string{}, err
+		}
+		if pvc.Status.Phase == corev1.ClaimBound {
+			continue
 		}
+
+		if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+			result = append(result, fmt.Sprintf("claim '%s' is %s and requests no storage class; is there a default StorageClass?", name, pvc.Status.Phase))
+			continue
+		}
+		class := *pvc.Spec.StorageClassName
+		err = k.retry(ctx, func() error {
+			_, err := k.k8sClient.StorageV1().StorageClasses().Get(ctx, class, metav1.GetOptions{})
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			result = append(result, fmt.Sprintf("claim '%s' is %s and requests storage class '%s', which does not exist", name, pvc.Status.Phase, class))
+			continue
+		}
+		if err != nil {
+			return []string{}, err
+		}
+		result = append(result, fmt.Sprintf("claim '%s' is %s with storage class '%s'", name, pvc.Status.Phase, class))
 	}
 	return result, nil
 }
 
-func (k *K8sContext) GetNotReadyPods() ([]string, error) {
+// MissingConfigReferences returns the ConfigMaps and Secrets the pod refers to that don't exist, like
+// "Secret 'db-creds'". References marked optional aren't checked.
+func (k *K8sContext) MissingConfigReferences(ctx context.Context, pod corev1.Pod) ([]string, error) {
+	configMaps, secrets := configReferences(pod)
+
+	result := []string{}
+	for _, name := range configMaps {
+		err := k.retry(ctx, func() error {
+			_, err := k.k8sClient.CoreV1().ConfigMaps(pod.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			result = append(result, fmt.Sprintf("ConfigMap '%s'", name))
+		} else if err != nil {
+			return []string{}, err
+		}
+	}
+	for _, name := range secrets {
+		err := k.retry(ctx, func() error {
+			_, err := k.k8sClient.CoreV1().Secrets(pod.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			result = append(result, fmt.Sprintf("Secret '%s'", name))
+		} else if err != nil {
+			return []string{}, err
+		}
+	}
+	return result, nil
+}
+
+// configReferences returns the sorted names of the ConfigMaps and Secrets a pod requires through its containers'
+// environment and its volumes
+func configReferences(pod corev1.Pod) ([]string, []string) {
+	configMaps, secrets := map[string]bool{}, map[string]bool{}
+	required := func(optional *bool) bool {
+		return optional == nil || !*optional
+	}
+
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		for _, from := range c.EnvFrom {
+			if ref := from.ConfigMapRef; ref != nil && required(ref.Optional) {
+				configMaps[ref.Name] = true
+			}
+			if ref := from.SecretRef; ref != nil && required(ref.Optional) {
+				secrets[ref.Name] = true
+			}
+		}
+		for _, env := range c.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil && required(ref.Optional) {
+				configMaps[ref.Name] = true
+			}
+			if ref := env.ValueFrom.SecretKeyRef; ref != nil && required(ref.Optional) {
+				secrets[ref.Name] = true
+			}
+		}
+	}
+	for _, v := range pod.Spec.Volumes {
+		if cm := v.ConfigMap; cm != nil && required(cm.Optional) {
+			configMaps[cm.Name] = true
+		}
+		if sec := v.Secret; sec != nil && required(sec.Optional) {
+			secrets[sec.SecretName] = true
+		}
+	}
+
+	names := func(set map[string]bool) []string {
+		result := []string{}
+		for name := range set {
+			result = append(result, name)
+		}
+		sort.Strings(result)
+		return result
+	}
+	return names(configMaps), names(secrets)
+}
+
+// GetPodConditions returns the conditions of the named pod from those last retrieved by GetPods
+func (k *K8sContext) GetPodConditions(podName string) ([]corev1.PodCondition, error) {
+	pod, err := k.findPod(podName)
+	if err != nil {
+		return nil, err
+	}
+	return pod.Status.Conditions, nil
+}
+
+// formatConditions describes each condition that isn't true, along with each readiness gate that hasn't been
+// reported at all, since a pod can't be ready until every one of its gates is true
+func formatConditions(conds []corev1.PodCondition, gates []corev1.PodReadinessGate) []string {
+	isGate := map[corev1.PodConditionType]bool{}
+	for _, g := range gates {
+		isGate[g.ConditionType] = true
+	}
 	result := []string{}
+	seen := map[corev1.PodConditionType]bool{}
+	for _, c := range conds {
+		seen[c.Type] = true
+		if c.Status == corev1.ConditionTrue {
+			continue
+		}
+		line := fmt.Sprintf("%s is %s", c.Type, c.Status)
+		if isGate[c.Type] {
+			line = "readiness gate " + line
+		}
+		if c.Reason != "" {
+			line += fmt.Sprintf(" (%s)", c.Reason)
+		}
+		if c.Message != "" {
+			line += ": " + c.Message
+		}
+		result = append(result, line)
+	}
+	for _, g := range gates {
+		if !seen[g.ConditionType] {
+			result = append(result, fmt.Sprintf("readiness gate %s hasn't been reported", g.ConditionType))
+		}
+	}
+	return result
+}
+
+// conditionFalse returns if the condition of the given type is present and not true
+func conditionFalse(conds []corev1.PodCondition, t corev1.PodConditionType) bool {
+	for _, c := range conds {
+		if c.Type == t {
+			return c.Status != corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// headless returns if a service has no cluster IP, meaning clients reach its pods' IPs straight from DNS
+func headless(svc corev1.Service) bool {
+	return svc.Spec.ClusterIP == corev1.ClusterIPNone
+}
+
+// findPod returns the named pod from those last retrieved by GetPods
+func (k *K8sContext) findPod(podName string) (corev1.Pod, error) {
 	for _, pod := range k.pods {
-		status := pod.Status
-		for _, c := range status.Conditions {
-			if c.Type == corev1.PodReady && c.Status != corev1.ConditionTrue {
-				result = append(result, pod.GetName())
+		if pod.GetName() == podName {
+			return pod, nil
+		}
+	}
+	return corev1.Pod{}, fmt.Errorf("pod '%s' not found in namespace '%s'", podName, k.namespace)
+}
+
+// ReadinessProbeFor returns the readiness probe configured for the named container, preferring the pod template of
+// the backing controller when it's known. The probe is nil if the container has none.
+func (k *K8sContext) ReadinessProbeFor(containerName string) (*corev1.Probe, error) {
+	specs := []corev1.PodSpec{}
+	if k.controller != nil {
+		specs = append(specs, k.controller.Template.Spec)
+	}
+	for _, pod := range k.pods {
+		specs = append(specs, pod.Spec)
+	}
+
+	for _, spec := range specs {
+		for _, cnt := range spec.Containers {
+			if cnt.Name == containerName {
+				return cnt.ReadinessProbe, nil
 			}
 		}
 	}
+	return nil, fmt.Errorf("container '%s' not found in namespace '%s'", containerName, k.namespace)
+}
+
+// describeProbe renders what a probe checks, e.g. "HTTP GET :8080/healthz"
+func describeProbe(p *corev1.Probe) string {
+	switch {
+	case p == nil:
+		return "no probe configured"
+	case p.HTTPGet != nil:
+		return fmt.Sprintf("HTTP GET %s:%s%s", strings.ToLower(string(p.HTTPGet.Scheme)), p.HTTPGet.Port.String(), p.HTTPGet.Path)
+	case p.Exec != nil:
+		return fmt.Sprintf("exec %s", strings.Join(p.Exec.Command, " "))
+	case p.TCPSocket != nil:
+		return fmt.Sprintf("TCP port %s", p.TCPSocket.Port.String())
+	}
+	return "unknown probe"
+}
+
+// PodRestartInfo describes a container that keeps restarting and how it last died
+type PodRestartInfo struct {
+	PodName       string
+	ContainerName string
+	RestartCount  int32
+	ExitCode      int32
+	Reason        string
+}
+
+// LivenessProbeFor returns the liveness probe of the named container in the pod, which is nil if it has none
+func (k *K8sContext) LivenessProbeFor(podName, containerName string) (*corev1.Probe, error) {
+	pod, err := k.findPod(podName)
+	if err != nil {
+		return nil, err
+	}
+	for _, cnt := range pod.Spec.Containers {
+		if cnt.Name == containerName {
+			return cnt.LivenessProbe, nil
+		}
+	}
+	return nil, fmt.Errorf("container '%s' not found in pod '%s'", containerName, podName)
+}
+
+// GetLivenessRestarts returns the containers of running pods that have restarted and have a liveness probe, which
+// may be what's killing them even when the pod never leaves Running
+func (k *K8sContext) GetLivenessRestarts() ([]PodRestartInfo, error) {
+	result := []PodRestartInfo{}
+	for _, pod := range k.pods {
+		if !IsRunning(pod) {
+			continue
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.RestartCount == 0 {
+				continue
+			}
+			probe, err := k.LivenessProbeFor(pod.GetName(), cs.Name)
+			if err != nil {
+				return nil, err
+			}
+			if probe == nil {
+				continue
+			}
+			info := PodRestartInfo{
+				PodName:       pod.GetName(),
+				ContainerName: cs.Name,
+				RestartCount:  cs.RestartCount,
+			}
+			if t := cs.LastTerminationState.Terminated; t != nil {
+				info.ExitCode = t.ExitCode
+				info.Reason = t.Reason
+			}
+			result = append(result, info)
+		}
+	}
 	return result, nil
 }
 
-func (k *K8sContext) GetServices() ([]string, error) {
-	result := []string{}
+// GetCrashLoopingPods returns the containers that are in CrashLoopBackOff or have restarted repeatedly
+func (k *K8sContext) GetCrashLoopingPods() ([]PodRestartInfo, error) {
+	result := []PodRestartInfo{}
+	for _, pod := range k.pods {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if !containerCrashLooping(cs) {
+				continue
+			}
+			info := PodRestartInfo{
+				PodName:       pod.GetName(),
+				ContainerName: cs.Name,
+				RestartCount:  cs.RestartCount,
+			}
+			if t := cs.LastTerminationState.Terminated; t != nil {
+				info.ExitCode = t.ExitCode
+				info.Reason = t.Reason
+			}
+			result = append(result, info)
+		}
+	}
+	return result, nil
+}
+
+// ContainerTermination describes how a container, or its previous instance, terminated
+type ContainerTermination struct {
+	ContainerName string
+	ExitCode      int32
+	Signal        int32
+	Reason        string
+	Message       string
+	// Previous is set when this is the last termination of a container that has since been restarted
+	Previous bool
+}
 
-	svcs, err := k.k8sClient.CoreV1().Services(k.namespace).List(context.TODO(), metav1.ListOptions{})
+// String describes the termination, like "container app exited 1 (Error): panic: nil pointer"
+func (t ContainerTermination) String() string {
+	if t.Reason == "OOMKilled" {
+		return fmt.Sprintf("container %s OOMKilled (%d)", t.ContainerName, t.ExitCode)
+	}
+	result := fmt.Sprintf("container %s exited %d", t.ContainerName, t.ExitCode)
+	if t.Signal != 0 {
+		result += fmt.Sprintf(" on signal %d", t.Signal)
+	}
+	if t.Reason != "" {
+		result += fmt.Sprintf(" (%s)", t.Reason)
+	}
+	if msg := strings.TrimSpace(t.Message); msg != "" {
+		result += ": " + msg
+	}
+	return result
+}
+
+// TerminatedContainers returns how the named pod's containers terminated, both those terminated now and the last
+// termination of those that were restarted
+func (k *K8sContext) TerminatedContainers(podName string) ([]ContainerTermination, error) {
+	result := []ContainerTermination{}
+	pod, err := k.findPod(podName)
 	if err != nil {
 		return result, err
 	}
 
-	for _, s := range svcs.Items {
-		result = append(result, s.GetName())
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Terminated; t != nil {
+			result = append(result, newContainerTermination(cs.Name, t, false))
+		}
+		if t := cs.LastTerminationState.Terminated; t != nil {
+			result = append(result, newContainerTermination(cs.Name, t, true))
+		}
+	}
+	return result, nil
+}
+
+// FailedInitContainers returns the init containers of the named pod that exited unsuccessfully, either now or the
+// last time they ran
+func (k *K8sContext) FailedInitContainers(podName string) ([]ContainerTermination, error) {
+	result := []ContainerTermination{}
+	pod, err := k.findPod(podName)
+	if err != nil {
+		return result, err
+	}
+
+	for _, cs := range pod.Status.InitContainerStatuses {
+		if t := cs.State.Terminated; t != nil {
+			if t.ExitCode != 0 {
+				result = append(result, newContainerTermination(cs.Name, t, false))
+			}
+			continue
+		}
+		if t := cs.LastTerminationState.Terminated; t != nil && t.ExitCode != 0 {
+			result = append(result, newContainerTermination(cs.Name, t, true))
+		}
+	}
+	return result, nil
+}
+
+func newContainerTermination(name string, t *corev1.ContainerStateTerminated, previous bool) ContainerTermination {
+	return ContainerTermination{
+		ContainerName: name,
+		ExitCode:      t.ExitCode,
+		Signal:        t.Signal,
+		Reason:        t.Reason,
+		Message:       t.Message,
+		Previous:      previous,
+	}
+}
+
+// GetPodLogs returns up to the last tailLines lines logged by a container of the named pod, or by its previous
+// instance when previous is set. A container that hasn't been restarted has no previous instance, in which case
+// a message saying so is returned instead of the API error.
+func (k *K8sContext) GetPodLogs(ctx context.Context, podName, containerName string, previous bool, tailLines int64) (string, error) {
+	opts := &corev1.PodLogOptions{
+		Container: containerName,
+		Previous:  previous,
+		TailLines: &tailLines,
+	}
+	var stream io.ReadCloser
+	err := k.retry(ctx, func() (err error) {
+		stream, err = k.k8sClient.CoreV1().Pods(k.namespace).GetLogs(podName, opts).Stream(ctx)
+		return err
+	})
+	if previous && apierrors.IsBadRequest(err) {
+		return fmt.Sprintf("Container '%s' has no previous instance to show logs for yet.", containerName), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	logs, err := io.ReadAll(stream)
+	if err != nil {
+		return "", err
+	}
+	return string(logs), nil
+}
+
+// GetServiceEndpoints returns the ready ip:port addresses backing the named service
+func (k *K8sContext) GetServiceEndpoints(ctx context.Context, svcName string) ([]string, error) {
+	result := []string{}
+	var eps *corev1.Endpoints
+	err := k.retry(ctx, func() (err error) {
+		eps, err = k.k8sClient.CoreV1().Endpoints(k.namespace).Get(ctx, svcName, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return result, err
 	}
 
+	for _, subset := range eps.Subsets {
+		for _, addr := range subset.Addresses {
+			for _, port := range subset.Ports {
+				result = append(result, net.JoinHostPort(addr.IP, strconv.Itoa(int(port.Port))))
+			}
+		}
+	}
 	return result, nil
 }
+
+// PodsMatchingService returns the pods selected by the service's full selector. A service without a selector
+// doesn't select any pods.
+func (k *K8sContext) PodsMatchingService(ctx context.Context, svc corev1.Service) ([]corev1.Pod, error) {
+	if len(svc.Spec.Selector) == 0 {
+		return []corev1.Pod{}, nil
+	}
+
+	return k.listPods(ctx, labels.SelectorFromSet(svc.Spec.Selector).String())
+}
+
+// Controller is the workload (Deployment, StatefulSet, or DaemonSet) managing a set of pods
+type Controller struct {
+	metav1.Object
+	Kind     schema.GroupVersionKind
+	Template corev1.PodTemplateSpec
+	// Selector is how the controller finds its pods
+	Selector *metav1.LabelSelector
+}
+
+// NewController wraps a workload found by FindControllers
+func NewController(obj metav1.Object, kind schema.GroupVersionKind) *Controller {
+	c := &Controller{Object: obj, Kind: kind}
+	switch w := obj.(type) {
+	case *appsv1.Deployment:
+		c.Template = w.Spec.Template
+		c.Selector = w.Spec.Selector
+	case *appsv1.StatefulSet:
+		c.Template = w.Spec.Template
+		c.Selector = w.Spec.Selector
+	case *appsv1.DaemonSet:
+		c.Template = w.Spec.Template
+		c.Selector = w.Spec.Selector
+	}
+	return c
+}
+
+// FindControllers returns every Deployment, StatefulSet, and DaemonSet whose pods are matched by selector. There's
+// more than one when a service sends traffic to several, as with canary and blue-green deployments.
+func (k *K8sContext) FindControllers(ctx context.Context, selector map[string]string) ([]*Controller, error) {
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("can't find a controller without a selector")
+	}
+	matches := func(template corev1.PodTemplateSpec) bool {
+		return labels.SelectorFromSet(selector).Matches(labels.Set(template.Labels))
+	}
+	result := []*Controller{}
+
+	var deployments *appsv1.DeploymentList
+	err := k.retry(ctx, func() (err error) {
+		deployments, err = k.k8sClient.AppsV1().Deployments(k.namespace).List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, d := range deployments.Items {
+		if matches(d.Spec.Template) {
+			result = append(result, NewController(&deployments.Items[i], appsv1.SchemeGroupVersion.WithKind("Deployment")))
+		}
+	}
+
+	var statefulSets *appsv1.StatefulSetList
+	err = k.retry(ctx, func() (err error) {
+		statefulSets, err = k.k8sClient.AppsV1().StatefulSets(k.namespace).List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, ss := range statefulSets.Items {
+		if matches(ss.Spec.Template) {
+			result = append(result, NewController(&statefulSets.Items[i], appsv1.SchemeGroupVersion.WithKind("StatefulSet")))
+		}
+	}
+
+	var daemonSets *appsv1.DaemonSetList
+	err = k.retry(ctx, func() (err error) {
+		daemonSets, err = k.k8sClient.AppsV1().DaemonSets(k.namespace).List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, ds := range daemonSets.Items {
+		if matches(ds.Spec.Template) {
+			result = append(result, NewController(&daemonSets.Items[i], appsv1.SchemeGroupVersion.WithKind("DaemonSet")))
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, &noControllerError{namespace: k.namespace, selector: labels.SelectorFromSet(selector).String()}
+	}
+	return result, nil
+}
+
+// String names the controller as Kind/name
+func (c *Controller) String() string {
+	return c.Kind.Kind + "/" + c.GetName()
+}
+
+// Owns returns if the pod is one of the controller's, by its selector
+func (c *Controller) Owns(pod corev1.Pod) bool {
+	if c.Selector == nil {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(c.Selector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(pod.GetLabels()))
+}
+
+// deployments returns the controllers that are Deployments
+func (k *K8sContext) deployments() []*Controller {
+	result := []*Controller{}
+	for _, c := range k.controllers {
+		if _, ok := c.Object.(*appsv1.Deployment); ok {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// controllerFor returns which of the controllers the pod belongs to, or nil for a pod none of them own
+func controllerFor(pod corev1.Pod, controllers []*Controller) *Controller {
+	for _, c := range controllers {
+		if c.Owns(pod) {
+			return c
+		}
+	}
+	return nil
+}
+
+// noControllerError is returned by FindControllers when no controller's pods match the selector
+type noControllerError struct {
+	namespace string
+	selector  string
+}
+
+func (e *noControllerError) Error() string {
+	return fmt.Sprintf("no Deployment, StatefulSet, or DaemonSet in namespace '%s' has pods matching '%s'", e.namespace, e.selector)
+}
+
+// RolloutStatus is how far along a Deployment is in rolling out its latest template
+type RolloutStatus struct {
+	Replicas  int32
+	Updated   int32
+	Ready     int32
+	Available int32
+
+	// Complete is set once every replica is updated and available
+	Complete bool
+	// Failed is set when the rollout has stopped making progress, with the condition's reason and message
+	Failed  bool
+	Reason  string
+	Message string
+}
+
+// String describes the rollout the way 'kubectl rollout status' would
+func (r RolloutStatus) String() string {
+	switch {
+	case r.Failed:
+		return fmt.Sprintf("rollout failed: %s", r.Reason)
+	case r.Complete:
+		return fmt.Sprintf("%d/%d replicas updated, rollout complete", r.Updated, r.Replicas)
+	case r.Message != "":
+		return r.Message
+	}
+	return fmt.Sprintf("%d/%d replicas updated, rollout in progress", r.Updated, r.Replicas)
+}
+
+// DeploymentRolloutStatus returns the rollout status of the named Deployment
+func (k *K8sContext) DeploymentRolloutStatus(ctx context.Context, name string) (RolloutStatus, error) {
+	d, err := k.GetDeployment(ctx, name)
+	if err != nil {
+		return RolloutStatus{}, err
+	}
+	return rolloutStatus(d), nil
+}
+
+// rolloutStatus classifies a Deployment's rollout from its status, following the checks 'kubectl rollout status' makes
+func rolloutStatus(d *appsv1.Deployment) RolloutStatus {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	r := RolloutStatus{
+		Replicas:  replicas,
+		Updated:   d.Status.UpdatedReplicas,
+		Ready:     d.Status.ReadyReplicas,
+		Available: d.Status.AvailableReplicas,
+	}
+
+	if d.Generation > d.Status.ObservedGeneration {
+		r.Message = "waiting for the rollout to be observed"
+		return r
+	}
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+			r.Failed = true
+			r.Reason = c.Reason
+			r.Message = c.Message
+			return r
+		}
+	}
+
+	switch {
+	case r.Updated < r.Replicas:
+		// the default message covers this
+	case d.Status.Replicas > r.Updated:
+		r.Message = fmt.Sprintf("%d old replicas are pending termination", d.Status.Replicas-r.Updated)
+	case r.Available < r.Updated:
+		r.Message = fmt.Sprintf("%d of %d updated replicas are available", r.Available, r.Updated)
+	default:
+		r.Complete = true
+	}
+	return r
+}
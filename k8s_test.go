@@ -0,0 +1,849 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestGetPodEvents(t *testing.T) {
+	now := time.Now()
+	client := fake.NewSimpleClientset(
+		testEvent("web-1", "Scheduled", "assigned to node-1", now.Add(-time.Minute)),
+		testEvent("web-1", "FailedScheduling", "0/3 nodes are available", now),
+	)
+	var selector string
+	client.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selector = action.(k8stesting.ListAction).GetListRestrictions().Fields.String()
+		return false, nil, nil
+	})
+	k := NewK8sContextWithClient(client, testNamespace)
+
+	evts, err := k.GetPodEvents(context.Background(), "web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "involvedObject.kind=Pod,involvedObject.name=web-1"; selector != want {
+		t.Errorf("listed events with field selector %q, want %q", selector, want)
+	}
+	if len(evts) != 2 || evts[0].Reason != "FailedScheduling" {
+		t.Errorf("GetPodEvents = %v, want the FailedScheduling event first", evts)
+	}
+}
+
+// waiting makes the status of a container waiting for the reason
+func waiting(name, reason, message string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message}}}
+}
+
+// listed makes a K8sContext of a fake cluster holding the pods, with them already listed
+func listed(t *testing.T, pods ...*corev1.Pod) *K8sContext {
+	t.Helper()
+	objs := []runtime.Object{}
+	for _, p := range pods {
+		objs = append(objs, p)
+	}
+	k := NewK8sContextWithClient(fakeClient(objs...), testNamespace)
+	if _, err := k.GetPods(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestGetContainerWaitReasons(t *testing.T) {
+	pod := testPod("web-1", corev1.PodPending)
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		waiting("app", "ImagePullBackOff", `Back-off pulling image "web:nope"`),
+		waiting("sidecar", "CreateContainerConfigError", `secret "db" not found`),
+		{Name: "proxy", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+	}
+	k := listed(t, pod)
+
+	reasons, err := k.GetContainerWaitReasons("web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]WaitReason{
+		"app":     {"ImagePullBackOff", `Back-off pulling image "web:nope"`},
+		"sidecar": {"CreateContainerConfigError", `secret "db" not found`},
+	}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("GetContainerWaitReasons = %v, want %v", reasons, want)
+	}
+	if _, err := k.GetContainerWaitReasons("web-2"); err == nil {
+		t.Error("GetContainerWaitReasons of a pod that wasn't listed succeeded")
+	}
+}
+
+// httpProbe makes a probe that GETs the path on the named or numbered port
+func httpProbe(path string, port intstr.IntOrString) *corev1.Probe {
+	return &corev1.Probe{Handler: corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: path, Port: port, Scheme: corev1.URISchemeHTTP}}}
+}
+
+func TestDescribeProbe(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe *corev1.Probe
+		want  string
+	}{
+		{"none", nil, "no probe configured"},
+		{"http", httpProbe("/healthz", intstr.FromInt(8080)), "HTTP GET http:8080/healthz"},
+		{"named port", httpProbe("/ready", intstr.FromString("http")), "HTTP GET http:http/ready"},
+		{"exec", &corev1.Probe{Handler: corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"cat", "/tmp/ready"}}}}, "exec cat /tmp/ready"},
+		{"tcp", &corev1.Probe{Handler: corev1.Handler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(5432)}}}, "TCP port 5432"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeProbe(tt.probe); got != tt.want {
+				t.Errorf("describeProbe = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadinessProbeFor(t *testing.T) {
+	pod := testPod("web-1", corev1.PodRunning)
+	pod.Spec.Containers = []corev1.Container{{Name: "app", ReadinessProbe: httpProbe("/old", intstr.FromInt(8080))}}
+	k := listed(t, pod)
+
+	probe, err := k.ReadinessProbeFor("app")
+	if err != nil || describeProbe(probe) != "HTTP GET http:8080/old" {
+		t.Errorf("ReadinessProbeFor without a controller = %s, %v, want the pod's probe", describeProbe(probe), err)
+	}
+
+	// the template is what the pods are being rolled out to
+	d := &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "app", ReadinessProbe: httpProbe("/new", intstr.FromInt(8080))}},
+	}}}}
+	k.controller = NewController(d, appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	probe, err = k.ReadinessProbeFor("app")
+	if err != nil || describeProbe(probe) != "HTTP GET http:8080/new" {
+		t.Errorf("ReadinessProbeFor with a controller = %s, %v, want the template's probe", describeProbe(probe), err)
+	}
+
+	if _, err := k.ReadinessProbeFor("nope"); err == nil {
+		t.Error("ReadinessProbeFor of a missing container succeeded")
+	}
+}
+
+// restarted makes the status of a container that restarted, last terminating with the exit code and reason
+func restarted(name string, restarts, exitCode int32, reason string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:                 name,
+		RestartCount:         restarts,
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Reason: reason}},
+	}
+}
+
+func TestGetCrashLoopingPods(t *testing.T) {
+	oom := testPod("web-1", corev1.PodRunning)
+	oom.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", 14, 137, "OOMKilled")}
+	backingOff := testPod("web-2", corev1.PodRunning)
+	backingOff.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", 1, 1, "Error")}
+	backingOff.Status.ContainerStatuses[0].State.Waiting = &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}
+	healthy := testPod("web-3", corev1.PodRunning)
+	healthy.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", crashLoopRestarts-1, 0, "Completed")}
+	k := listed(t, oom, backingOff, healthy)
+
+	crashing, err := k.GetCrashLoopingPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PodRestartInfo{
+		{PodName: "web-1", ContainerName: "app", RestartCount: 14, ExitCode: 137, Reason: "OOMKilled"},
+		{PodName: "web-2", ContainerName: "app", RestartCount: 1, ExitCode: 1, Reason: "Error"},
+	}
+	if !reflect.DeepEqual(crashing, want) {
+		t.Errorf("GetCrashLoopingPods = %+v, want %+v", crashing, want)
+	}
+}
+
+func TestLivenessProbeFor(t *testing.T) {
+	pod := testPod("web-1", corev1.PodRunning)
+	live := httpProbe("/healthz", intstr.FromInt(8080))
+	pod.Spec.Containers = []corev1.Container{{Name: "app", LivenessProbe: live}, {Name: "sidecar"}}
+	k := listed(t, pod)
+
+	if probe, err := k.LivenessProbeFor("web-1", "app"); err != nil || !reflect.DeepEqual(probe, live) {
+		t.Errorf("LivenessProbeFor(app) = %v, %v; want its probe", probe, err)
+	}
+	if probe, err := k.LivenessProbeFor("web-1", "sidecar"); err != nil || probe != nil {
+		t.Errorf("LivenessProbeFor(sidecar) = %v, %v; want none", probe, err)
+	}
+	if _, err := k.LivenessProbeFor("web-1", "db"); err == nil {
+		t.Errorf("LivenessProbeFor of a container the pod doesn't have succeeded")
+	}
+}
+
+func TestGetLivenessRestarts(t *testing.T) {
+	live := httpProbe("/healthz", intstr.FromInt(8080))
+	killed := testPod("web-1", corev1.PodRunning)
+	killed.Spec.Containers = []corev1.Container{{Name: "app", LivenessProbe: live}, {Name: "sidecar", LivenessProbe: live}}
+	killed.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", 3, 137, "Error"), {Name: "sidecar"}}
+	// restarts without a liveness probe are the crash-loop check's business
+	unprobed := testPod("web-2", corev1.PodRunning)
+	unprobed.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", 3, 1, "Error")}
+	// and a pod that's left Running says why it stopped by its phase
+	failed := testPod("web-3", corev1.PodFailed)
+	failed.Spec.Containers = killed.Spec.Containers[:1]
+	failed.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", 3, 137, "Error")}
+	k := listed(t, killed, unprobed, failed)
+
+	got, err := k.GetLivenessRestarts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PodRestartInfo{{PodName: "web-1", ContainerName: "app", RestartCount: 3, ExitCode: 137, Reason: "Error"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetLivenessRestarts = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetPodLogs(t *testing.T) {
+	client := &testClient{Clientset: fakeClient(), logs: map[string]string{
+		"web-1/app":          "listening on :8080\n",
+		"web-1/app/previous": "panic: nil pointer dereference\n",
+	}}
+	k := NewK8sContextWithClient(client, testNamespace)
+	ctx := context.Background()
+
+	logs, err := k.GetPodLogs(ctx, "web-1", "app", true, 20)
+	if err != nil || logs != "panic: nil pointer dereference\n" {
+		t.Errorf("GetPodLogs of the previous instance = %q, %v", logs, err)
+	}
+	actions := client.Actions()
+	opts := actions[len(actions)-1].(k8stesting.GenericAction).GetValue().(*corev1.PodLogOptions)
+	if opts.Container != "app" || !opts.Previous || opts.TailLines == nil || *opts.TailLines != 20 {
+		t.Errorf("asked for logs with %+v, want the last 20 lines of app's previous instance", opts)
+	}
+
+	logs, err = k.GetPodLogs(ctx, "web-1", "app", false, 20)
+	if err != nil || logs != "listening on :8080\n" {
+		t.Errorf("GetPodLogs of the current instance = %q, %v", logs, err)
+	}
+
+	// a container that hasn't restarted has no previous logs, which is worth saying rather than failing on
+	logs, err = k.GetPodLogs(ctx, "web-2", "app", true, 20)
+	if err != nil || !strings.Contains(logs, "no previous instance") {
+		t.Errorf("GetPodLogs of a missing previous instance = %q, %v, want a message saying so", logs, err)
+	}
+}
+
+func TestPodsMatchingService(t *testing.T) {
+	frontend := testPod("web-1", corev1.PodRunning)
+	frontend.Labels["tier"] = "frontend"
+	k := listed(t, frontend, testPod("web-2", corev1.PodRunning))
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		selector map[string]string
+		want     []string
+	}{
+		{"one key", map[string]string{"app": "web"}, []string{"web-1", "web-2"}},
+		{"every key", map[string]string{"app": "web", "tier": "frontend"}, []string{"web-1"}},
+		{"a key no pod has", map[string]string{"app": "web", "tier": "backend"}, []string{}},
+		{"no selector", nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := *testService()
+			svc.Spec.Selector = tt.selector
+			pods, err := k.PodsMatchingService(ctx, svc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := podNames(pods, func(corev1.Pod) bool { return true }); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PodsMatchingService = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindControllers(t *testing.T) {
+	template := testTemplate()
+	selector := &metav1.LabelSelector{MatchLabels: template.Labels}
+	tests := []struct {
+		kind string
+		obj  runtime.Object
+	}{
+		{"Deployment", testDeployment("web", 1)},
+		{"StatefulSet", &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: testNamespace},
+			Spec:       appsv1.StatefulSetSpec{Selector: selector, Template: template},
+		}},
+		{"DaemonSet", &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: testNamespace},
+			Spec:       appsv1.DaemonSetSpec{Selector: selector, Template: template},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			k := NewK8sContextWithClient(fakeClient(tt.obj), testNamespace)
+			controllers, err := k.FindControllers(context.Background(), map[string]string{"app": "web"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(controllers) != 1 || controllers[0].String() != tt.kind+"/web" {
+				t.Fatalf("FindControllers = %v, want %s/web", controllers, tt.kind)
+			}
+			// the template is read the same way whatever the kind
+			if p, ok := (&Kubetrbl{k8sContext: &K8sContext{controller: controllers[0]}}).containerPortFor(intstr.FromString("http")); !ok || p.ContainerPort != 8080 {
+				t.Errorf("the %s's template has no http port", tt.kind)
+			}
+
+			_, err = k.FindControllers(context.Background(), map[string]string{"app": "api"})
+			var nerr *noControllerError
+			if !errors.As(err, &nerr) {
+				t.Errorf("FindControllers of a selector nothing matches = %v, want a *noControllerError", err)
+			}
+		})
+	}
+}
+
+func TestPodGetters(t *testing.T) {
+	ready := testPod("ready", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	unready := testPod("unready", corev1.PodRunning)
+	unready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}}
+	pending := testPod("pending", corev1.PodPending)
+	failed := testPod("failed", corev1.PodFailed)
+	failed.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}}
+	// malformed pods can report their Ready condition twice
+	duplicated := withConditions(testPod("duplicated", corev1.PodRunning), corev1.ConditionFalse, corev1.ConditionFalse)
+	k := NewK8sContextWithClient(fake.NewSimpleClientset(ready, unready, pending, failed, duplicated), testNamespace)
+	if _, err := k.GetPods(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		get  func() ([]string, error)
+		want []string
+	}{
+		{"pending", k.GetPendingPods, []string{"pending"}},
+		{"not running", k.GetNonrunningPods, []string{"pending", "failed"}},
+		// a pod yet to report its Ready condition is pending rather than not ready
+		{"not ready", k.GetNotReadyPods, []string{"unready", "failed", "duplicated"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPodsBySelector(t *testing.T) {
+	api := testPod("api-1", corev1.PodRunning)
+	api.Labels = map[string]string{"app": "api"}
+	elsewhere := testPod("web-2", corev1.PodRunning)
+	elsewhere.Namespace = "other"
+	client := fakeClient(testPod("web-1", corev1.PodRunning), api, elsewhere)
+	var selector string
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selector = action.(k8stesting.ListAction).GetListRestrictions().Labels.String()
+		return false, nil, nil
+	})
+	k := NewK8sContextWithClient(client, testNamespace)
+
+	pods, err := k.GetPodsBySelector(context.Background(), "app=web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selector != "app=web" {
+		t.Errorf("listed pods with label selector %q, want app=web", selector)
+	}
+	if len(pods) != 1 || pods[0].Name != "web-1" {
+		t.Errorf("GetPodsBySelector = %v, want only web-1", pods)
+	}
+	if len(k.pods) != 1 {
+		t.Errorf("GetPodsBySelector kept %d pods to diagnose, want 1", len(k.pods))
+	}
+
+	all, err := k.GetPods(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("GetPods = %v, want both of the namespace's pods", all)
+	}
+}
+
+func TestGetPod(t *testing.T) {
+	k := NewK8sContextWithClient(fakeClient(testPod("web-1", corev1.PodRunning)), testNamespace)
+
+	pod, err := k.GetPod(context.Background(), "web-1")
+	if err != nil || pod.Name != "web-1" {
+		t.Errorf("GetPod(web-1) = %v, %v; want web-1", pod, err)
+	}
+	_, err = k.GetPod(context.Background(), "web-9")
+	if err == nil || err.Error() != "pod 'web-9' not found in namespace 'default'" {
+		t.Errorf("GetPod(web-9) = %v, want it not found", err)
+	}
+}
+
+func TestGetService(t *testing.T) {
+	elsewhere := testService()
+	elsewhere.Name, elsewhere.Namespace = "api", "other"
+	k := NewK8sContextWithClient(fakeClient(testService(), elsewhere), testNamespace)
+
+	svc, err := k.GetService(context.Background(), "web")
+	if err != nil || svc.Name != "web" {
+		t.Errorf("GetService(web) = %v, %v; want web", svc, err)
+	}
+	// a service in another namespace isn't this one's
+	_, err = k.GetService(context.Background(), "api")
+	if err == nil || err.Error() != "service 'api' not found in namespace 'default'" {
+		t.Errorf("GetService(api) = %v, want it not found", err)
+	}
+}
+
+func TestServicePortByName(t *testing.T) {
+	svc := testService()
+	svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Name: "metrics", Port: 9090, TargetPort: intstr.FromInt(9090)})
+	tests := []struct {
+		port string
+		want string
+		err  string
+	}{
+		{"http", "http", ""},
+		{"metrics", "metrics", ""},
+		// a number is the service's port, not its target port
+		{"9090", "metrics", ""},
+		{"80", "http", ""},
+		{"8080", "", "service 'web' has no port '8080'; it has http (80), metrics (9090)"},
+		{"grpc", "", "service 'web' has no port 'grpc'; it has http (80), metrics (9090)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.port, func(t *testing.T) {
+			p, err := ServicePortByName(*svc, tt.port)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("ServicePortByName = %+v, %v; want error %q", p, err, tt.err)
+				}
+				return
+			}
+			if err != nil || p.Name != tt.want {
+				t.Errorf("ServicePortByName = %+v, %v; want %s", p, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllPods(t *testing.T) {
+	elsewhere := testPod("api-1", corev1.PodPending)
+	elsewhere.Namespace = "other"
+	k := NewK8sContextWithClient(fakeClient(testPod("web-1", corev1.PodRunning), elsewhere, testPod("web-2", corev1.PodRunning)), testNamespace)
+
+	pods, err := k.GetAllPods(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, p := range pods {
+		got = append(got, p.Namespace+"/"+p.Name)
+	}
+	if want := []string{"default/web-1", "other/api-1", "default/web-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAllPods = %v, want %v", got, want)
+	}
+	// the cluster's pods aren't the namespace's to diagnose
+	if len(k.pods) != 0 {
+		t.Errorf("GetAllPods kept %d pods to diagnose, want none", len(k.pods))
+	}
+}
+
+// claim makes a persistent volume claim in the phase, asking for the storage class unless it's empty
+func claim(name string, phase corev1.PersistentVolumeClaimPhase, class string) *corev1.PersistentVolumeClaim {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: phase},
+	}
+	if class != "" {
+		pvc.Spec.StorageClassName = &class
+	}
+	return pvc
+}
+
+func TestGetUnboundPVCs(t *testing.T) {
+	tests := []struct {
+		name   string
+		volume bool
+		claim  *corev1.PersistentVolumeClaim
+		want   []string
+	}{
+		{"no volumes", false, nil, []string{}},
+		{"bound", true, claim("data", corev1.ClaimBound, "standard"), []string{}},
+		{"missing", true, nil, []string{"claim 'data' does not exist"}},
+		{"no storage class", true, claim("data", corev1.ClaimPending, ""), []string{"claim 'data' is Pending and requests no storage class; is there a default StorageClass?"}},
+		{"missing storage class", true, claim("data", corev1.ClaimPending, "fast"), []string{"claim 'data' is Pending and requests storage class 'fast', which does not exist"}},
+		{"unbound", true, claim("data", corev1.ClaimPending, "standard"), []string{"claim 'data' is Pending with storage class 'standard'"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod("web-1", corev1.PodPending)
+			if tt.volume {
+				pod.Spec.Volumes = []corev1.Volume{
+					{Name: "config", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+					{Name: "data", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+				}
+			}
+			objs := []runtime.Object{&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "standard"}}}
+			if tt.claim != nil {
+				objs = append(objs, tt.claim)
+			}
+			k := NewK8sContextWithClient(fakeClient(objs...), testNamespace)
+
+			got, err := k.GetUnboundPVCs(context.Background(), *pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetUnboundPVCs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRolloutStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(*appsv1.Deployment)
+		complete bool
+		failed   bool
+		want     string
+	}{
+		{"complete", func(*appsv1.Deployment) {}, true, false, "5/5 replicas updated, rollout complete"},
+		{"in progress", func(d *appsv1.Deployment) {
+			d.Status.UpdatedReplicas = 3
+		}, false, false, "3/5 replicas updated, rollout in progress"},
+		{"unobserved", func(d *appsv1.Deployment) {
+			d.Generation = 2
+		}, false, false, "waiting for the rollout to be observed"},
+		{"old replicas", func(d *appsv1.Deployment) {
+			d.Status.Replicas = 7
+		}, false, false, "2 old replicas are pending termination"},
+		{"unavailable", func(d *appsv1.Deployment) {
+			d.Status.AvailableReplicas = 4
+		}, false, false, "4 of 5 updated replicas are available"},
+		{"deadline exceeded", func(d *appsv1.Deployment) {
+			d.Status.UpdatedReplicas = 3
+			d.Status.Conditions = []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionFalse, Reason: "MinimumReplicasUnavailable"},
+				{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded", Message: `ReplicaSet "web-7d4b9" has timed out progressing.`},
+			}
+		}, false, true, "rollout failed: ProgressDeadlineExceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDeployment("web", 5)
+			tt.change(d)
+			k := NewK8sContextWithClient(fakeClient(d), testNamespace)
+
+			r, err := k.DeploymentRolloutStatus(context.Background(), "web")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Complete != tt.complete || r.Failed != tt.failed || r.String() != tt.want {
+				t.Errorf("rollout is %q (complete %v, failed %v), want %q (complete %v, failed %v)", r, r.Complete, r.Failed, tt.want, tt.complete, tt.failed)
+			}
+		})
+	}
+}
+
+func TestTerminatedContainers(t *testing.T) {
+	pod := testPod("web-1", corev1.PodFailed)
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "app", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", Message: "panic: nil pointer\n"}}},
+		restarted("sidecar", 3, 137, "OOMKilled"),
+		{Name: "proxy", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 143, Signal: 15}}},
+		{Name: "idle", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+	}
+	k := listed(t, pod)
+
+	terminations, err := k.TerminatedContainers("web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, term := range terminations {
+		got = append(got, term.String())
+	}
+	want := []string{
+		"container app exited 1 (Error): panic: nil pointer",
+		"container sidecar OOMKilled (137)",
+		"container proxy exited 143 on signal 15",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TerminatedContainers = %q, want %q", got, want)
+	}
+	if terminations[0].Previous || !terminations[1].Previous {
+		t.Errorf("TerminatedContainers = %+v, want only the sidecar's to be a previous instance's", terminations)
+	}
+}
+
+func TestMissingConfigReferences(t *testing.T) {
+	optional := true
+	pod := testPod("web-1", corev1.PodPending)
+	pod.Spec.InitContainers = []corev1.Container{{
+		Name:    "migrate",
+		EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "db-creds"}}}},
+	}}
+	pod.Spec.Containers[0].EnvFrom = []corev1.EnvFromSource{
+		{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}},
+		{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "overrides"}, Optional: &optional}},
+	}
+	pod.Spec.Containers[0].Env = []corev1.EnvVar{
+		{Name: "PLAIN", Value: "set"},
+		{Name: "FLAGS", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "flags"}, Key: "all"}}},
+		{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "api-token"}, Key: "token"}}},
+		{Name: "DB", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "db-creds"}, Key: "url"}}},
+	}
+	pod.Spec.Volumes = []corev1.Volume{
+		{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "nginx-conf"}}}},
+		{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "tls"}}},
+		{Name: "extra", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "extra", Optional: &optional}}},
+	}
+	k := NewK8sContextWithClient(fakeClient(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: testNamespace}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "flags", Namespace: testNamespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "api-token", Namespace: testNamespace}},
+		// the same name in another namespace doesn't count
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "other"}},
+	), testNamespace)
+
+	missing, err := k.MissingConfigReferences(context.Background(), *pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// optional references are left out even though they're missing too
+	want := []string{"ConfigMap 'nginx-conf'", "Secret 'db-creds'", "Secret 'tls'"}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("MissingConfigReferences = %q, want %q", missing, want)
+	}
+}
+
+func TestGetNamespace(t *testing.T) {
+	k := NewK8sContextWithClient(fakeClient(testNamespaceObject()), "")
+
+	ns, err := k.GetNamespace(context.Background(), testNamespace)
+	if err != nil || ns == nil || ns.Name != testNamespace {
+		t.Errorf("GetNamespace(%s) = %v, %v; want the namespace", testNamespace, ns, err)
+	}
+	ns, err = k.GetNamespace(context.Background(), "nope")
+	if err != nil || ns != nil {
+		t.Errorf("GetNamespace(nope) = %v, %v; want nil without an error", ns, err)
+	}
+}
+
+func TestNamespaceExists(t *testing.T) {
+	k := NewK8sContextWithClient(fakeClient(testNamespaceObject()), "")
+
+	if ok, err := k.NamespaceExists(context.Background(), testNamespace); err != nil || !ok {
+		t.Errorf("NamespaceExists(%s) = %v, %v; want true", testNamespace, ok, err)
+	}
+	if ok, err := k.NamespaceExists(context.Background(), "nope"); err != nil || ok {
+		t.Errorf("NamespaceExists(nope) = %v, %v; want false without an error", ok, err)
+	}
+}
+
+func TestFormatConditions(t *testing.T) {
+	pod := testPod("web-1", corev1.PodRunning)
+	pod.Spec.ReadinessGates = []corev1.PodReadinessGate{{ConditionType: "example.com/lb-registered"}, {ConditionType: "example.com/warmed-up"}}
+	pod.Status.Conditions = []corev1.PodCondition{
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+		{Type: corev1.PodInitialized, Status: corev1.ConditionTrue},
+		{Type: corev1.ContainersReady, Status: corev1.ConditionFalse, Reason: "ContainersNotReady", Message: "containers with unready status: [app]"},
+		{Type: corev1.PodReady, Status: corev1.ConditionFalse, Reason: "ReadinessGatesNotReady"},
+		{Type: "example.com/lb-registered", Status: corev1.ConditionUnknown},
+	}
+	k := listed(t, pod)
+
+	conds, err := k.GetPodConditions("web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ContainersReady is False (ContainersNotReady): containers with unready status: [app]",
+		"Ready is False (ReadinessGatesNotReady)",
+		"readiness gate example.com/lb-registered is Unknown",
+		"readiness gate example.com/warmed-up hasn't been reported",
+	}
+	if got := formatConditions(conds, pod.Spec.ReadinessGates); !reflect.DeepEqual(got, want) {
+		t.Errorf("formatConditions = %q, want %q", got, want)
+	}
+	if !conditionFalse(conds, corev1.ContainersReady) || conditionFalse(conds, corev1.PodScheduled) || conditionFalse(conds, corev1.PodReasonUnschedulable) {
+		t.Errorf("conditionFalse doesn't match the conditions %+v", conds)
+	}
+
+	if _, err := k.GetPodConditions("web-2"); err == nil {
+		t.Errorf("GetPodConditions of a pod that wasn't listed succeeded")
+	}
+}
+
+func TestCheckReachable(t *testing.T) {
+	refused := syscall.ECONNREFUSED
+	k := NewK8sContextWithClient(&testClient{Clientset: fakeClient(), unreachable: refused}, testNamespace)
+	k.config = &rest.Config{Host: "https://10.0.0.1:6443"}
+
+	_, err := k.CheckReachable(context.Background())
+	if err == nil || err.Error() != "cannot reach cluster at https://10.0.0.1:6443: connection refused" || !errors.Is(err, refused) {
+		t.Errorf("CheckReachable = %v, want the host and why it can't be reached", err)
+	}
+
+	k = NewK8sContextWithClient(fakeClient(), testNamespace)
+	if _, err := k.CheckReachable(context.Background()); err != nil {
+		t.Errorf("CheckReachable of a cluster that answers = %v", err)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	client := fakeClient()
+	client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{Major: "1", Minor: "29", GitVersion: "v1.29.3"}
+	k := NewK8sContextWithClient(client, testNamespace)
+
+	if got, err := k.ServerVersion(); err != nil || got != "v1.29.3" {
+		t.Errorf("ServerVersion = %q, %v; want v1.29.3", got, err)
+	}
+	// the version comes back from checking the cluster can be reached, too
+	if got, err := k.CheckReachable(context.Background()); err != nil || got != "v1.29.3" {
+		t.Errorf("CheckReachable = %q, %v; want v1.29.3", got, err)
+	}
+}
+
+func TestVersionSkew(t *testing.T) {
+	tests := []struct {
+		version string
+		skew    int
+		ok      bool
+	}{
+		{"v1.18.3", 0, true},
+		{"v1.29.3", 11, true},
+		{"v1.16.15", -2, true},
+		// hosted clusters add their own suffixes
+		{"v1.19.16-eks-25803e", 1, true},
+		{"v1.27.8+k3s2", 9, true},
+		{"v2.0.0", 0, false},
+		{"unknown", 0, false},
+	}
+	for _, tt := range tests {
+		if skew, ok := versionSkew(tt.version); skew != tt.skew || ok != tt.ok {
+			t.Errorf("versionSkew(%s) = %d, %v; want %d, %v", tt.version, skew, ok, tt.skew, tt.ok)
+		}
+	}
+}
+
+func TestGetNamespaceObjects(t *testing.T) {
+	k := NewK8sContextWithClient(fakeClient(testNamespaceObject(), terminatingNamespace()), "")
+
+	nms, err := k.GetNamespaceObjects(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	phases := map[string]corev1.NamespacePhase{}
+	for _, ns := range nms {
+		phases[ns.Name] = ns.Status.Phase
+	}
+	want := map[string]corev1.NamespacePhase{testNamespace: corev1.NamespaceActive, "old": corev1.NamespaceTerminating}
+	if !reflect.DeepEqual(phases, want) {
+		t.Errorf("GetNamespaceObjects has phases %v, want %v", phases, want)
+	}
+	if terminating(nms[0]) == terminating(nms[1]) {
+		t.Errorf("terminating doesn't tell the namespaces apart: %+v", nms)
+	}
+}
+
+// setenv sets the environment variable for the rest of the test, as t.Setenv does from Go 1.17
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	prev, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestDefaultKubeConfigPath(t *testing.T) {
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home")
+	setenv(t, "HOME", home)
+	// go-homedir caches the home it first finds, which wouldn't be this one
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	if err := ioutil.WriteFile(kubeconfig, []byte("apiVersion: v1\nkind: Config\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first of $KUBECONFIG's files that exists
+	setenv(t, "KUBECONFIG", filepath.Join(dir, "missing")+string(os.PathListSeparator)+kubeconfig)
+	if got := defaultKubeConfigPath(); got != kubeconfig {
+		t.Errorf("defaultKubeConfigPath = %q with $KUBECONFIG, want %q", got, kubeconfig)
+	}
+
+	setenv(t, "KUBECONFIG", "")
+	if got := defaultKubeConfigPath(); got != "" {
+		t.Errorf("defaultKubeConfigPath = %q without a kubeconfig, want none", got)
+	}
+	home = filepath.Join(home, ".kube", "config")
+	if err := os.MkdirAll(filepath.Dir(home), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(home, []byte("apiVersion: v1\nkind: Config\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := defaultKubeConfigPath(); got != home {
+		t.Errorf("defaultKubeConfigPath = %q, want ~/.kube/config %q", got, home)
+	}
+}
+
+func TestGetPodsCancelled(t *testing.T) {
+	k := NewK8sContextWithClient(&testClient{Clientset: fakeClient(testPod("web-1", corev1.PodRunning)), hangPods: true}, testNamespace)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	listed := make(chan error, 1)
+	go func() {
+		_, err := k.GetPods(ctx)
+		listed <- err
+	}()
+	select {
+	case err := <-listed:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("GetPods = %v once cancelled, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetPods hung once its context was cancelled")
+	}
+}
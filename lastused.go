@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// LastUsed is where the previous run connected to, offered as the default answers next time
+type LastUsed struct {
+	KubeConfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+// defaultLastUsedPath returns where LastUsed is kept, under the user's config directory, or "" if there's no such
+// directory
+func defaultLastUsedPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "kubetrbl", "last.json")
+}
+
+// loadLastUsed reads LastUsed from path. A file that's missing or can't be read as LastUsed is treated as empty,
+// since it only saves some typing.
+func loadLastUsed(path string) LastUsed {
+	var last LastUsed
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return LastUsed{}
+	}
+	if err := json.Unmarshal(data, &last); err != nil {
+		return LastUsed{}
+	}
+	return last
+}
+
+// save writes LastUsed to path, creating its directory if need be
+func (l LastUsed) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestLastUsedRoundTrip(t *testing.T) {
+	// the directory is made if need be
+	path := filepath.Join(t.TempDir(), "kubetrbl", "last.json")
+	last := LastUsed{KubeConfig: "/home/jane/.kube/config", Context: "prod-cluster", Namespace: "payments"}
+
+	if err := last.save(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadLastUsed(path); got != last {
+		t.Errorf("loadLastUsed = %+v, want %+v", got, last)
+	}
+	if got := last.label(); got != "[last: prod-cluster/payments]" {
+		t.Errorf("label = %q", got)
+	}
+
+	if got := loadLastUsed(filepath.Join(t.TempDir(), "missing.json")); got != (LastUsed{}) {
+		t.Errorf("loadLastUsed of a missing file = %+v, want nothing", got)
+	}
+	corrupt := filepath.Join(t.TempDir(), "last.json")
+	if err := ioutil.WriteFile(corrupt, []byte(`{"namespace": "payments"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadLastUsed(corrupt); got != (LastUsed{}) {
+		t.Errorf("loadLastUsed of a corrupt file = %+v, want nothing", got)
+	}
+}
+
+func TestRememberLastUsed(t *testing.T) {
+	payments := testNamespaceObject()
+	payments.Name = "payments"
+	path := filepath.Join(t.TempDir(), "last.json")
+	if err := (LastUsed{Namespace: "payments"}).save(path); err != nil {
+		t.Fatal(err)
+	}
+	run := func(input string) string {
+		var out bytes.Buffer
+		k := NewKubetrblIO(context.Background(), Config{}, strings.NewReader(input), &out)
+		k.k8sContext = NewK8sContextWithClient(fakeClient(testNamespaceObject(), payments, testPod("web-1", corev1.PodRunning)), "")
+		k.RememberLastUsed(path)
+		k.Start("getNamespace")
+		return out.String()
+	}
+
+	// enter accepts the namespace used last
+	out := run("\nq\n")
+	if !strings.Contains(out, "Kubernetes namespace (enter for [last: /payments])? ") || !strings.Contains(out, "Troubleshot namespace 'payments'") {
+		t.Errorf("didn't offer the last namespace as the default:\n%s", out)
+	}
+
+	// picking another is remembered for next time
+	out = run("default\nq\n")
+	if !strings.Contains(out, "Troubleshot namespace 'default'") {
+		t.Fatalf("didn't troubleshoot the namespace picked:\n%s", out)
+	}
+	if got := loadLastUsed(path); got.Namespace != "default" {
+		t.Errorf("remembered %+v, want namespace default", got)
+	}
+	// quitting before picking one leaves it be
+	if out := run("q\n"); !strings.Contains(out, "Kubernetes namespace (enter for [last: /default])? ") {
+		t.Errorf("didn't offer the namespace picked last time:\n%s", out)
+	}
+	if got := loadLastUsed(path); got.Namespace != "default" {
+		t.Errorf("quitting remembered %+v, want namespace default still", got)
+	}
+}
@@ -3,345 +3,2921 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/caseyhadden/kubetrbl/fsm"
+	"github.com/caseyhadden/kubetrbl/report"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/portforward"
 	"k8s.io/client-go/transport/spdy"
+	"sigs.k8s.io/yaml"
 )
 
 type Kubetrbl struct {
-	fsm        *fsm.FSM
-	reader     *bufio.Reader
+	ctx    context.Context
+	fsm    *fsm.FSM
+	reader *bufio.Reader
+	// lines are read from reader in the background, by a single goroutine started with the first prompt
+	lines      chan inputLine
+	readLines  sync.Once
+	out        io.Writer
+	config     Config
 	k8sContext *K8sContext
+	// debug prints the Kubernetes objects each step works from
+	debug bool
+	theme report.Theme
 
-	svc           corev1.Service
-	svcPort       corev1.ServicePort
-	controller    *appsv1.Deployment
-	containerPort corev1.ContainerPort
-	podList       []corev1.Pod
-	podPort       corev1.ContainerPort
-	pods          *corev1.PodList
+	// what we found out about the deployment lives in k8sContext; these are how we probe it
+	localPort int
+	// enters counts how often each state was entered, for -metrics
+	enters map[string]int
+	// workloadSelector is the selector of the Deployment we started from, when not starting from a service
+	workloadSelector string
+	// forwardMu guards out from the port-forwards of pods probed at once
+	forwardMu    sync.Mutex
+	probePath    string
+	probeScheme  string
+	probeTimeout time.Duration
+	// httpClient is what probes are made with, when given WithHTTPClient
+	httpClient *http.Client
+	// newPortForwarder starts the port-forwards pod ports are probed through; it's newSPDYPortForwarder outside of
+	// tests, which tell the pods' port-forwards apart by the pod
+	newPortForwarder func(pod corev1.Pod, dialer httpstream.Dialer, ports []string, stopChan <-chan struct{}, readyChan chan struct{}, out, errOut io.Writer) (portForwarder, error)
+	// metricsUnavailable is set once we know the cluster has no metrics API to compare usage to limits with
+	metricsUnavailable bool
+
+	// whether any check found a problem, and every check made
+	failed bool
+	checks []report.CheckResult
+	// where the report goes when it replaces the usual output
+	reportOut io.Writer
+	// where the session is recorded, answers included, if anywhere
+	transcript io.Writer
+
+	// the state that last failed and how many times in a row it has
+	errState string
+	errCount int
+	// the states that prompted, in the order they did, for going back, and the one entered last
+	prompts []promptedState
+	entered promptedState
+	// where the last run connected to, offered as defaults, and where to remember this run's
+	last     LastUsed
+	lastPath string
+}
+
+// defaultProbeTimeout is how long we wait for a pod to answer a probe unless told otherwise
+const defaultProbeTimeout = 5 * time.Second
+
+// readyTimeout is how long we wait for a port-forward to be established
+const readyTimeout = 30 * time.Second
+
+// ErrQuit is returned when the user answers a prompt with the quit keyword
+var ErrQuit = errors.New("quit requested")
+
+// ErrBack is returned when the user answers a prompt with the back keyword, asking to return to the prompt before
+var ErrBack = errors.New("back requested")
+
+// ErrNoInput is returned when input runs out before a prompt is answered, such as when answers are piped from a
+// file. It's treated as quitting.
+var ErrNoInput = fmt.Errorf("input ended: %w", ErrQuit)
+
+// maxAttempts is how many times in a row a state may fail before we give up on the run
+const maxAttempts = 3
+
+// NewKubetrbl creates a Kubetrbl whose Kubernetes calls and port-forwards are cancelled along with ctx, and that
+// only prompts for answers not given in cfg
+func NewKubetrbl(ctx context.Context, cfg Config, opts ...Option) *Kubetrbl {
+	return NewKubetrblIO(ctx, cfg, os.Stdin, os.Stdout, opts...)
+}
+
+// Option changes how a Kubetrbl goes about troubleshooting
+type Option func(*Kubetrbl)
+
+// WithHTTPClient probes ports with the given client, such as one with a proxy or its own TLS config, instead of one
+// that waits for the probe timeout
+func WithHTTPClient(c *http.Client) Option {
+	return func(k *Kubetrbl) {
+		k.httpClient = c
+	}
 }
 
-func NewKubetrbl() *Kubetrbl {
+// NewKubetrblIO creates a Kubetrbl that reads answers from in and writes everything else to out
+func NewKubetrblIO(ctx context.Context, cfg Config, in io.Reader, out io.Writer, opts ...Option) *Kubetrbl {
 	k := &Kubetrbl{
-		reader: bufio.NewReader(os.Stdin),
+		ctx:    ctx,
+		reader: bufio.NewReader(in),
+		out:    out,
+		config: cfg,
+		debug:  cfg.Debug,
+		theme:  report.NewTheme(cfg.NoColor, out),
+
+		newPortForwarder: newSPDYPortForwarder,
+		reportOut:        out,
+	}
+	for _, opt := range opts {
+		opt(k)
+	}
+	if cfg.Output == OutputJSON || cfg.Output == OutputJSONLines {
+		k.out = io.Discard
 	}
 
 	machine := fsm.NewFSM()
+	machine.BaseContext = ctx
+	machine.OnAny(func(event, state string) {
+		if event == fsm.EventEnter {
+			k.entered = promptedState{state: state, checks: len(k.checks), failed: k.failed}
+		}
+	})
+	if cfg.Metrics {
+		k.enters = map[string]int{}
+		machine.OnAny(func(event, state string) {
+			if event == fsm.EventEnter {
+				k.enters[state]++
+			}
+		})
+	}
 	// generic error state
 	machine.ErrorHandler = func(f *fsm.FSM, err error) {
-		fmt.Println("An error occurred when troubleshooting your Kubernetes deployment.")
-		fmt.Println(err.Error())
+		// the run is out of time, so report on what we have
+		if k.timedOut() {
+			if f.State == "finish" {
+				f.Stop()
+				return
+			}
+			k.failed = true
+			k.addCheck(checkError, f.State, report.StatusFail, "troubleshooting timed out")
+			fmt.Fprintln(k.out)
+			fmt.Fprintf(k.out, "Troubleshooting timed out after %s.\n", k.config.Timeout)
+			f.Change("finish")
+			return
+		}
+		// the run was cancelled, so let the state machine unwind
+		if k.ctx.Err() != nil {
+			fmt.Fprintln(k.out)
+			fmt.Fprintln(k.out, "Troubleshooting interrupted.")
+			return
+		}
+		// a state that ran out of time falls back on its own, and would likely run out of time again
+		var terr *fsm.TimeoutError
+		if errors.As(err, &terr) {
+			k.failed = true
+			k.addCheck(checkError, terr.State, report.StatusFail, err.Error())
+			fmt.Fprintf(k.out, "Gave up on '%s' after %s.\n", terr.State, terr.Timeout)
+			return
+		}
+		if errors.Is(err, ErrBack) {
+			k.back()
+			return
+		}
+		if errors.Is(err, ErrQuit) {
+			if errors.Is(err, ErrNoInput) {
+				fmt.Fprintln(k.out)
+				fmt.Fprintln(k.out, "No more input; finishing up.")
+			}
+			// quitting from finish itself just stops
+			if f.State == "finish" {
+				f.Stop()
+				return
+			}
+			f.Change("finish")
+			return
+		}
+		fmt.Fprintln(k.out, "An error occurred when troubleshooting your Kubernetes deployment.")
+		fmt.Fprintln(k.out, err.Error())
+		// some errors are reworded from the API's, which is still useful when something's unexpected
+		if inner := errors.Unwrap(err); inner != nil && k.debug {
+			fmt.Fprintln(k.out, "  "+inner.Error())
+		}
+		if f.State == k.errState {
+			k.errCount++
+		} else {
+			k.errState, k.errCount = f.State, 1
+		}
+		// without prompts, trying again will only fail the same way
+		if k.errCount >= maxAttempts || !k.interactive() {
+			k.failed = true
+			k.addCheck(checkError, f.State, report.StatusFail, err.Error())
+			fmt.Fprintf(k.out, "Giving up after %d attempts.\n", k.errCount)
+			f.Stop()
+			return
+		}
 		// re-enter original state
-		f.Change(f.State)
+		if f.HasState(f.State) {
+			f.ChangeWith(f.State, f.Context())
+		}
 	}
 
 	machine.Register("welcome", fsm.State{Enter: k.welcome})
 	machine.Register("finish", fsm.State{Enter: k.finish})
-	machine.Register("getKubeConfig", fsm.State{Enter: k.getKubeConfig, Update: k.createK8sClient})
+	machine.Register("getKubeConfig", fsm.State{Enter: k.getKubeConfig})
+	machine.Register("getContext", fsm.State{Enter: k.getContext, Update: k.createK8sClient})
+	machine.Register("clusterOverview", fsm.State{Enter: k.clusterOverview})
 	machine.Register("getNamespace", fsm.State{Enter: k.getNamespace})
+	machine.Register("chooseStartingPoint", fsm.State{Enter: k.chooseStartingPoint})
+	machine.Register("getWorkload", fsm.State{Enter: k.getWorkload})
+	machine.Register("diagnosePod", fsm.State{Enter: k.diagnosePod})
 	machine.Register("countPods", fsm.State{Enter: k.countPods})
 	machine.Register("checkPendingPods", fsm.State{Enter: k.checkPendingPods})
+	machine.Register("diagnosePendingPods", fsm.State{Enter: k.diagnosePendingPods})
 	machine.Register("checkRunningPods", fsm.State{Enter: k.checkRunningPods})
+	machine.Register("diagnoseNonrunningPods", fsm.State{Enter: k.diagnoseNonrunningPods})
+	machine.Register("checkCrashLoopingPods", fsm.State{Enter: k.checkCrashLoopingPods})
+	machine.Register("diagnoseCrashLoopingPods", fsm.State{Enter: k.diagnoseCrashLoopingPods})
 	machine.Register("checkReadyPods", fsm.State{Enter: k.checkReadyPods})
+	machine.Register("diagnoseNotReadyPods", fsm.State{Enter: k.diagnoseNotReadyPods})
 	machine.Register("getServiceName", fsm.State{Enter: k.getServiceName})
 	machine.Register("getServicePort", fsm.State{Enter: k.getServicePort})
+	machine.Register("checkServiceEndpoints", fsm.State{Enter: k.checkServiceEndpoints})
+	machine.Register("checkServiceSelector", fsm.State{Enter: k.checkServiceSelector})
 	machine.Register("getControllerWorkload", fsm.State{Enter: k.getControllerWorkload})
+	machine.RegisterWithCtx("chooseController", fsm.StateWithCtx{Enter: k.chooseController})
+	machine.Register("checkRollout", fsm.State{Enter: k.checkRollout})
+	machine.Register("checkHPA", fsm.State{Enter: k.checkHPA})
 	machine.Register("getContainerPort", fsm.State{Enter: k.getContainerPort})
+	machine.Register("getWorkloadPort", fsm.State{Enter: k.getWorkloadPort})
 	machine.Register("getControllerPods", fsm.State{Enter: k.getControllerPods})
-	machine.Register("validateContainerPort", fsm.State{Enter: k.validateContainerPort})
+	machine.Register("checkNetworkPolicies", fsm.State{Enter: k.checkNetworkPolicies})
+	machine.Register("checkDNS", fsm.State{Enter: k.checkDNS})
+	machine.Register("getProbeOptions", fsm.State{Enter: k.getProbeOptions})
+	machine.Register("validateContainerPort", fsm.State{Enter: k.validateContainerPort, Timeout: validateTimeout, Fallback: "finish"})
+	machine.RegisterWithCtx("portInaccessible", fsm.StateWithCtx{Enter: k.portInaccessible})
+	machine.Register("checkIngress", fsm.State{Enter: k.checkIngress})
+
+	machine.Allow("welcome", "getKubeConfig")
+	machine.Allow("getKubeConfig", "getContext")
+	machine.Allow("getContext", "getKubeConfig")
+	machine.Allow("getContext", "clusterOverview")
+	machine.Allow("clusterOverview", "getNamespace")
+	machine.Allow("getNamespace", "chooseStartingPoint")
+	machine.Allow("chooseStartingPoint", "countPods")
+	machine.Allow("chooseStartingPoint", "getWorkload")
+	machine.Allow("chooseStartingPoint", "diagnosePod")
+	machine.Allow("getWorkload", "countPods")
+	machine.Allow("getNamespace", "finish")
+	machine.Allow("countPods", "checkPendingPods")
+	machine.Allow("checkPendingPods", "checkRunningPods")
+	machine.Allow("checkPendingPods", "diagnosePendingPods")
+	machine.Allow("diagnosePendingPods", "finish")
+	machine.Allow("checkRunningPods", "checkCrashLoopingPods")
+	machine.Allow("checkCrashLoopingPods", "checkReadyPods")
+	machine.Allow("checkCrashLoopingPods", "diagnoseCrashLoopingPods")
+	machine.Allow("diagnoseCrashLoopingPods", "finish")
+	machine.Allow("checkRunningPods", "diagnoseNonrunningPods")
+	machine.Allow("diagnoseNonrunningPods", "finish")
+	machine.Allow("checkReadyPods", "getServiceName")
+	machine.Allow("checkReadyPods", "getWorkloadPort")
+	machine.Allow("getWorkloadPort", "getControllerPods")
+	machine.Allow("getWorkloadPort", "finish")
+	machine.Allow("checkReadyPods", "diagnoseNotReadyPods")
+	machine.Allow("diagnoseNotReadyPods", "finish")
+	machine.Allow("getServiceName", "getServicePort")
+	machine.Allow("getServiceName", "getNamespace")
+	machine.Allow("getServiceName", "finish")
+	machine.Allow("getServicePort", "getServiceName")
+	machine.Allow("getServicePort", "finish")
+	machine.Allow("getServicePort", "checkServiceEndpoints")
+	machine.Allow("checkServiceEndpoints", "checkServiceSelector")
+	machine.Allow("checkServiceEndpoints", "finish")
+	machine.Allow("checkServiceEndpoints", "getControllerWorkload")
+	machine.Allow("checkServiceSelector", "getControllerWorkload")
+	machine.Allow("checkServiceSelector", "finish")
+	machine.Allow("getControllerWorkload", "checkRollout")
+	machine.Allow("getControllerWorkload", "getContainerPort")
+	machine.Allow("getControllerWorkload", "chooseController")
+	machine.Allow("chooseController", "checkRollout")
+	machine.Allow("chooseController", "getContainerPort")
+	machine.Allow("checkRollout", "checkHPA")
+	machine.Allow("checkHPA", "getContainerPort")
+	machine.Allow("getContainerPort", "getControllerPods")
+	machine.Allow("getContainerPort", "finish")
+	machine.Allow("getControllerPods", "checkNetworkPolicies")
+	machine.Allow("checkNetworkPolicies", "checkDNS")
+	machine.Allow("checkDNS", "getProbeOptions")
+	machine.Allow("getProbeOptions", "validateContainerPort")
+	machine.Allow("getProbeOptions", "checkIngress")
+	machine.Allow("validateContainerPort", "checkIngress")
+	machine.Allow("validateContainerPort", "portInaccessible")
+	machine.Allow("portInaccessible", "finish")
+	machine.Allow("checkIngress", "finish")
+	// the user may quit from any prompt
+	for _, name := range machine.States() {
+		if name != "finish" {
+			machine.Allow(name, "finish")
+		}
+	}
 
 	k.fsm = machine
 
 	return k
 }
 
-// Start initialized our state machine and sets us to the first state
-func (k *Kubetrbl) Start() {
-	k.fsm.Change("welcome")
+// Start troubleshoots from the named state, or from the welcome when it's empty
+func (k *Kubetrbl) Start(initialState string) {
+	if initialState == "" {
+		initialState = "welcome"
+	}
+	k.fsm.Change(initialState)
+}
+
+// Failed returns if any check found a problem
+func (k *Kubetrbl) Failed() bool {
+	return k.failed
+}
+
+// timedOut returns if the run was given a deadline that's passed
+func (k *Kubetrbl) timedOut() bool {
+	return errors.Is(k.ctx.Err(), context.DeadlineExceeded)
+}
+
+// ExitCode returns the code the process should exit with to reflect the outcome of troubleshooting
+func (k *Kubetrbl) ExitCode() int {
+	if k.timedOut() {
+		return report.ExitTimedOut
+	}
+	if k.ctx.Err() != nil {
+		return report.ExitInterrupted
+	}
+	return k.report().ExitCode()
+}
+
+// RememberLastUsed offers the kubeconfig, context, and namespace last saved to path as the default answers to their
+// prompts, and saves this run's there once it finishes
+func (k *Kubetrbl) RememberLastUsed(path string) {
+	k.lastPath = path
+	k.last = loadLastUsed(path)
+}
+
+// saveLastUsed remembers where this run connected to, if it got as far as a namespace and wasn't interrupted
+func (k *Kubetrbl) saveLastUsed() {
+	if k.lastPath == "" || k.k8sContext == nil || k.k8sContext.namespace == "" || k.ctx.Err() != nil {
+		return
+	}
+	k.last = LastUsed{
+		KubeConfig: k.k8sContext.kubeConfigPath,
+		Context:    k.k8sContext.contextName,
+		Namespace:  k.k8sContext.namespace,
+	}
+	if err := k.last.save(k.lastPath); err != nil && k.debug {
+		fmt.Fprintln(k.out, "Couldn't remember this run's namespace: "+err.Error())
+	}
+}
+
+// label describes the last used context and namespace for a prompt
+func (l LastUsed) label() string {
+	return fmt.Sprintf("[last: %s/%s]", l.Context, l.Namespace)
+}
+
+// RecordTranscript copies everything written from now on to w, along with the answers read, under a header
+// saying when and where the session ran
+func (k *Kubetrbl) RecordTranscript(w io.Writer) {
+	k.transcript = w
+	// the terminal keeps its colors, but they'd only clutter the transcript
+	k.out = io.MultiWriter(k.out, report.Uncolored(w))
+
+	contextName, namespace := k.config.Context, k.config.Namespace
+	if contextName == "" {
+		contextName = "(current)"
+	}
+	if namespace == "" {
+		namespace = "(chosen below)"
+	}
+	fmt.Fprintf(w, "Kubetrbl session started %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(w, "Context: %s\n", contextName)
+	fmt.Fprintf(w, "Namespace: %s\n", namespace)
+	fmt.Fprintln(w)
+}
+
+// Stop runs any cleanup of the active state and halts our state machine
+func (k *Kubetrbl) Stop() {
+	k.fsm.Stop()
 }
 
 func (k *Kubetrbl) finish() error {
-	fmt.Println("See ya!")
+	if k.k8sContext != nil && k.k8sContext.namespace != "" {
+		fmt.Fprintf(k.out, "Troubleshot namespace '%s' in context '%s'.\n", k.k8sContext.namespace, k.k8sContext.contextName)
+	}
+	fmt.Fprintln(k.out)
+	k.report().WriteSummary(k.out, k.theme)
+	fmt.Fprintln(k.out)
+	if k.enters != nil {
+		k.writeMetrics()
+	}
+	k.saveLastUsed()
+	if k.interactive() && k.k8sContext != nil && k.k8sContext.k8sClient != nil && k.ctx.Err() == nil {
+		again, err := k.askYesNo(false, "Troubleshoot another deployment? [y/N] ")
+		if err != nil && !errors.Is(err, ErrQuit) {
+			return err
+		}
+		if again {
+			k.troubleshootAnother()
+			return nil
+		}
+	}
+	fmt.Fprintln(k.out, "See ya!")
+	if k.config.Output == OutputJSON {
+		return k.report().WriteJSON(k.reportOut)
+	}
 	return nil
 }
 
+// writeMetrics prints how often each state was entered, most often first
+func (k *Kubetrbl) writeMetrics() {
+	states := []string{}
+	width := 0
+	for s := range k.enters {
+		states = append(states, s)
+		if len(s) > width {
+			width = len(s)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if k.enters[states[i]] != k.enters[states[j]] {
+			return k.enters[states[i]] > k.enters[states[j]]
+		}
+		return states[i] < states[j]
+	})
+
+	fmt.Fprintln(k.out, "States entered:")
+	for _, s := range states {
+		fmt.Fprintf(k.out, "  %-*s %3d %s\n", width, s, k.enters[s], strings.Repeat("#", k.enters[s]))
+	}
+	fmt.Fprintln(k.out)
+}
+
+// troubleshootAnother starts over at picking a namespace, reusing the client to the cluster but forgetting
+// everything gathered about the last deployment, including the answers given up front
+func (k *Kubetrbl) troubleshootAnother() {
+	k.k8sContext.Clear()
+	k.workloadSelector = ""
+	k.localPort = 0
+	k.probePath, k.probeScheme, k.probeTimeout = "", "", 0
+	k.errState, k.errCount = "", 0
+	k.prompts = nil
+	k.metricsUnavailable = false
+
+	k.config.Namespace = ""
+	k.config.Selector = ""
+	k.config.Service = ""
+	k.config.Port = ""
+	k.config.Path = ""
+	k.config.LocalPort = 0
+
+	fmt.Fprintln(k.out)
+	k.fsm.Reset()
+	k.fsm.Change("getNamespace")
+}
+
 func (k *Kubetrbl) welcome() error {
-	fmt.Println("Wecome to Kubetrbl.")
-	fmt.Println("Kubetrbl aims to provide a guided method for troubleshooting a Kubernetes deployment.")
-	fmt.Println("Kubetrbl's actions are based off of the troubleshooting flow described at https://learnk8s.io/a/troubleshooting-kubernetes.pdf.")
-	fmt.Println()
+	fmt.Fprintln(k.out, "Wecome to Kubetrbl.")
+	fmt.Fprintln(k.out, "Kubetrbl aims to provide a guided method for troubleshooting a Kubernetes deployment.")
+	fmt.Fprintln(k.out, "Kubetrbl's actions are based off of the troubleshooting flow described at https://learnk8s.io/a/troubleshooting-kubernetes.pdf.")
+	if k.interactive() {
+		fmt.Fprintln(k.out, "Answer q or quit at any prompt to stop troubleshooting, or b or back to return to the previous one.")
+	}
+	fmt.Fprintln(k.out)
 	k.fsm.Change("getKubeConfig")
 	return nil
 }
 
 func (k *Kubetrbl) getKubeConfig() error {
-	fmt.Println("We need to start by connecting to a Kubernetes cluster.")
-	fmt.Println("Enter the location of your KUBECONFIG file: ")
-	cfg, err := k.readString()
+	fmt.Fprintln(k.out, "We need to start by connecting to a Kubernetes cluster.")
+	def := defaultKubeConfigPath()
+	if def == "" && runningInCluster() {
+		def = inClusterConfig
+	}
+	prompt := fmt.Sprintf("Enter the location of your KUBECONFIG file, or %s to use this pod's service account: \n", inClusterConfig)
+	if k.last.KubeConfig != "" && k.interactive() {
+		def = k.last.KubeConfig
+	}
+	if def != "" {
+		prompt = fmt.Sprintf("Enter the location of your KUBECONFIG file, or %s to use this pod's service account (enter for %s): \n", inClusterConfig, def)
+	}
+	cfg, err := k.ask(k.config.KubeConfig, prompt)
 	if err != nil {
 		return err
 	}
+	if cfg == "" && def == k.last.KubeConfig {
+		cfg = def
+	}
+	if cfg == "" && def == "" {
+		return fmt.Errorf("no kubeconfig found in $%s or ~/.kube/config; please enter its location", clientcmd.RecommendedConfigPathEnvVar)
+	}
+	if cfg == "" && def == inClusterConfig {
+		cfg = inClusterConfig
+	}
+	// an empty path merges the default kubeconfigs
 	k.k8sContext = NewK8sContext(cfg)
-	k.fsm.Update()
+	if k.config.Retries > 0 {
+		k.k8sContext.retryAttempts = k.config.Retries
+	}
+	k.fsm.Change("getContext")
 	return nil
 }
 
-func (k *Kubetrbl) createK8sClient() error {
-	err := k.k8sContext.InitClient()
-	if err != nil {
-		return err
+func (k *Kubetrbl) getContext() error {
+	// a service account has no contexts to choose from
+	if k.k8sContext.InCluster() {
+		k.k8sContext.contextName = inClusterConfig
+		k.fsm.Update()
+		return nil
 	}
-	k.fsm.Change("getNamespace")
-	return nil
-}
 
-func (k *Kubetrbl) getNamespace() error {
-	nms, err := k.k8sContext.getNamespaces()
+	ctxs, err := k.k8sContext.ListContexts()
 	if err != nil {
 		return err
 	}
-	fmt.Println("Available namespaces:")
-	for i, nm := range nms {
-		fmt.Println(strconv.Itoa(i) + ") " + nm)
-	}
-	fmt.Printf("Kubernetes namespace? ")
-	answer, err := k.readInt()
+	current, err := k.k8sContext.CurrentContext()
 	if err != nil {
 		return err
 	}
-	k.k8sContext.namespace = nms[answer]
-	k.fsm.Change("countPods")
+
+	if k.config.Context != "" {
+		if !contains(ctxs, k.config.Context) {
+			return fmt.Errorf("context '%s' not found in kubeconfig", k.config.Context)
+		}
+		current = k.config.Context
+	} else if len(ctxs) > 1 && k.interactive() {
+		fmt.Fprintln(k.out, "Available contexts:")
+		for i, c := range ctxs {
+			if c == current {
+				c += " (current)"
+			}
+			fmt.Fprintln(k.out, strconv.Itoa(i)+") "+c)
+		}
+		if contains(ctxs, k.last.Context) {
+			current = k.last.Context
+			fmt.Fprintf(k.out, "Which context (enter for %s)? ", k.last.label())
+		} else {
+			fmt.Fprintf(k.out, "Which context (enter for current)? ")
+		}
+		answer, err := k.readString()
+		if err != nil {
+			return err
+		}
+		if answer != "" {
+			i, err := strconv.Atoi(answer)
+			if err != nil {
+				return err
+			}
+			if i < 0 || i >= len(ctxs) {
+				return fmt.Errorf("please enter a number between 0 and %d", len(ctxs)-1)
+			}
+			current = ctxs[i]
+		}
+	}
+	k.k8sContext.contextName = current
+	k.fsm.Update()
 	return nil
 }
 
-func (k *Kubetrbl) countPods() error {
-	pods, err := k.k8sContext.GetPods()
+func (k *Kubetrbl) createK8sClient() error {
+	err := k.k8sContext.InitClient()
 	if err != nil {
 		return err
 	}
-	fmt.Printf("There are %d pods in the cluster+namespace.\n", len(pods))
-	k.fsm.Change("checkPendingPods")
+	version, err := k.k8sContext.CheckReachable(k.ctx)
+	if err != nil {
+		if !k.interactive() || k.ctx.Err() != nil {
+			return err
+		}
+		// asking for the namespaces would only fail the same way, so start over with another kubeconfig
+		fmt.Fprintln(k.out, err.Error())
+		fmt.Fprintln(k.out, "Check the cluster is up, or choose another kubeconfig or context.")
+		fmt.Fprintln(k.out)
+		k.config.KubeConfig, k.config.Context = "", ""
+		k.fsm.Change("getKubeConfig")
+		return nil
+	}
+	k.checkServerVersion(version)
+	k.fsm.Change("clusterOverview")
 	return nil
 }
 
-func (k *Kubetrbl) checkPendingPods() error {
-	pendingPods, err := k.k8sContext.GetPendingPods()
+// versionSkewAllowed is how many minor versions the cluster can be from the client libraries before the checks may
+// not understand each other, as with kubectl's version skew policy
+const versionSkewAllowed = 1
+
+// checkServerVersion reports which Kubernetes version we connected to, and warns if it's far from what we're built for
+func (k *Kubetrbl) checkServerVersion(version string) {
+	host := k.k8sContext.host()
+	k.pass(checkServerVersion, host, "Connected to cluster %s.", version)
+	skew, ok := versionSkew(version)
+	if !ok || (skew <= versionSkewAllowed && skew >= -versionSkewAllowed) {
+		return
+	}
+	direction := "newer"
+	if skew < 0 {
+		direction, skew = "older", -skew
+	}
+	k.warn(checkServerVersion, host, "Cluster %s is %d minor versions %s than the v1.%d client libraries kubetrbl is built with; some checks may not work.", version, skew, direction, clientMinorVersion)
+}
+
+// clusterOverview optionally counts the problem pods in every namespace, to help pick one to troubleshoot
+func (k *Kubetrbl) clusterOverview() error {
+	overview := k.config.AllNamespaces
+	if !overview && k.config.Namespace == "" {
+		var err error
+		overview, err = k.askYesNo(false, "Count problem pods across all namespaces first (slow on big clusters)? [y/N] ")
+		if err != nil {
+			return err
+		}
+	}
+	if !overview {
+		k.fsm.Change("getNamespace")
+		return nil
+	}
+
+	pods, err := k.k8sContext.GetAllPods(k.ctx)
 	if err != nil {
 		return err
 	}
+	byNamespace := map[string][]corev1.Pod{}
+	for _, p := range pods {
+		byNamespace[p.GetNamespace()] = append(byNamespace[p.GetNamespace()], p)
+	}
+	namespaces := make([]string, 0, len(byNamespace))
+	for ns := range byNamespace {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
 
-	if len(pendingPods) > 0 {
-		for _, p := range pendingPods {
-			fmt.Println("\u2717 Pending - " + p)
+	fmt.Fprintf(k.out, "Across all namespaces: %d pods, %d pending, %d not running, %d not ready.\n", len(pods), len(pendingPods(pods)), len(nonrunningPods(pods)), len(notReadyPods(pods)))
+	for _, ns := range namespaces {
+		pending, nonrunning, notReady := len(pendingPods(byNamespace[ns])), len(nonrunningPods(byNamespace[ns])), len(notReadyPods(byNamespace[ns]))
+		if pending+nonrunning+notReady == 0 {
+			continue
 		}
-		// TODO transition for pending pods
-	} else {
-		fmt.Println("\u2713 No pods are pending.")
-		k.fsm.Change("checkRunningPods")
+		fmt.Fprintf(k.out, "  %s: %d pods, %d pending, %d not running, %d not ready\n", ns, len(byNamespace[ns]), pending, nonrunning, notReady)
 	}
-
+	fmt.Fprintln(k.out)
+	k.fsm.Change("getNamespace")
 	return nil
 }
 
-func (k *Kubetrbl) checkRunningPods() error {
-	nonrunningPods, err := k.k8sContext.GetNonrunningPods()
+func (k *Kubetrbl) getNamespace() error {
+	// a namespace given up front is looked up directly, which works even for those who can't list namespaces
+	if k.config.Namespace != "" {
+		ns, err := k.k8sContext.GetNamespace(k.ctx, k.config.Namespace)
+		if err != nil {
+			return err
+		}
+		if ns == nil {
+			nms, err := k.k8sContext.getNamespaces(k.ctx)
+			if err != nil {
+				return fmt.Errorf("namespace '%s' not found", k.config.Namespace)
+			}
+			return fmt.Errorf("namespace '%s' not found; available: %s", k.config.Namespace, strings.Join(nms, ", "))
+		}
+		if terminating(*ns) {
+			// asking again would only get the same answer, so let the user pick from the list instead
+			if k.interactive() {
+				k.config.Namespace = ""
+			}
+			return terminatingError(ns.GetName())
+		}
+		k.k8sContext.namespace = k.config.Namespace
+		k.fsm.Change("chooseStartingPoint")
+		return nil
+	}
+
+	nms, err := k.k8sContext.GetNamespaceObjects(k.ctx)
 	if err != nil {
 		return err
 	}
-
-	if len(nonrunningPods) > 0 {
-		for _, p := range nonrunningPods {
-			fmt.Println("\u2717 Not running - " + p)
+	if len(nms) == 0 {
+		k.fail(checkNamespaces, k.k8sContext.contextName, "No namespaces found in the cluster.")
+		k.fsm.Change("finish")
+		return nil
+	}
+	def := -1
+	prompt := "Kubernetes namespace? "
+	items := make([]string, 0, len(nms))
+	for i, ns := range nms {
+		item := ns.GetName()
+		if terminating(ns) {
+			item += " (terminating)"
 		}
-		// TODO transition for non-running pods
-	} else {
-		fmt.Println("\u2713 All pods are running.")
-		k.fsm.Change("checkReadyPods")
+		items = append(items, item)
+		if ns.GetName() == k.last.Namespace && k.k8sContext.contextName == k.last.Context {
+			def = i
+			prompt = fmt.Sprintf("Kubernetes namespace (enter for %s)? ", k.last.label())
+		}
+	}
+	answer, err := k.chooseFromListDefault("Available namespaces:", prompt, items, def)
+	if err != nil {
+		return err
 	}
+	if terminating(nms[answer]) {
+		fmt.Fprintln(k.out, terminatingError(nms[answer].GetName()).Error())
+		fmt.Fprintln(k.out)
+		k.fsm.Change("getNamespace")
+		return nil
+	}
+	k.k8sContext.namespace = nms[answer].GetName()
+	k.fsm.Change("chooseStartingPoint")
 	return nil
 }
 
-func (k *Kubetrbl) checkReadyPods() error {
-	notReadyPods, err := k.k8sContext.GetNotReadyPods()
+// terminatingError explains why we won't troubleshoot the namespace
+func terminatingError(name string) error {
+	return fmt.Errorf("namespace '%s' is terminating: everything in it is being deleted, so there's nothing to troubleshoot", name)
+}
+
+// chooseStartingPoint asks whether to troubleshoot from a service, following the service down to its pods, or
+// from a Deployment straight to its pods
+func (k *Kubetrbl) chooseStartingPoint() error {
+	k.workloadSelector = ""
+	if k.config.Pod != "" {
+		k.fsm.Change("diagnosePod")
+		return nil
+	}
+	if k.config.Service != "" {
+		k.fsm.Change("countPods")
+		return nil
+	}
+	answer, err := k.ask("", "Start from a service, a deployment, or a single pod (enter for service)? ")
 	if err != nil {
 		return err
 	}
-
-	if len(notReadyPods) > 0 {
-		for _, p := range notReadyPods {
-			fmt.Println("\u2717 Not ready - " + p)
-		}
-		// TODO transition for non-running pods
-	} else {
-		fmt.Println("\u2713 All pods are ready.")
-		k.fsm.Change("getServiceName")
+	switch strings.ToLower(answer) {
+	case "", "s", "service":
+		k.fsm.Change("countPods")
+	case "d", "deployment":
+		k.fsm.Change("getWorkload")
+	case "p", "pod":
+		k.fsm.Change("diagnosePod")
+	default:
+		return fmt.Errorf("'%s' is not service, deployment, or pod", answer)
 	}
 	return nil
 }
 
-func (k *Kubetrbl) getServiceName() error {
-	svcs, err := k.k8sContext.k8sClient.CoreV1().Services(k.k8sContext.namespace).List(context.TODO(), metav1.ListOptions{})
+func (k *Kubetrbl) getWorkload() error {
+	names, err := k.k8sContext.GetDeployments(k.ctx)
 	if err != nil {
 		return err
 	}
-
-	fmt.Println("Available services: ")
-	for i, s := range svcs.Items {
-		fmt.Println(strconv.Itoa(i) + ") " + s.GetName())
+	if len(names) == 0 {
+		fmt.Fprintf(k.out, "There are no Deployments in namespace '%s'; starting from a service instead.\n", k.k8sContext.namespace)
+		k.fsm.Change("countPods")
+		return nil
 	}
-
-	fmt.Printf("Which service? ")
-	answer, err := k.readInt()
+	answer, err := k.chooseFromList("Available deployments:", "Which deployment? ", names)
 	if err != nil {
 		return err
 	}
 
-	k.svc = svcs.Items[answer]
-
-	k.fsm.Change("getServicePort")
+	d, err := k.k8sContext.GetDeployment(k.ctx, names[answer])
+	if err != nil {
+		return err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	k.k8sContext.controller = NewController(d, appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	k.k8sContext.controllers = []*Controller{k.k8sContext.controller}
+	k.dump("Deployment '"+d.GetName()+"'", d)
+	k.workloadSelector = selector.String()
+	k.fsm.Change("countPods")
 	return nil
 }
 
-func (k *Kubetrbl) getServicePort() error {
-	fmt.Println("Available ports: ")
-	for i, p := range k.svc.Spec.Ports {
-		fmt.Println(strconv.Itoa(i) + ") " + p.Name)
+// getWorkloadPort picks the port to probe when starting from a Deployment, which is the first one its
+// containers expose
+func (k *Kubetrbl) getWorkloadPort() error {
+	found := false
+	for _, cnt := range k.k8sContext.controller.Template.Spec.Containers {
+		if len(cnt.Ports) > 0 {
+			k.k8sContext.containerPort = cnt.Ports[0]
+			found = true
+			break
+		}
 	}
+	name := k.k8sContext.controller.GetName()
+	if !found {
+		k.skip(checkContainerPort, name, "Deployment '%s' exposes no container ports to probe.", name)
+		k.fsm.Change("finish")
+		return nil
+	}
+	k.pass(checkContainerPort, name, "Identified pod port: %d", k.k8sContext.containerPort.ContainerPort)
+	if k.skipUnforwardable(name, k.k8sContext.containerPort.ContainerPort, protocolOf(k.k8sContext.containerPort.Protocol)) {
+		k.fsm.Change("finish")
+		return nil
+	}
+	k.k8sContext.ports = []PortMapping{{Container: k.k8sContext.containerPort}}
+	k.fsm.Change("getControllerPods")
+	return nil
+}
 
-	fmt.Printf("Which port? ")
-	answer, err := k.readInt()
+func (k *Kubetrbl) countPods() error {
+	given := k.config.Selector
+	if k.workloadSelector != "" {
+		given = k.workloadSelector
+	}
+	selector, err := k.ask(given, "Label selector to limit the pods checked, e.g. app=web (enter for all pods)? ")
 	if err != nil {
 		return err
 	}
+	if _, err := labels.Parse(selector); err != nil {
+		return err
+	}
 
-	k.svcPort = k.svc.Spec.Ports[answer]
-	k.fsm.Change("getControllerWorkload")
+	pods, err := k.k8sContext.GetPodsBySelector(k.ctx, selector)
+	if err != nil {
+		return err
+	}
+	for _, p := range pods {
+		k.dump("Pod '"+p.GetName()+"' status", p.Status)
+	}
+	if selector != "" {
+		fmt.Fprintf(k.out, "There are %d pods matching '%s' in the cluster+namespace.\n", len(pods), selector)
+	} else {
+		fmt.Fprintf(k.out, "There are %d pods in the cluster+namespace.\n", len(pods))
+	}
+	k.fsm.Change("checkPendingPods")
 	return nil
 }
 
-func (k *Kubetrbl) getControllerWorkload() error {
-	k8sName := k.svc.Spec.Selector["app.kubernetes.io/name"]
-	deployment, err := k.k8sContext.k8sClient.AppsV1().Deployments(k.k8sContext.namespace).Get(context.TODO(), k8sName, metav1.GetOptions{})
+func (k *Kubetrbl) checkPendingPods() error {
+	if k.skipped(onlyPending, checkPendingPods, "checkRunningPods") {
+		return nil
+	}
+	pendingPods, err := k.k8sContext.GetPendingPods()
 	if err != nil {
 		return err
 	}
-	k.controller = deployment
-	fmt.Println("\u2713 Found backing Deployment - " + k.controller.GetName())
-	k.fsm.Change("getContainerPort")
-	return nil
-}
 
-func (k *Kubetrbl) getContainerPort() error {
-	tgt := k.svcPort.TargetPort.StrVal
-	for _, cnt := range k.controller.Spec.Template.Spec.Containers {
-		for _, p := range cnt.Ports {
-			if tgt == p.Name {
-				k.containerPort = p
-				break
-			}
+	if len(pendingPods) > 0 {
+		for _, p := range pendingPods {
+			k.fail(checkPendingPods, p, "Pending - %s", p)
 		}
+		k.fsm.Change("diagnosePendingPods")
+	} else {
+		k.pass(checkPendingPods, k.k8sContext.namespace, "No pods are pending.")
+		k.fsm.Change("checkRunningPods")
 	}
-	fmt.Println("\u2713 Identified pod port: " + strconv.Itoa(int(k.containerPort.ContainerPort)))
-	k.fsm.Change("getControllerPods")
+
 	return nil
 }
 
-func (k *Kubetrbl) getControllerPods() error {
-	// our target is based off the controller
-	tgt := k.controller.Labels["app.kubernetes.io/name"]
-	result := []corev1.Pod{}
-	for _, p := range k.k8sContext.pods {
-		pos := p.Labels["app.kubernetes.io/name"]
-		if tgt == pos {
-			result = append(result, p)
-		}
-	}
-	k.podList = result
-	k.fsm.Change("validateContainerPort")
-	return nil
+// schedulingReasons are the event reasons that explain why a pod is stuck pending
+var schedulingReasons = map[string]bool{
+	"FailedScheduling": true,
+	"Unschedulable":    true,
 }
 
-func (k *Kubetrbl) validateContainerPort() error {
-	client, err := rest.RESTClientFor(k.k8sContext.config)
+func (k *Kubetrbl) diagnosePendingPods() error {
+	pendingPods, err := k.k8sContext.GetPendingPods()
 	if err != nil {
 		return err
 	}
 
-	for _, pod := range k.podList {
-		fmt.Printf("Checking accessibility of port for pod '%s'.\n", pod.Name)
-		req := client.Post().
-			Resource("pods").
-			Namespace(k.k8sContext.namespace).
-			Name(pod.Name).
-			SubResource("portforward")
+	nodes, err := k.k8sContext.NodeCapacityReport(k.ctx)
+	if err != nil {
+		return err
+	}
+	if err := k.checkResourceQuotas(); err != nil {
+		return err
+	}
+	ranges, err := k.k8sContext.LimitRanges(k.ctx)
+	if err != nil {
+		return err
+	}
 
-		// TODO retrieve local port from user
-		portMapping := []string{fmt.Sprintf("%d:%d", 8080, k.containerPort.ContainerPort)}
+	for _, p := range pendingPods {
+		pod, err := k.k8sContext.findPod(p)
+		if err != nil {
+			return err
+		}
+		// a scheduled pod stays pending until its init containers finish
+		if pod.Spec.NodeName != "" {
+			if err := k.checkInitContainers(pod); err != nil {
+				return err
+			}
+			continue
+		}
 
-		transport, upgrader, err := spdy.RoundTripperFor(k.k8sContext.config)
-		dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
-		stopChan := make(chan struct{}, 1)
-		readyChan := make(chan struct{})
-		pf, err := portforward.New(
-			dialer,
-			portMapping,
-			stopChan,
-			readyChan,
-			os.Stdout,
-			os.Stderr,
-		)
+		evts, err := k.k8sContext.GetPodEvents(k.ctx, p)
 		if err != nil {
 			return err
 		}
 
-		doneChan := make(chan error)
-		go func() {
-			doneChan <- pf.ForwardPorts()
-		}()
-		<-pf.Ready
+		found := false
+		for _, e := range evts {
+			if schedulingReasons[e.Reason] {
+				// events are most recent first, so this is the latest word on scheduling
+				k.fail(checkPodScheduling, p, "Pod '%s' can't be scheduled (%s): %s", p, e.Reason, e.Message)
+				found = true
+				break
+			}
+		}
+		if !found {
+			k.warn(checkPodScheduling, p, "Pod '%s' is pending without any scheduling events; check 'kubectl describe pod %s'.", p, p)
+		}
 
-		// TODO retrieve path from user
-		resp, err := http.DefaultClient.Get("http://localhost:8080/internal/metrics")
-		if err != nil {
+		if err := k.checkNodeCapacity(p, nodes); err != nil {
 			return err
 		}
-		if resp.StatusCode < 400 {
-			fmt.Println("\u2713 Pod port accessible.")
-		} else {
-			// TODO transition to failure state
-			fmt.Println("\u2717 Pod port inaccessible.")
+		if err := k.checkVolumeClaims(p); err != nil {
+			return err
+		}
+		if err := k.checkNodeTaints(p, nodes); err != nil {
+			return err
 		}
+		for _, lr := range ranges {
+			for _, problem := range limitRangeProblems(lr, pod) {
+				k.warn(checkLimitRange, p, "Likely cause: %s.", problem)
+			}
+		}
+	}
 
-		close(stopChan)
+	k.fsm.Change("finish")
+	return nil
+}
+
+// checkNodeCapacity reports if no schedulable node has enough free CPU and memory for the pending pod
+func (k *Kubetrbl) checkNodeCapacity(podName string, nodes []NodeResources) error {
+	pod, err := k.k8sContext.findPod(podName)
+	if err != nil {
+		return err
+	}
+
+	cpu, memory := podRequests(pod)
+	if cpu.IsZero() && memory.IsZero() {
+		return nil
+	}
+	for _, n := range nodes {
+		if n.Fits(cpu, memory) {
+			return nil
+		}
+	}
+	k.fail(checkNodeCapacity, podName, "Pod '%s' requests %s CPU / %s memory but no node has that much free.", podName, cpu.String(), memory.String())
+	return nil
+}
+
+// checkResourceQuotas warns of quotas that are used up, which stop any more pods being created in the namespace
+func (k *Kubetrbl) checkResourceQuotas() error {
+	quotas, err := k.k8sContext.QuotaStatus(k.ctx)
+	if err != nil {
+		return err
+	}
+	for _, q := range quotas {
+		if exhausted := exhaustedQuota(q); len(exhausted) > 0 {
+			k.warn(checkResourceQuota, q.GetName(), "Likely cause: ResourceQuota '%s' is at its hard limit (%s).", q.GetName(), strings.Join(exhausted, ", "))
+		}
+	}
+	return nil
+}
+
+// checkVolumeClaims reports any persistent volume claims keeping the pending pod from starting
+func (k *Kubetrbl) checkVolumeClaims(podName string) error {
+	pod, err := k.k8sContext.findPod(podName)
+	if err != nil {
+		return err
+	}
+
+	unbound, err := k.k8sContext.GetUnboundPVCs(k.ctx, pod)
+	if err != nil {
+		return err
+	}
+	for _, u := range unbound {
+		k.fail(checkVolumeClaims, podName, "Pod '%s' is waiting on a volume: %s.", podName, u)
+	}
+	return nil
+}
+
+// checkNodeTaints reports if every schedulable node has a taint the pending pod doesn't tolerate
+func (k *Kubetrbl) checkNodeTaints(podName string, nodes []NodeResources) error {
+	pod, err := k.k8sContext.findPod(podName)
+	if err != nil {
+		return err
+	}
+
+	untolerated, err := k.k8sContext.UntoleratedTaints(k.ctx, pod)
+	if err != nil {
+		return err
+	}
+	schedulable := 0
+	for _, n := range nodes {
+		if !n.Unschedulable {
+			schedulable++
+		}
+	}
+	if schedulable == 0 || len(untolerated) < schedulable {
+		return nil
+	}
+
+	// the taints every node shares are the most useful to call out
+	common := map[string]int{}
+	for _, taints := range untolerated {
+		for _, t := range taints {
+			common[t]++
+		}
+	}
+	shared := []string{}
+	for t, count := range common {
+		if count == len(untolerated) {
+			shared = append(shared, t)
+		}
+	}
+	sort.Strings(shared)
+
+	if len(shared) > 0 {
+		k.fail(checkNodeTaints, podName, "Pod '%s' can't be scheduled: all nodes are tainted '%s' and this pod has no matching toleration.", podName, strings.Join(shared, "', '"))
+		return nil
+	}
+	k.fail(checkNodeTaints, podName, "Pod '%s' can't be scheduled: every node has a taint this pod doesn't tolerate.", podName)
+	names := []string{}
+	for n := range untolerated {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(k.out, "    %s: %s\n", n, strings.Join(untolerated[n], ", "))
+	}
+	return nil
+}
+
+func (k *Kubetrbl) checkRunningPods() error {
+	if k.skipped(onlyRunning, checkRunningPods, "checkCrashLoopingPods") {
+		return nil
+	}
+	nonrunningPods, err := k.k8sContext.GetNonrunningPods()
+	if err != nil {
+		return err
+	}
+
+	if len(nonrunningPods) > 0 {
+		for _, p := range nonrunningPods {
+			k.fail(checkRunningPods, p, "Not running - %s", p)
+		}
+		k.fsm.Change("diagnoseNonrunningPods")
+	} else {
+		k.pass(checkRunningPods, k.k8sContext.namespace, "All pods are running.")
+		k.fsm.Change("checkCrashLoopingPods")
+	}
+	return nil
+}
+
+// waitReasonHints explain the container waiting reasons that commonly keep a pod from running
+var waitReasonHints = map[string]string{
+	"ImagePullBackOff":           "the image can't be pulled; check the image name, tag, and pull secrets",
+	"ErrImagePull":               "the image can't be pulled; check the image name, tag, and pull secrets",
+	"CrashLoopBackOff":           "the container keeps crashing; check its logs",
+	"CreateContainerConfigError": "the container's configuration is invalid; check referenced ConfigMaps and Secrets",
+}
+
+// checkInitContainers reports init containers that failed, and the one the pod is stuck waiting on
+func (k *Kubetrbl) checkInitContainers(pod corev1.Pod) error {
+	name := pod.GetName()
+	failed, err := k.k8sContext.FailedInitContainers(name)
+	if err != nil {
+		return err
+	}
+	for _, t := range failed {
+		prefix := ""
+		if t.Previous {
+			prefix = "previously "
+		}
+		k.fail(checkInitContainers, name+"/"+t.ContainerName, "Pod '%s' init container '%s' %sfailed with exit code %d (%s).", name, t.ContainerName, prefix, t.ExitCode, t.Reason)
+		if hint, ok := exitCodeHints[t.ExitCode]; ok {
+			fmt.Fprintln(k.out, "  "+hint)
+		}
+	}
+
+	// init containers run in order, so the first one that hasn't completed is what the pod is waiting on
+	total := len(pod.Status.InitContainerStatuses)
+	for done, cs := range pod.Status.InitContainerStatuses {
+		if t := cs.State.Terminated; t != nil && t.ExitCode == 0 {
+			continue
+		}
+		target := name + "/" + cs.Name
+		switch {
+		case cs.State.Waiting != nil && cs.State.Waiting.Reason != "PodInitializing":
+			k.fail(checkInitContainers, target, "Pod '%s' is stuck at Init:%d/%d: init container '%s' is waiting (%s): %s", name, done, total, cs.Name, cs.State.Waiting.Reason, cs.State.Waiting.Message)
+			if hint, ok := waitReasonHints[cs.State.Waiting.Reason]; ok {
+				fmt.Fprintln(k.out, "  "+hint)
+			}
+		case cs.State.Running != nil:
+			k.warn(checkInitContainers, target, "Pod '%s' is at Init:%d/%d: init container '%s' is still running.", name, done, total, cs.Name)
+		}
+		break
+	}
+	return nil
+}
+
+// exitCodeHints explain the container exit codes that commonly come up
+var exitCodeHints = map[int32]string{
+	126: "the container's command couldn't be executed; check its permissions",
+	127: "the container's command wasn't found; check the image and command",
+	137: "the container was killed with SIGKILL, most often for going over its memory limit",
+	139: "the container crashed with a segmentation fault",
+	143: "the container was stopped with SIGTERM, usually by Kubernetes shutting it down",
+}
+
+func (k *Kubetrbl) diagnoseNonrunningPods() error {
+	nonrunningPods, err := k.k8sContext.GetNonrunningPods()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range nonrunningPods {
+		pod, err := k.k8sContext.findPod(p)
+		if err != nil {
+			return err
+		}
+		if pod.Status.Phase == corev1.PodSucceeded {
+			k.pass(checkPodStatus, p, "Pod '%s' ran to completion.", p)
+			continue
+		}
+		if pod.Status.Reason != "" {
+			k.fail(checkPodStatus, p, "Pod '%s' is %s (%s): %s", p, pod.Status.Phase, pod.Status.Reason, pod.Status.Message)
+		}
+
+		if err := k.diagnoseContainers(pod); err != nil {
+			return err
+		}
+	}
+
+	k.fsm.Change("finish")
+	return nil
+}
+
+// diagnoseContainers reports why the pod's containers are waiting or have died, including its init containers and
+// any config they're missing
+func (k *Kubetrbl) diagnoseContainers(pod corev1.Pod) error {
+	p := pod.GetName()
+	reasons, err := k.k8sContext.GetContainerWaitReasons(p)
+	if err != nil {
+		return err
+	}
+	for _, cnt := range sortedKeys(reasons) {
+		r := reasons[cnt]
+		k.fail(checkContainerStatus, p+"/"+cnt, "Pod '%s' container '%s' is waiting (%s): %s", p, cnt, r.Reason, r.Message)
+		if hint, ok := waitReasonHints[r.Reason]; ok {
+			fmt.Fprintln(k.out, "  "+hint)
+		}
+	}
+
+	if err := k.checkInitContainers(pod); err != nil {
+		return err
+	}
+
+	missing, err := k.k8sContext.MissingConfigReferences(k.ctx, pod)
+	if err != nil {
+		return err
+	}
+	for _, m := range missing {
+		k.fail(checkConfigReferences, p, "Pod '%s' references %s which does not exist.", p, m)
+	}
+
+	terminations, err := k.k8sContext.TerminatedContainers(p)
+	if err != nil {
+		return err
+	}
+	for _, t := range terminations {
+		if t.ExitCode == 0 {
+			continue
+		}
+		prefix := ""
+		if t.Previous {
+			prefix = "previously "
+		}
+		k.fail(checkContainerStatus, p+"/"+t.ContainerName, "Pod '%s' %s%s", p, prefix, t)
+		if hint, ok := exitCodeHints[t.ExitCode]; ok {
+			fmt.Fprintln(k.out, "  "+hint)
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the container names of reasons in a stable order for printing
+func sortedKeys(reasons map[string]WaitReason) []string {
+	result := []string{}
+	for name := range reasons {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// podEventCount is how many of a pod's most recent events diagnosePod shows
+const podEventCount = 10
+
+// diagnosePod runs every per-pod check against a single pod named up front, skipping past listing and choosing
+func (k *Kubetrbl) diagnosePod() error {
+	name, err := k.ask(k.config.Pod, "Pod name? ")
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("please enter the name of a pod")
+	}
+	pod, err := k.k8sContext.GetPod(k.ctx, name)
+	if err != nil {
+		return err
+	}
+	k.k8sContext.pods = []corev1.Pod{*pod}
+	k.dump("Pod '"+name+"'", pod)
+
+	switch pod.Status.Phase {
+	case corev1.PodRunning:
+		k.pass(checkPodStatus, name, "Pod '%s' is Running.", name)
+	case corev1.PodSucceeded:
+		k.pass(checkPodStatus, name, "Pod '%s' ran to completion.", name)
+	case corev1.PodPending:
+		k.fail(checkPendingPods, name, "Pod '%s' is Pending.", name)
+	default:
+		k.fail(checkPodStatus, name, "Pod '%s' is %s (%s): %s", name, pod.Status.Phase, pod.Status.Reason, pod.Status.Message)
+	}
+	if failing := formatConditions(pod.Status.Conditions, pod.Spec.ReadinessGates); len(failing) > 0 {
+		k.fail(checkPodReadiness, name, "Pod '%s' is not ready: %s", name, strings.Join(failing, "; "))
+	}
+	if err := k.diagnoseContainers(*pod); err != nil {
+		return err
+	}
+	if err := k.checkLivenessRestarts(); err != nil {
+		return err
+	}
+
+	evts, err := k.k8sContext.GetEventsFor(k.ctx, "Pod", name, podEventCount)
+	if err != nil {
+		return err
+	}
+	if len(evts) > 0 {
+		fmt.Fprintf(k.out, "Recent events for pod '%s':\n", name)
+		for _, e := range evts {
+			fmt.Fprintf(k.out, "  %s\n", formatEvent(e))
+		}
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		show, err := k.askYesNo(false, "Show the logs of container '%s'? [y/N] ", cs.Name)
+		if err != nil {
+			return err
+		}
+		if !show {
+			continue
+		}
+		logs, err := k.k8sContext.GetPodLogs(k.ctx, name, cs.Name, false, defaultLogLines)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(k.out, logs)
+	}
+
+	k.fsm.Change("finish")
+	return nil
+}
+
+func (k *Kubetrbl) checkCrashLoopingPods() error {
+	if k.skipped(onlyRunning, checkCrashLoopingPods, "checkReadyPods") {
+		return nil
+	}
+	crashing, err := k.k8sContext.GetCrashLoopingPods()
+	if err != nil {
+		return err
+	}
+	if err := k.checkLivenessRestarts(); err != nil {
+		return err
+	}
+
+	if len(crashing) > 0 {
+		for _, c := range crashing {
+			k.fail(checkCrashLoopingPods, c.PodName+"/"+c.ContainerName, "Crash looping - pod '%s' container '%s' restarted %d times, last exit code %d (%s)", c.PodName, c.ContainerName, c.RestartCount, c.ExitCode, c.Reason)
+			if c.Reason == "OOMKilled" {
+				fmt.Fprintln(k.out, "  The container ran out of memory; check its memory limits.")
+			}
+		}
+		k.fsm.Change("diagnoseCrashLoopingPods")
+	} else {
+		k.pass(checkCrashLoopingPods, k.k8sContext.namespace, "No pods are crash looping.")
+		k.fsm.Change("checkReadyPods")
+	}
+	return nil
+}
+
+// checkLivenessRestarts points at the liveness probe of containers that restart without their pod leaving Running,
+// since a probe that's too strict kills containers that are only slow
+func (k *Kubetrbl) checkLivenessRestarts() error {
+	restarts, err := k.k8sContext.GetLivenessRestarts()
+	if err != nil {
+		return err
+	}
+	for _, r := range restarts {
+		probe, err := k.k8sContext.LivenessProbeFor(r.PodName, r.ContainerName)
+		if err != nil {
+			return err
+		}
+		k.warn(checkLivenessProbe, r.PodName+"/"+r.ContainerName, "Pod '%s' container '%s' restarted %d times and has a liveness probe: %s", r.PodName, r.ContainerName, r.RestartCount, describeProbe(probe))
+		if r.ExitCode == 137 && r.Reason != "OOMKilled" {
+			fmt.Fprintln(k.out, "  It was last killed (exit code 137), which is what a failing liveness probe does; check the probe's timeouts suit the container.")
+		}
+	}
+	return nil
+}
+
+// defaultLogLines is how much of a crashing container's log we show unless told otherwise
+const defaultLogLines = 50
+
+func (k *Kubetrbl) diagnoseCrashLoopingPods() error {
+	crashing, err := k.k8sContext.GetCrashLoopingPods()
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for _, c := range crashing {
+		if seen[c.PodName] {
+			continue
+		}
+		seen[c.PodName] = true
+		pod, err := k.k8sContext.findPod(c.PodName)
+		if err != nil {
+			return err
+		}
+		if err := k.checkResourceUsage(pod); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range crashing {
+		which, err := k.ask("", "Show the logs of pod '%s' container '%s'? p for the previous (crashed) instance, c for the current one, n to skip (enter for p): ", c.PodName, c.ContainerName)
+		if err != nil {
+			return err
+		}
+		which = strings.ToLower(which)
+		if which == "n" {
+			continue
+		}
+		if which != "" && which != "p" && which != "c" {
+			return fmt.Errorf("'%s' is not one of p, c, or n", which)
+		}
+
+		lines, err := k.ask("", "How many lines (enter for %d)? ", defaultLogLines)
+		if err != nil {
+			return err
+		}
+		tail := int64(defaultLogLines)
+		if lines != "" {
+			tail, err = strconv.ParseInt(lines, 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		logs, err := k.k8sContext.GetPodLogs(k.ctx, c.PodName, c.ContainerName, which != "c", tail)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(k.out, logs)
+	}
+
+	k.fsm.Change("finish")
+	return nil
+}
+
+func (k *Kubetrbl) checkReadyPods() error {
+	next := "getServiceName"
+	if k.workloadSelector != "" {
+		next = "getWorkloadPort"
+	}
+	if k.skipped(onlyReady, checkReadyPods, next) {
+		return nil
+	}
+
+	// the pods checked are the controller's when we started from it
+	pods := k.k8sContext.pods
+	if c := k.k8sContext.controller; c != nil {
+		pods = podsOf(c, pods)
+	}
+	notReady := notReadyPods(pods)
+	ready := len(pods) - len(notReady)
+	threshold := k.readyThreshold()
+
+	switch readyStatus(ready, len(pods), threshold) {
+	case report.StatusFail:
+		for _, p := range notReady {
+			k.fail(checkReadyPods, p, "Not ready - %s", p)
+		}
+		if threshold < 100 {
+			fmt.Fprintf(k.out, "  %d of %d pods are ready, short of the %d%% threshold.\n", ready, len(pods), threshold)
+		}
+		k.fsm.Change("diagnoseNotReadyPods")
+	default:
+		if len(notReady) > 0 {
+			for _, p := range notReady {
+				k.warn(checkReadyPods, p, "Not ready - %s", p)
+			}
+			fmt.Fprintf(k.out, "  %d of %d pods are ready, within the %d%% threshold.\n", ready, len(pods), threshold)
+		} else {
+			k.pass(checkReadyPods, k.k8sContext.namespace, "All pods are ready.")
+		}
+		k.fsm.Change(next)
+	}
+	return nil
+}
+
+// readyThreshold is the percentage of pods that have to be ready for the ready check to pass, with a warning when
+// some aren't
+func (k *Kubetrbl) readyThreshold() int {
+	if k.config.ReadyThreshold <= 0 || k.config.ReadyThreshold > 100 {
+		return 100
+	}
+	return k.config.ReadyThreshold
+}
+
+// readyStatus passes when all pods are ready, warns when fewer are but at least threshold percent, and fails when
+// fewer than that are
+func readyStatus(ready, total, threshold int) report.Status {
+	if ready >= total {
+		return report.StatusPass
+	}
+	if ready*100 >= threshold*total {
+		return report.StatusWarn
+	}
+	return report.StatusFail
+}
+
+// podsOf returns the pods the controller owns, or all of them if it owns none, as when pods were chosen by another
+// selector
+func podsOf(c *Controller, pods []corev1.Pod) []corev1.Pod {
+	owned := []corev1.Pod{}
+	for _, pod := range pods {
+		if c.Owns(pod) {
+			owned = append(owned, pod)
+		}
+	}
+	if len(owned) == 0 {
+		return pods
+	}
+	return owned
+}
+
+func (k *Kubetrbl) diagnoseNotReadyPods() error {
+	notReadyPods, err := k.k8sContext.GetNotReadyPods()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range notReadyPods {
+		pod, err := k.k8sContext.findPod(p)
+		if err != nil {
+			return err
+		}
+		conds, err := k.k8sContext.GetPodConditions(p)
+		if err != nil {
+			return err
+		}
+		failing := formatConditions(conds, pod.Spec.ReadinessGates)
+		if conditionFalse(conds, corev1.PodScheduled) {
+			// an unscheduled pod has no containers whose readiness probes could be to blame
+			k.fail(checkPodReadiness, p, "Pod '%s' is not ready because it isn't scheduled: %s", p, strings.Join(failing, "; "))
+			continue
+		}
+		if len(failing) > 0 {
+			k.fail(checkPodReadiness, p, "Pod '%s' is not ready: %s", p, strings.Join(failing, "; "))
+		}
+		// a container starved of CPU can be too slow to answer its readiness probe
+		if err := k.checkResourceUsage(pod); err != nil {
+			return err
+		}
+
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Ready {
+				continue
+			}
+			probe, err := k.k8sContext.ReadinessProbeFor(cs.Name)
+			if err != nil {
+				return err
+			}
+			k.fail(checkReadinessProbe, p+"/"+cs.Name, "Pod '%s' container '%s' is failing its readiness probe: %s", p, cs.Name, describeProbe(probe))
+		}
+	}
+
+	k.fsm.Change("finish")
+	return nil
+}
+
+func (k *Kubetrbl) getServiceName() error {
+	// a service given up front is looked up directly, which works even for those who can't list services
+	if k.config.Service != "" {
+		svc, err := k.k8sContext.GetService(k.ctx, k.config.Service)
+		if err != nil {
+			return err
+		}
+		k.k8sContext.svc = *svc
+		k.fsm.Change("getServicePort")
+		return nil
+	}
+
+	svcs, err := k.k8sContext.listServices(k.ctx)
+	if err != nil {
+		return err
+	}
+	if len(svcs) == 0 {
+		if k.interactive() && k.config.Namespace == "" {
+			fmt.Fprintf(k.out, "No services found in namespace '%s'; pick another namespace.\n", k.k8sContext.namespace)
+			k.fsm.Change("getNamespace")
+		} else {
+			k.fail(checkServices, k.k8sContext.namespace, "No services found in namespace '%s'.", k.k8sContext.namespace)
+			k.fsm.Change("finish")
+		}
+		return nil
+	}
+
+	names := []string{}
+	for _, s := range svcs {
+		names = append(names, s.GetName())
+	}
+	answer, err := k.chooseFromList("Available services: ", "Which service? ", names)
+	if err != nil {
+		return err
+	}
+
+	k.k8sContext.svc = svcs[answer]
+
+	k.fsm.Change("getServicePort")
+	return nil
+}
+
+func (k *Kubetrbl) getServicePort() error {
+	k.dump("Service '"+k.k8sContext.svc.GetName()+"'", k.k8sContext.svc)
+	if len(k.k8sContext.svc.Spec.Ports) == 0 {
+		if k.interactive() && k.config.Service == "" {
+			fmt.Fprintf(k.out, "Service '%s' has no ports; pick another service.\n", k.k8sContext.svc.GetName())
+			k.fsm.Change("getServiceName")
+		} else {
+			k.fail(checkServicePorts, k.k8sContext.svc.GetName(), "Service '%s' has no ports.", k.k8sContext.svc.GetName())
+			k.fsm.Change("finish")
+		}
+		return nil
+	}
+
+	ports := k.k8sContext.svc.Spec.Ports
+	if k.config.Port == allPorts {
+		k.useServicePorts(ports)
+		return nil
+	}
+	if k.config.Port != "" {
+		p, err := ServicePortByName(k.k8sContext.svc, k.config.Port)
+		if err != nil {
+			return err
+		}
+		k.useServicePorts([]corev1.ServicePort{p})
+		return nil
+	}
+
+	names := []string{}
+	for _, p := range ports {
+		names = append(names, p.Name)
+	}
+	if len(ports) > 1 {
+		names = append(names, allPorts)
+	}
+	answer, err := k.chooseFromList("Available ports: ", "Which port? ", names)
+	if err != nil {
+		return err
+	}
+
+	if answer == len(ports) {
+		k.useServicePorts(ports)
+	} else {
+		k.useServicePorts([]corev1.ServicePort{ports[answer]})
+	}
+	return nil
+}
+
+// allPorts is the answer to which service port to check that checks every one of them
+const allPorts = "all"
+
+// useServicePorts keeps the service ports chosen to check and moves on to the service's endpoints
+func (k *Kubetrbl) useServicePorts(ports []corev1.ServicePort) {
+	k.k8sContext.svcPorts = ports
+	k.k8sContext.svcPort = ports[0]
+	k.fsm.Change("checkServiceEndpoints")
+}
+
+func (k *Kubetrbl) checkServiceEndpoints() error {
+	if k.skipped(onlyEndpoints, checkServiceEndpoints, "getControllerWorkload") {
+		return nil
+	}
+	eps, err := k.k8sContext.GetServiceEndpoints(k.ctx, k.k8sContext.svc.GetName())
+	if err != nil {
+		return err
+	}
+
+	if len(eps) > 0 {
+		k.pass(checkServiceEndpoints, k.k8sContext.svc.GetName(), "Service has %d endpoints: %s", len(eps), strings.Join(eps, ", "))
+		k.fsm.Change("checkServiceSelector")
+		return nil
+	}
+
+	k.fail(checkServiceEndpoints, k.k8sContext.svc.GetName(), "Service '%s' has no endpoints!", k.k8sContext.svc.GetName())
+	fmt.Fprintln(k.out, "  No ready pods match the service's selector. Most likely the selector doesn't match the labels on")
+	fmt.Fprintln(k.out, "  your pods, or the matching pods aren't passing their readiness probes.")
+	cont, err := k.askYesNo(true, "Continue on to check the service's selector? [Y/n] ")
+	if err != nil {
+		return err
+	}
+	if cont {
+		k.fsm.Change("checkServiceSelector")
+	} else {
+		k.fsm.Change("finish")
+	}
+	return nil
+}
+
+func (k *Kubetrbl) checkServiceSelector() error {
+	pods, err := k.k8sContext.PodsMatchingService(k.ctx, k.k8sContext.svc)
+	if err != nil {
+		return err
+	}
+
+	if len(pods) > 0 {
+		k.pass(checkServiceSelector, k.k8sContext.svc.GetName(), "Service selector matches %d pods.", len(pods))
+		k.fsm.Change("getControllerWorkload")
+		return nil
+	}
+
+	k.fail(checkServiceSelector, k.k8sContext.svc.GetName(), "Service selector '%s' matches no pods!", labels.SelectorFromSet(k.k8sContext.svc.Spec.Selector).String())
+	fmt.Fprintln(k.out, "  Compare it with the labels on the pods in the namespace:")
+	for _, p := range k.k8sContext.pods {
+		fmt.Fprintf(k.out, "  %s: %s\n", p.GetName(), labels.Set(p.GetLabels()).String())
+	}
+	k.fsm.Change("finish")
+	return nil
+}
+
+// defaultSelectorLabel is the label key controllers are matched on alone unless told otherwise
+const defaultSelectorLabel = "app.kubernetes.io/name"
+
+func (k *Kubetrbl) getControllerWorkload() error {
+	selector := k.k8sContext.svc.Spec.Selector
+	controllers, err := k.k8sContext.FindControllers(k.ctx, selector)
+	var nerr *noControllerError
+	if errors.As(err, &nerr) {
+		controllers, err = k.findControllerByLabel(selector, err)
+	}
+	if errors.As(err, &nerr) {
+		k.fsm.ChangeWith("chooseController", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	name := k.k8sContext.svc.GetName()
+	if len(controllers) == 1 {
+		k.pass(checkController, name, "Found backing %s - %s", controllers[0].Kind.Kind, controllers[0].GetName())
+	} else {
+		k.pass(checkController, name, "Found %d backing controllers - %s; checking the pods of all of them.", len(controllers), joinControllers(controllers))
+	}
+	k.useControllers(controllers)
+	return nil
+}
+
+// joinControllers lists the controllers as Kind/name
+func joinControllers(controllers []*Controller) string {
+	names := make([]string, 0, len(controllers))
+	for _, c := range controllers {
+		names = append(names, c.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// findControllerByLabel looks for the controllers by the selector label alone, for when labels the service selects
+// on are added to the pods by something other than their controller's template. It returns notFound if the selector
+// doesn't have the label, or has only that.
+func (k *Kubetrbl) findControllerByLabel(selector map[string]string, notFound error) ([]*Controller, error) {
+	key := k.config.SelectorLabel
+	if key == "" {
+		key = defaultSelectorLabel
+	}
+	value, ok := selector[key]
+	if !ok || len(selector) == 1 {
+		return nil, notFound
+	}
+	controllers, err := k.k8sContext.FindControllers(k.ctx, map[string]string{key: value})
+	if err == nil {
+		k.warn(checkController, k.k8sContext.svc.GetName(), "No controller's pods match the whole selector; %s match on %s=%s.", joinControllers(controllers), key, value)
+	}
+	return controllers, err
+}
+
+// chooseController is entered with the error from failing to find the service's controller, and lets the user pick
+// it from every Deployment, StatefulSet, and DaemonSet in the namespace instead. Without anyone to ask, or anything
+// to pick from, the error stands.
+func (k *Kubetrbl) chooseController(ctx interface{}) error {
+	notFound, _ := ctx.(error)
+	if notFound == nil {
+		notFound = fmt.Errorf("no controller found for service '%s'", k.k8sContext.svc.GetName())
+	}
+	if !k.interactive() {
+		return notFound
+	}
+
+	kinds := []struct {
+		kind string
+		list func(context.Context) ([]string, error)
+	}{
+		{"Deployment", k.k8sContext.GetDeployments},
+		{"StatefulSet", k.k8sContext.GetStatefulSets},
+		{"DaemonSet", k.k8sContext.GetDaemonSets},
+	}
+	items := []string{}
+	for _, kd := range kinds {
+		names, err := kd.list(k.ctx)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			items = append(items, kd.kind+"/"+name)
+		}
+	}
+	if len(items) == 0 {
+		return notFound
+	}
+
+	fmt.Fprintf(k.out, "Couldn't find the service's controller: %s.\n", notFound.Error())
+	answer, err := k.chooseFromList("Controllers:", "Which one backs the service? ", items)
+	if err != nil {
+		return err
+	}
+	parts := strings.SplitN(items[answer], "/", 2)
+	obj, err := k.k8sContext.GetController(k.ctx, parts[0], parts[1])
+	if err != nil {
+		return err
+	}
+	kind := appsv1.SchemeGroupVersion.WithKind(parts[0])
+	k.pass(checkController, k.k8sContext.svc.GetName(), "Using %s - %s, as chosen", kind.Kind, obj.GetName())
+	k.useControllers([]*Controller{NewController(obj, kind)})
+	return nil
+}
+
+// useControllers keeps the controllers found for the service and moves on to checking them. The first is the one
+// whose containers the service's ports are looked up in.
+func (k *Kubetrbl) useControllers(controllers []*Controller) {
+	k.k8sContext.controllers = controllers
+	k.k8sContext.controller = controllers[0]
+	for _, c := range controllers {
+		k.dump(c.Kind.Kind+" '"+c.GetName()+"'", c.Object)
+		if d, ok := c.Object.(*appsv1.Deployment); ok {
+			k.checkReplicas(d)
+		}
+	}
+	if len(k.k8sContext.deployments()) > 0 {
+		k.fsm.Change("checkRollout")
+		return
+	}
+	k.fsm.Change("getContainerPort")
+}
+
+// checkReplicas reports if a Deployment has fewer ready replicas than it wants
+func (k *Kubetrbl) checkReplicas(d *appsv1.Deployment) {
+	desired, ready, available := replicaHealth(d)
+	name := d.GetName()
+	if ready < desired || available < desired {
+		k.warn(checkReplicas, name, "Deployment '%s' is short of replicas: desired %d, ready %d, available %d.", name, desired, ready, available)
+	} else {
+		k.pass(checkReplicas, name, "Deployment '%s' has all %d replicas ready and available.", name, desired)
+	}
+	if d.Status.UnavailableReplicas > 0 {
+		fmt.Fprintf(k.out, "  %d replicas are unavailable.\n", d.Status.UnavailableReplicas)
+	}
+}
+
+// rolloutEventCount is how many of a failed Deployment's most recent events we show
+const rolloutEventCount = 5
+
+func (k *Kubetrbl) checkRollout() error {
+	for _, d := range k.k8sContext.deployments() {
+		if err := k.checkRolloutOf(d.GetName()); err != nil {
+			return err
+		}
+	}
+	k.fsm.Change("checkHPA")
+	return nil
+}
+
+// checkRolloutOf reports how the rollout of the named Deployment is going, with its latest events if it failed
+func (k *Kubetrbl) checkRolloutOf(name string) error {
+	status, err := k.k8sContext.DeploymentRolloutStatus(k.ctx, name)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case status.Failed:
+		k.fail(checkRollout, name, "Deployment '%s' %s.", name, status)
+		if status.Message != "" {
+			fmt.Fprintf(k.out, "    %s\n", status.Message)
+		}
+		evts, err := k.k8sContext.GetEventsFor(k.ctx, "Deployment", name, rolloutEventCount)
+		if err != nil {
+			return err
+		}
+		for _, e := range evts {
+			fmt.Fprintf(k.out, "    %s\n", formatEvent(e))
+		}
+	case status.Complete:
+		k.pass(checkRollout, name, "Deployment '%s' %s", name, status)
+	default:
+		k.warn(checkRollout, name, "Deployment '%s' %s", name, status)
+	}
+	return nil
+}
+
+// checkHPA reports on the autoscalers behind the Deployments, if there are any, since they decide how many replicas
+// there are and can stop scaling when they can't read their metrics
+func (k *Kubetrbl) checkHPA() error {
+	for _, d := range k.k8sContext.deployments() {
+		if err := k.checkHPAFor(d.GetName()); err != nil {
+			return err
+		}
+	}
+	k.fsm.Change("getContainerPort")
+	return nil
+}
+
+// checkHPAFor reports on the autoscaler of the named Deployment, if it has one
+func (k *Kubetrbl) checkHPAFor(name string) error {
+	hpa, err := k.k8sContext.HPAForDeployment(k.ctx, name)
+	if err != nil {
+		return err
+	}
+	if hpa == nil {
+		return nil
+	}
+
+	k.dump("HorizontalPodAutoscaler '"+hpa.GetName()+"'", hpa)
+	minReplicas := int32(1)
+	if hpa.Spec.MinReplicas != nil {
+		minReplicas = *hpa.Spec.MinReplicas
+	}
+	fmt.Fprintf(k.out, "HorizontalPodAutoscaler '%s' scales Deployment '%s' between %d and %d replicas; it has %d and wants %d.\n", hpa.GetName(), name, minReplicas, hpa.Spec.MaxReplicas, hpa.Status.CurrentReplicas, hpa.Status.DesiredReplicas)
+	if targets := hpaTargets(hpa); len(targets) > 0 {
+		fmt.Fprintf(k.out, "  Targets: %s\n", strings.Join(targets, ", "))
+	}
+	problems := hpaProblems(hpa)
+	if len(problems) > 0 {
+		k.fail(checkHPA, hpa.GetName(), "HorizontalPodAutoscaler '%s' can't scale: %s", hpa.GetName(), strings.Join(problems, "; "))
+	} else {
+		k.pass(checkHPA, hpa.GetName(), "HorizontalPodAutoscaler '%s' is able to scale.", hpa.GetName())
+	}
+	return nil
+}
+
+func (k *Kubetrbl) getContainerPort() error {
+	name := k.k8sContext.svc.GetName()
+	ports := k.k8sContext.svcPorts
+	if len(ports) == 0 {
+		ports = []corev1.ServicePort{k.k8sContext.svcPort}
+	}
+
+	mappings := []PortMapping{}
+	for _, svcPort := range ports {
+		tgt := svcPort.TargetPort
+		cntPort, found := k.containerPortFor(tgt)
+		if !found && len(ports) == 1 {
+			return fmt.Errorf("no container in %s '%s' exposes target port '%s' of service port '%s'", k.k8sContext.controller.Kind.Kind, k.k8sContext.controller.GetName(), tgt.String(), svcPort.Name)
+		}
+		// with several ports to check, one that's missing shouldn't stop the others
+		if !found {
+			k.fail(checkContainerPort, name, "No container in %s '%s' exposes target port '%s' of service port '%s'.", k.k8sContext.controller.Kind.Kind, k.k8sContext.controller.GetName(), tgt.String(), svcPort.Name)
+			continue
+		}
+		k.pass(checkContainerPort, name, "Identified pod port: %d", cntPort.ContainerPort)
+
+		svcProtocol, cntProtocol := protocolOf(svcPort.Protocol), protocolOf(cntPort.Protocol)
+		if svcProtocol != cntProtocol {
+			k.warn(checkContainerPort, name, "Service port '%s' is %s but the container port %d is %s.", svcPort.Name, svcProtocol, cntPort.ContainerPort, cntProtocol)
+		}
+		// traffic through the service is only TCP if both ends of it are
+		protocol := cntProtocol
+		if svcProtocol != corev1.ProtocolTCP {
+			protocol = svcProtocol
+		}
+		if k.skipUnforwardable(name, cntPort.ContainerPort, protocol) {
+			continue
+		}
+		mappings = append(mappings, PortMapping{Service: svcPort, Container: cntPort})
+	}
+	if len(mappings) == 0 {
+		k.fsm.Change("finish")
+		return nil
+	}
+	k.k8sContext.ports = mappings
+	k.k8sContext.svcPort, k.k8sContext.containerPort = mappings[0].Service, mappings[0].Container
+	k.fsm.Change("getControllerPods")
+	return nil
+}
+
+// containerPortFor returns the port of the controller's containers that a service's targetPort refers to
+func (k *Kubetrbl) containerPortFor(tgt intstr.IntOrString) (corev1.ContainerPort, bool) {
+	for _, cnt := range k.k8sContext.controller.Template.Spec.Containers {
+		for _, p := range cnt.Ports {
+			if matchesTargetPort(tgt, p) {
+				return p, true
+			}
+		}
+	}
+	return corev1.ContainerPort{}, false
+}
+
+// skipUnforwardable records the port probe as skipped when the port isn't TCP, since port-forwarding only carries
+// TCP, and suggests how to check it instead. It returns if the probe was skipped.
+func (k *Kubetrbl) skipUnforwardable(target string, port int32, protocol corev1.Protocol) bool {
+	if protocol == corev1.ProtocolTCP {
+		return false
+	}
+	if protocol == corev1.ProtocolUDP {
+		k.skip(checkPodPort, target, "Not probing container port %d: UDP ports can't be validated via port-forward.", port)
+		fmt.Fprintf(k.out, "  Check it from a pod in the cluster instead, e.g. kubectl run -it --rm --image=busybox udp-check -- nc -u <pod IP> %d\n", port)
+		return true
+	}
+	k.skip(checkPodPort, target, "Not probing container port %d: port-forwarding and HTTP probes only work over TCP, not %s.", port, protocol)
+	return true
+}
+
+// protocolOf returns the protocol of a port, which is TCP when it isn't given
+func protocolOf(p corev1.Protocol) corev1.Protocol {
+	if p == "" {
+		return corev1.ProtocolTCP
+	}
+	return p
+}
+
+// matchesTargetPort returns if a container port is the one a service's targetPort refers to, either by number or by name
+func matchesTargetPort(tgt intstr.IntOrString, p corev1.ContainerPort) bool {
+	if tgt.Type == intstr.Int {
+		return p.ContainerPort == tgt.IntVal
+	}
+	return p.Name == tgt.StrVal
+}
+
+func (k *Kubetrbl) getControllerPods() error {
+	// the pods we care about are the ones the service sends traffic to, or the Deployment's when we started there
+	var pods []corev1.Pod
+	var err error
+	if k.workloadSelector != "" {
+		pods, err = k.k8sContext.listPods(k.ctx, k.workloadSelector)
+	} else {
+		pods, err = k.k8sContext.PodsMatchingService(k.ctx, k.k8sContext.svc)
+	}
+	if err != nil {
+		return err
+	}
+	k.k8sContext.podList = pods
+	k.attributePods(pods)
+	k.fsm.Change("checkNetworkPolicies")
+	return nil
+}
+
+// attributePods says which controller each of the pods belongs to, when the service sends traffic to several, and
+// warns of pods that none of them own, like ones created by hand
+func (k *Kubetrbl) attributePods(pods []corev1.Pod) {
+	if len(k.k8sContext.controllers) == 0 {
+		return
+	}
+	for _, pod := range pods {
+		c := controllerFor(pod, k.k8sContext.controllers)
+		if c == nil {
+			k.warn(checkController, pod.GetName(), "Pod '%s' gets the service's traffic but isn't owned by any of its controllers; nothing replaces it if it goes away.", pod.GetName())
+			continue
+		}
+		if len(k.k8sContext.controllers) > 1 {
+			fmt.Fprintf(k.out, "  Pod '%s' belongs to %s '%s'.\n", pod.GetName(), c.Kind.Kind, c.GetName())
+		}
+	}
+}
+
+func (k *Kubetrbl) checkNetworkPolicies() error {
+	policies, err := k.k8sContext.PoliciesAffectingPods(k.ctx, k.k8sContext.podList)
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		k.pass(checkNetworkPolicy, k.k8sContext.svc.GetName(), "No NetworkPolicies restrict traffic to the service's pods.")
+		k.fsm.Change("checkDNS")
+		return nil
+	}
+
+	fmt.Fprintf(k.out, "%d NetworkPolicies restrict traffic to the service's pods.\n", len(policies))
+	for _, np := range policies {
+		rules := ingressRulesForPort(np, k.k8sContext.containerPort)
+		switch {
+		case len(rules) == 0:
+			k.warn(checkNetworkPolicy, np.GetName(), "Possible cause: NetworkPolicy '%s' allows no traffic to port %d.", np.GetName(), k.k8sContext.containerPort.ContainerPort)
+		case allowsFromAnywhere(rules):
+			fmt.Fprintf(k.out, "  NetworkPolicy '%s' allows traffic to port %d from anywhere.\n", np.GetName(), k.k8sContext.containerPort.ContainerPort)
+		default:
+			k.warn(checkNetworkPolicy, np.GetName(), "Possible cause: NetworkPolicy '%s' only allows traffic to port %d from some sources.", np.GetName(), k.k8sContext.containerPort.ContainerPort)
+		}
+	}
+	// port-forwarding doesn't go through the pod network, so the probes that follow can pass regardless
+	fmt.Fprintln(k.out, "  NetworkPolicies don't apply to the port-forward used to probe the pods below.")
+	k.fsm.Change("checkDNS")
+	return nil
+}
+
+// checkDNS is a best-effort check that the service's name resolves to its cluster IP from inside one of its pods
+func (k *Kubetrbl) checkDNS() error {
+	svc := k.k8sContext.svc
+	if svc.GetName() == "" || len(k.k8sContext.podList) == 0 {
+		k.fsm.Change("getProbeOptions")
+		return nil
+	}
+	check := k.config.CheckDNS
+	if !check {
+		var err error
+		check, err = k.askYesNo(false, "Check the service's DNS name resolves from inside a pod (best effort)? [y/N] ")
+		if err != nil {
+			return err
+		}
+	}
+	if !check {
+		k.fsm.Change("getProbeOptions")
+		return nil
+	}
+
+	name := serviceFQDN(svc)
+	pod := k.k8sContext.podList[0]
+	if k.config.DryRun {
+		k.skip(checkDNS, svc.GetName(), "Dry run: would run '%s' in pod '%s'.", strings.Join(dnsLookupCommand(name), " "), pod.GetName())
+		k.fsm.Change("getProbeOptions")
+		return nil
+	}
+	stdout, _, err := k.k8sContext.ExecInPod(k.ctx, pod.GetName(), pod.Spec.Containers[0].Name, dnsLookupCommand(name))
+	addrs := resolvedAddresses(stdout)
+	switch {
+	case err != nil && len(addrs) == 0:
+		// the image may have no shell or lookup tools, so fall back on whether cluster DNS is up at all
+		ready, total, derr := k.k8sContext.CoreDNSReady(k.ctx)
+		if derr != nil || total == 0 {
+			k.skip(checkDNS, svc.GetName(), "Couldn't look up '%s' from pod '%s' (%s), or find the cluster DNS pods.", name, pod.GetName(), err.Error())
+		} else if ready < total {
+			k.warn(checkDNS, svc.GetName(), "Couldn't look up '%s' from pod '%s', and only %d of %d cluster DNS pods are ready.", name, pod.GetName(), ready, total)
+		} else {
+			k.skip(checkDNS, svc.GetName(), "Couldn't look up '%s' from pod '%s' (%s); all %d cluster DNS pods are ready.", name, pod.GetName(), err.Error(), total)
+		}
+	case len(addrs) == 0:
+		k.fail(checkDNS, svc.GetName(), "'%s' doesn't resolve from pod '%s'.", name, pod.GetName())
+	case svc.Spec.ClusterIP == corev1.ClusterIPNone || contains(addrs, svc.Spec.ClusterIP):
+		k.pass(checkDNS, svc.GetName(), "'%s' resolves to %s from pod '%s'.", name, strings.Join(addrs, ", "), pod.GetName())
+	default:
+		k.fail(checkDNS, svc.GetName(), "'%s' resolves to %s from pod '%s', not the service's cluster IP %s.", name, strings.Join(addrs, ", "), pod.GetName(), svc.Spec.ClusterIP)
+	}
+	k.fsm.Change("getProbeOptions")
+	return nil
+}
+
+// allowsFromAnywhere returns if any of the rules lets in traffic without restricting where it comes from
+func allowsFromAnywhere(rules []networkingv1.NetworkPolicyIngressRule) bool {
+	for _, r := range rules {
+		if len(r.From) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *Kubetrbl) getProbeOptions() error {
+	if k.skipped(onlyPort, checkPodPort, "checkIngress") {
+		return nil
+	}
+	port, err := k.ask(localPortAnswer(k.config.LocalPort), "Local port to forward from (enter for any free port)? ")
+	if err != nil {
+		return err
+	}
+	k.localPort = 0
+	if port != "" {
+		k.localPort, err = strconv.Atoi(port)
+		if err != nil {
+			return err
+		}
+		if k.localPort < 1 || k.localPort > 65535 {
+			return fmt.Errorf("local port %d is outside 1-65535", k.localPort)
+		}
+	}
+
+	scheme, err := k.ask("", "Scheme to probe with, http or https (enter for http)? ")
+	if err != nil {
+		return err
+	}
+	scheme = strings.ToLower(scheme)
+	if scheme == "" {
+		scheme = "http"
+	}
+	if scheme != "http" && scheme != "https" {
+		return fmt.Errorf("scheme '%s' must be http or https", scheme)
+	}
+	k.probeScheme = scheme
+
+	path, err := k.ask(k.config.Path, "Path to probe (enter for /)? ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("path '%s' must start with /", path)
+	}
+	k.probePath = path
+
+	timeout, err := k.ask("", "Seconds to wait for a response (enter for %d)? ", int(defaultProbeTimeout.Seconds()))
+	if err != nil {
+		return err
+	}
+	k.probeTimeout = defaultProbeTimeout
+	if timeout != "" {
+		secs, err := strconv.Atoi(timeout)
+		if err != nil {
+			return err
+		}
+		if secs < 1 {
+			return fmt.Errorf("timeout must be at least 1 second")
+		}
+		k.probeTimeout = time.Duration(secs) * time.Second
+	}
+
+	k.fsm.Change("validateContainerPort")
+	return nil
+}
+
+// validateTimeout is how long probing every pod's port may take altogether
+const validateTimeout = 5 * time.Minute
+
+// defaultConcurrency is how many pods' ports we probe at once unless told otherwise
+const defaultConcurrency = 5
+
+// portResult is the outcome of probing one pod's port
+type portResult struct {
+	result ProbeResult
+	err    error
+}
+
+// portProbe is a pod and one of its ports to probe
+type portProbe struct {
+	pod  corev1.Pod
+	port int32
+}
+
+// target names what was probed in the report, with the port when there are several being checked
+func (p portProbe) target(ports int) string {
+	if ports > 1 {
+		return fmt.Sprintf("%s:%d", p.pod.Name, p.port)
+	}
+	return p.pod.Name
+}
+
+func (k *Kubetrbl) validateContainerPort() error {
+	pods := k.k8sContext.podList
+	if k.config.DryRun {
+		k.describePortProbes(pods)
+		k.fsm.Change("checkIngress")
+		return nil
+	}
+
+	// every port of each pod, in order, so results are reported the same way every time
+	ports := k.k8sContext.ports
+	probes := []portProbe{}
+	for _, pod := range pods {
+		for _, m := range ports {
+			probes = append(probes, portProbe{pod, m.Container.ContainerPort})
+		}
+	}
+	results := make([]portResult, len(probes))
+
+	workers := k.config.Concurrency
+	if workers < 1 {
+		workers = defaultConcurrency
+	}
+	// a port we were told to forward from can only be used by one port-forward at a time
+	if k.localPort != 0 {
+		workers = 1
+	}
+
+	// the state's context is done once we've run out of time, as well as on an interrupt
+	ctx := k.fsm.StateContext()
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, probe portProbe) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result, err := k.checkPodPort(ctx, probe.pod, probe.port)
+			results[i] = portResult{result, err}
+		}(i, probe)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	inaccessible := []string{}
+	for i, probe := range probes {
+		if len(ports) > 1 {
+			fmt.Fprintf(k.out, "Checking accessibility of port %d for pod '%s'.\n", probe.port, probe.pod.Name)
+		} else {
+			fmt.Fprintf(k.out, "Checking accessibility of port for pod '%s'.\n", probe.pod.Name)
+		}
+		result, err := results[i].result, results[i].err
+		if err != nil {
+			return err
+		}
+		k.record(checkPodPort, probe.target(len(ports)), result.Status, "%s", result.Message)
+		if result.Inaccessible() {
+			inaccessible = append(inaccessible, probe.target(len(ports)))
+		}
+	}
+	if k.k8sContext.svc.GetName() != "" {
+		for _, m := range ports {
+			if err := k.checkServicePort(ctx, pods, m, len(ports)); err != nil {
+				return err
+			}
+		}
+	}
+	if len(inaccessible) > 0 {
+		k.fsm.ChangeWith("portInaccessible", inaccessible)
+		return nil
+	}
+	k.fsm.Change("checkIngress")
+	return nil
+}
 
+// describePortProbes says what validateContainerPort would do for each pod, for a dry run
+func (k *Kubetrbl) describePortProbes(pods []corev1.Pod) {
+	local := "localhost:0"
+	if k.localPort != 0 {
+		local = fmt.Sprintf("localhost:%d", k.localPort)
+	}
+	ports := k.k8sContext.ports
+	for _, pod := range pods {
+		for _, m := range ports {
+			probe := portProbe{pod, m.Container.ContainerPort}
+			k.skip(checkPodPort, probe.target(len(ports)), "Dry run: would forward %s -> %s:%d and GET %s://localhost%s", local, pod.Name, probe.port, k.probeScheme, k.probePath)
+		}
+	}
+	if k.k8sContext.svc.GetName() == "" {
+		return
+	}
+	if pod, ok := servicePod(pods); ok {
+		for _, m := range ports {
+			k.skip(checkPodPort, serviceTarget(k.k8sContext.svc, m, len(ports)), "Dry run: would forward %s -> %s:%d via Service '%s' and GET %s://localhost%s", local, pod.Name, m.Container.ContainerPort, k.k8sContext.svc.GetName(), k.probeScheme, k.probePath)
+		}
+	}
+}
+
+// serviceTarget names a probe via the service in the report, with the service port when there are several
+func serviceTarget(svc corev1.Service, m PortMapping, ports int) string {
+	if ports > 1 {
+		return fmt.Sprintf("svc/%s:%d", svc.GetName(), m.Service.Port)
+	}
+	return "svc/" + svc.GetName()
+}
+
+// servicePod returns the pod a port-forward to the service would go to, the way kubectl port-forward svc/... picks
+// one: the first that's running and ready. It's false when there's no such pod.
+func servicePod(pods []corev1.Pod) (corev1.Pod, bool) {
+	for _, pod := range pods {
+		if IsRunning(pod) && IsReady(pod) {
+			return pod, true
+		}
+	}
+	return corev1.Pod{}, false
+}
+
+// checkServicePort probes the service's port the way a port-forward to the service would, through one of its pods
+func (k *Kubetrbl) checkServicePort(ctx context.Context, pods []corev1.Pod, m PortMapping, ports int) error {
+	svc := k.k8sContext.svc
+	target := serviceTarget(svc, m, ports)
+	// it's the same for every port, so only needs saying once
+	if headless(svc) && m.Service.Port == k.k8sContext.svcPort.Port {
+		fmt.Fprintf(k.out, "Service '%s' is headless: it has no cluster IP, so clients connect to pod IPs from DNS directly.\n", svc.GetName())
+	}
+	pod, ok := servicePod(pods)
+	if !ok {
+		k.skip(checkPodPort, target, "Not probing via Service '%s': none of its pods is running and ready.", svc.GetName())
+		return nil
+	}
+
+	fmt.Fprintf(k.out, "Checking accessibility of port %d via Service '%s' (pod '%s').\n", m.Service.Port, svc.GetName(), pod.Name)
+	result, err := k.checkPodPort(ctx, pod, m.Container.ContainerPort)
+	if err != nil {
+		return err
+	}
+	k.record(checkPodPort, target, result.Status, "Via Service (pod '%s'): %s", pod.Name, result.Message)
+	if !result.Inaccessible() && headless(svc) && m.Service.Port == k.k8sContext.svcPort.Port {
+		fmt.Fprintln(k.out, "  With no cluster IP, each of the headless service's pods answers for itself.")
+	}
+	return nil
+}
+
+// portInaccessible is entered with the names of the pods whose port couldn't be reached
+func (k *Kubetrbl) portInaccessible(ctx interface{}) error {
+	pods, _ := ctx.([]string)
+	k.failed = true
+	port := k.k8sContext.containerPort.ContainerPort
+	if ports := len(k.k8sContext.ports); ports > 1 {
+		fmt.Fprintf(k.out, "%d of %d pod ports aren't accessible: %s\n", len(pods), ports*len(k.k8sContext.podList), strings.Join(pods, ", "))
+	} else {
+		fmt.Fprintf(k.out, "Port %d isn't accessible on %d of %d pods: %s\n", port, len(pods), len(k.k8sContext.podList), strings.Join(pods, ", "))
+	}
+	fmt.Fprintln(k.out, "Next steps:")
+	fmt.Fprintf(k.out, "  - check the container's process is listening on port %d, and on all interfaces rather than localhost\n", port)
+	fmt.Fprintln(k.out, "  - check the readiness probe matches what the process serves")
+	fmt.Fprintln(k.out, "  - once the port answers here, check no firewall or NetworkPolicy drops the service's traffic to the pods")
+	k.fsm.Change("finish")
+	return nil
+}
+
+func (k *Kubetrbl) checkIngress() error {
+	if k.skipped(onlyIngress, checkIngress, "finish") {
+		return nil
+	}
+	// starting from a Deployment, there's no service for an Ingress to route to
+	if k.k8sContext.svc.GetName() == "" {
+		k.fsm.Change("finish")
+		return nil
+	}
+	ings, err := k.k8sContext.IngressesForService(k.ctx, k.k8sContext.svc.GetName())
+	if err != nil {
+		return err
+	}
+	if len(ings) == 0 {
+		fmt.Fprintf(k.out, "No Ingress sends traffic to service '%s'.\n", k.k8sContext.svc.GetName())
+		k.fsm.Change("finish")
+		return nil
+	}
+
+	for _, ing := range ings {
+		name := ing.GetName()
+		class := "(default)"
+		if ing.Spec.IngressClassName != nil {
+			class = *ing.Spec.IngressClassName
+		}
+		fmt.Fprintf(k.out, "Ingress '%s' (class %s) routes to the service:\n", name, class)
+
+		for _, r := range ingressRoutes(ing, k.k8sContext.svc.GetName()) {
+			route := "default backend"
+			if r.Host != "" || r.Path != "" {
+				host := r.Host
+				if host == "" {
+					host = "*"
+				}
+				route = host + r.Path
+			}
+			if _, ok := servicePortFor(k.k8sContext.svc, r.Port); ok {
+				fmt.Fprintf(k.out, "  %s -> port %s\n", route, r.Port.String())
+			} else {
+				k.fail(checkIngress, name, "Ingress '%s' sends %s to port '%s', which service '%s' doesn't expose.", name, route, r.Port.String(), k.k8sContext.svc.GetName())
+			}
+		}
+
+		addrs := []string{}
+		for _, lb := range ing.Status.LoadBalancer.Ingress {
+			if lb.Hostname != "" {
+				addrs = append(addrs, lb.Hostname)
+			} else if lb.IP != "" {
+				addrs = append(addrs, lb.IP)
+			}
+		}
+		if len(addrs) > 0 {
+			k.pass(checkIngress, name, "Ingress '%s' has address %s", name, strings.Join(addrs, ", "))
+		} else {
+			k.warn(checkIngress, name, "Ingress '%s' has no address yet; check its ingress controller is running.", name)
+		}
 	}
 	k.fsm.Change("finish")
 	return nil
 }
 
+// ProbeResult is what a probe's response, or the lack of one, says about a pod's port
+type ProbeResult struct {
+	Status  report.Status
+	Message string
+}
+
+// Inaccessible returns if the probe got no HTTP response at all
+func (r ProbeResult) Inaccessible() bool {
+	return r.Status == report.StatusFail
+}
+
+// classifyProbe interprets a probe's response. Any HTTP response at all means the port is accessible, even one
+// asking for auth; server errors are only a warning, since the app is reachable but unwell.
+func classifyProbe(resp *http.Response, err error) ProbeResult {
+	var nerr net.Error
+	switch {
+	case errors.As(err, &nerr) && nerr.Timeout():
+		return ProbeResult{report.StatusFail, "Pod port open but no response before the probe timed out."}
+	case isTLSError(err):
+		return ProbeResult{report.StatusFail, fmt.Sprintf("Pod port open, but the TLS handshake failed: %s", err)}
+	case err != nil:
+		return ProbeResult{report.StatusFail, fmt.Sprintf("Pod port inaccessible: %s", err)}
+	case resp.StatusCode >= 500:
+		return ProbeResult{report.StatusWarn, fmt.Sprintf("Pod port accessible, but the app is returning server errors (%s).", resp.Status)}
+	case resp.StatusCode >= 400:
+		return ProbeResult{report.StatusPass, fmt.Sprintf("Pod port accessible; the app responded %s.", resp.Status)}
+	}
+	return ProbeResult{report.StatusPass, "Pod port accessible."}
+}
+
+// portForwarder is the part of a *portforward.PortForwarder that checkPodPort uses, so tests can stand in for one
+type portForwarder interface {
+	ForwardPorts() error
+	GetPorts() ([]portforward.ForwardedPort, error)
+}
+
+// newSPDYPortForwarder makes a port-forward over the dialer's SPDY connection to the API server
+func newSPDYPortForwarder(_ corev1.Pod, dialer httpstream.Dialer, ports []string, stopChan <-chan struct{}, readyChan chan struct{}, out, errOut io.Writer) (portForwarder, error) {
+	return portforward.New(dialer, ports, stopChan, readyChan, out, errOut)
+}
+
+// forwardFailed is the result of probing a pod whose port couldn't be forwarded
+func forwardFailed(pod corev1.Pod, err error) ProbeResult {
+	return ProbeResult{report.StatusFail, fmt.Sprintf("Pod port inaccessible: port-forward to pod '%s' failed: %s", pod.Name, err)}
+}
+
+// checkPodPort forwards a local port to one of the pod's container ports and probes it. It's safe to call for several
+// pods at once, as long as the local port is left up to the OS.
+func (k *Kubetrbl) checkPodPort(ctx context.Context, pod corev1.Pod, port int32) (ProbeResult, error) {
+	client, err := rest.RESTClientFor(k.k8sContext.config)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	req := client.Post().
+		Resource("pods").
+		Namespace(k.k8sContext.namespace).
+		Name(pod.Name).
+		SubResource("portforward")
+
+	// a local port of 0 has the OS pick a free one, so port-forwards don't collide
+	portMapping := []string{fmt.Sprintf("%d:%d", k.localPort, port)}
+
+	transport, upgrader, err := spdy.RoundTripperFor(k.k8sContext.config)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+	stopChan := make(chan struct{})
+	readyChan := make(chan struct{})
+	out := &lockedWriter{mu: &k.forwardMu, w: k.out}
+	pf, err := k.newPortForwarder(
+		pod,
+		dialer,
+		portMapping,
+		stopChan,
+		readyChan,
+		out,
+		out,
+	)
+	if err != nil {
+		close(stopChan)
+		return forwardFailed(pod, err), nil
+	}
+
+	doneChan := make(chan error, 1)
+	go func() {
+		doneChan <- pf.ForwardPorts()
+	}()
+	forwarding := true
+	defer func() {
+		close(stopChan)
+		if forwarding {
+			<-doneChan
+		}
+	}()
+
+	// a port-forward that fails is this pod's port being inaccessible, and the others are still worth probing
+	select {
+	case <-readyChan:
+	case err := <-doneChan:
+		forwarding = false
+		if err == nil {
+			err = errors.New("it stopped before it was ready")
+		}
+		return forwardFailed(pod, err), nil
+	case <-ctx.Done():
+		return ProbeResult{}, ctx.Err()
+	case <-time.After(readyTimeout):
+		return forwardFailed(pod, fmt.Errorf("not ready within %s", readyTimeout)), nil
+	}
+
+	// find the local port we actually got, in case it was left up to the OS
+	ports, err := pf.GetPorts()
+	if err != nil {
+		return forwardFailed(pod, err), nil
+	}
+	if len(ports) == 0 {
+		return forwardFailed(pod, errors.New("it's ready but isn't listening on any local port")), nil
+	}
+	url := fmt.Sprintf("%s://localhost:%d%s", k.probeScheme, ports[0].Local, k.probePath)
+
+	probe, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	resp, err := k.probeClient().Do(probe)
+	// being interrupted or running out of time says nothing about the pod
+	if ctx.Err() != nil {
+		return ProbeResult{}, ctx.Err()
+	}
+	if err == nil {
+		resp.Body.Close()
+	}
+	return classifyProbe(resp, err), nil
+}
+
+// probeClient returns the client given WithHTTPClient, or else one that waits for the probe timeout
+func (k *Kubetrbl) probeClient() *http.Client {
+	if k.httpClient != nil {
+		return k.httpClient
+	}
+	httpClient := &http.Client{Timeout: k.probeTimeout}
+	if k.probeScheme == "https" {
+		// the certificate won't be for localhost since we're tunneling, so there's nothing to verify against
+		httpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	return httpClient
+}
+
+// lockedWriter serializes writes from the port-forwards of pods probed at once
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// isTLSError returns if err came from a failed TLS handshake, meaning something is listening but not speaking TLS
+// the way we expected
+func isTLSError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rerr tls.RecordHeaderError
+	if errors.As(err, &rerr) {
+		return true
+	}
+	// the transport answers a plain HTTP server with an error of its own rather than the RecordHeaderError
+	return strings.Contains(err.Error(), "tls: ") || strings.Contains(err.Error(), "server gave HTTP response to HTTPS client")
+}
+
+// promptedState is a state that prompted, with the checks made and whether any failed when it was entered
+type promptedState struct {
+	state  string
+	checks int
+	failed bool
+}
+
+// prompted records that a prompt was answered in the state entered last, so that back can return to it
+func (k *Kubetrbl) prompted() {
+	if n := len(k.prompts); n > 0 && k.prompts[n-1].state == k.entered.state {
+		return
+	}
+	k.prompts = append(k.prompts, k.entered)
+}
+
+// back returns to the last state before the active one that prompted, re-entering it so it re-fetches what it
+// offers. States in between that didn't prompt aren't entered on the way. The checks made since that state was
+// entered are forgotten, as they'll be made again; any already streamed as JSON lines can't be taken back.
+func (k *Kubetrbl) back() {
+	current := k.fsm.Current()
+	for n := len(k.prompts); n > 0 && k.prompts[n-1].state == current; n = len(k.prompts) {
+		k.prompts = k.prompts[:n-1]
+	}
+	if len(k.prompts) == 0 {
+		fmt.Fprintln(k.out, "Already at the first step.")
+		k.forgetChecks(k.entered)
+		k.fsm.ChangeWith(current, k.fsm.Context())
+		return
+	}
+	prev := k.prompts[len(k.prompts)-1]
+	k.prompts = k.prompts[:len(k.prompts)-1]
+	k.forgetChecks(prev)
+	k.fsm.BackTo(prev.state)
+}
+
+// forgetChecks drops the checks made since the state was entered
+func (k *Kubetrbl) forgetChecks(since promptedState) {
+	if since.checks < len(k.checks) {
+		k.checks = k.checks[:since.checks]
+	}
+	k.failed = since.failed
+}
+
+// inputLine is a line read from the input, or the error reading it
+type inputLine struct {
+	str string
+	err error
+}
+
+// readInput reads lines for readString until the process ends. There's only ever one, so a prompt given up on,
+// such as on an interrupt, leaves its line to the next rather than a reader of its own racing for the input.
+func (k *Kubetrbl) readInput() {
+	for {
+		str, err := k.reader.ReadString('\n')
+		k.lines <- inputLine{str, err}
+	}
+}
+
+// readString reads a line of input, returning ErrQuit when the user asked to quit
 func (k *Kubetrbl) readString() (string, error) {
-	str, err := k.reader.ReadString('\n')
+	// read in the background so an interrupt isn't stuck waiting on the user
+	k.readLines.Do(func() {
+		k.lines = make(chan inputLine)
+		go k.readInput()
+	})
+
+	select {
+	case l := <-k.lines:
+		// input that ends without a newline still answers this prompt; the next one gets ErrNoInput
+		if errors.Is(l.err, io.EOF) && l.str == "" {
+			return "", ErrNoInput
+		}
+		if l.err != nil && !errors.Is(l.err, io.EOF) {
+			return "", l.err
+		}
+		str := strings.TrimSpace(l.str)
+		// the user's typing isn't written to out, so the transcript needs it spelled out
+		if k.transcript != nil {
+			fmt.Fprintln(k.transcript, str)
+		}
+		switch strings.ToLower(str) {
+		case "q", "quit":
+			return "", ErrQuit
+		case "b", "back":
+			return "", ErrBack
+		}
+		k.prompted()
+		return str, nil
+	case <-k.ctx.Done():
+		return "", k.ctx.Err()
+	}
+}
+
+// menuPageSize is how many items we show at a time in a menu
+const menuPageSize = 20
+
+// chooseFromList shows a menu of the items a page at a time and returns the index of the one chosen, re-prompting
+// a few times when the answer isn't one
+func (k *Kubetrbl) chooseFromList(title, prompt string, items []string) (int, error) {
+	return k.chooseFromListDefault(title, prompt, items, -1)
+}
+
+// chooseFromListDefault works like chooseFromList, but answering with nothing chooses the item at index def, when
+// it's not -1
+func (k *Kubetrbl) chooseFromListDefault(title, prompt string, items []string, def int) (int, error) {
+	pages := (len(items) + menuPageSize - 1) / menuPageSize
+	page := 0
+	for attempt := 1; ; {
+		fmt.Fprintln(k.out, title)
+		start := page * menuPageSize
+		end := start + menuPageSize
+		if end > len(items) {
+			end = len(items)
+		}
+		for i := start; i < end; i++ {
+			fmt.Fprintln(k.out, strconv.Itoa(i)+") "+items[i])
+		}
+		if pages > 1 {
+			fmt.Fprintf(k.out, "Page %d of %d; n for the next page, p for the previous, b to go back, q to quit. ", page+1, pages)
+		}
+		fmt.Fprint(k.out, prompt)
+
+		str, err := k.readString()
+		if err != nil {
+			return 0, err
+		}
+		// with a single page, n and p are left to pick out items by name, like nginx
+		if pages > 1 {
+			switch strings.ToLower(str) {
+			case "n":
+				if page < pages-1 {
+					page++
+				}
+				continue
+			case "p":
+				if page > 0 {
+					page--
+				}
+				continue
+			}
+		}
+
+		if str == "" && def >= 0 {
+			return def, nil
+		}
+		answer, err := resolveChoice(items, str)
+		if err == nil {
+			return answer, nil
+		}
+		if attempt == maxAttempts {
+			return 0, err
+		}
+		attempt++
+		fmt.Fprintf(k.out, "%s; please enter a name or a number between 0 and %d.\n", err.Error(), len(items)-1)
+	}
+}
+
+// resolveChoice returns the index of the item the input picks out of a menu. Input that's a number is taken as
+// the index. Otherwise it's matched case-insensitively against the items, first exactly and then as the prefix
+// of a single item.
+func resolveChoice(items []string, input string) (int, error) {
+	if i, err := strconv.Atoi(input); err == nil {
+		if i < 0 || i >= len(items) {
+			return 0, fmt.Errorf("'%s' is not a number between 0 and %d", input, len(items)-1)
+		}
+		return i, nil
+	}
+
+	exact, prefixed := []int{}, []int{}
+	for i, item := range items {
+		if strings.EqualFold(item, input) {
+			exact = append(exact, i)
+		} else if input != "" && strings.HasPrefix(strings.ToLower(item), strings.ToLower(input)) {
+			prefixed = append(prefixed, i)
+		}
+	}
+	for _, matches := range [][]int{exact, prefixed} {
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return matches[0], nil
+		}
+		names := []string{}
+		for _, i := range matches {
+			names = append(names, items[i])
+		}
+		return 0, fmt.Errorf("'%s' could be any of %s", input, strings.Join(names, ", "))
+	}
+	return 0, fmt.Errorf("'%s' doesn't match anything listed", input)
+}
+
+// skipped moves on to next, skipping the check, when -only leaves out its category. It returns if it did.
+func (k *Kubetrbl) skipped(category, check, next string) bool {
+	if k.config.Runs(category) {
+		return false
+	}
+	k.skip(check, k.k8sContext.namespace, "Not checking %s, since -only leaves it out.", onlyDescriptions[category])
+	k.fsm.Change(next)
+	return true
+}
+
+// pass reports a check of target that found nothing wrong
+func (k *Kubetrbl) pass(name, target, format string, args ...interface{}) {
+	k.record(name, target, report.StatusPass, format, args...)
+}
+
+// fail reports a check of target that found a problem
+func (k *Kubetrbl) fail(name, target, format string, args ...interface{}) {
+	k.failed = true
+	k.record(name, target, report.StatusFail, format, args...)
+}
+
+// warn reports a check of target that found something that may be a problem
+func (k *Kubetrbl) warn(name, target, format string, args ...interface{}) {
+	k.record(name, target, report.StatusWarn, format, args...)
+}
+
+// dump prints obj as YAML when debugging, so it's clear what a diagnosis was based on
+func (k *Kubetrbl) dump(label string, obj interface{}) {
+	if !k.debug {
+		return
+	}
+	out, err := yaml.Marshal(obj)
 	if err != nil {
-		return "", err
+		fmt.Fprintf(k.out, "--- %s: %s\n", label, err.Error())
+		return
+	}
+	fmt.Fprintf(k.out, "--- %s\n%s", label, out)
+}
+
+// skip reports a check of target that couldn't be made
+func (k *Kubetrbl) skip(name, target, format string, args ...interface{}) {
+	k.record(name, target, report.StatusSkip, format, args...)
+}
+
+// record prints the outcome of a check and keeps it for the report
+func (k *Kubetrbl) record(name, target string, status report.Status, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	k.addCheck(name, target, status, msg)
+	fmt.Fprintln(k.out, k.theme.Marker(status)+" "+msg)
+}
+
+// addCheck keeps the result of the named check for the report, emitting it straight away when streaming
+func (k *Kubetrbl) addCheck(name, target string, status report.Status, msg string) {
+	result := report.NewCheckResult(name, categoryOf(name), target, status, msg)
+	k.checks = append(k.checks, result)
+	k.emit(result)
+}
+
+// emit writes the result as a line of JSON and flushes it, when the output is OutputJSONLines
+func (k *Kubetrbl) emit(result report.CheckResult) {
+	if k.config.Output != OutputJSONLines {
+		return
+	}
+	result.WriteJSONLine(k.reportOut)
+	if f, ok := k.reportOut.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+}
+
+// report gathers every check made so far
+func (k *Kubetrbl) report() report.Report {
+	r := report.Report{Checks: k.checks}
+	if k.k8sContext != nil {
+		r.Namespace = k.k8sContext.namespace
+		r.Service = k.k8sContext.svc.GetName()
+		if len(k.k8sContext.controllers) > 1 {
+			r.Controllers = map[string]string{}
+			for _, pod := range k.k8sContext.podList {
+				if c := controllerFor(pod, k.k8sContext.controllers); c != nil {
+					r.Controllers[pod.GetName()] = c.String()
+				}
+			}
+		}
+	}
+	return r
+}
+
+// interactive returns if we prompt for answers that weren't given up front
+func (k *Kubetrbl) interactive() bool {
+	return !k.config.NonInteractive()
+}
+
+// ask returns the answer given up front if there is one. Otherwise it prompts for an answer, unless we're not
+// interactive, in which case the answer is empty as if the user just hit enter.
+func (k *Kubetrbl) ask(given string, format string, args ...interface{}) (string, error) {
+	if given != "" {
+		return given, nil
+	}
+	if !k.interactive() {
+		return "", nil
 	}
-	return strings.TrimSpace(str), nil
+	fmt.Fprintf(k.out, format, args...)
+	return k.readString()
 }
 
-func (k *Kubetrbl) readInt() (int, error) {
-	str, err := k.readString()
+// localPortAnswer turns a local port given up front into an answer, where 0 means none was given
+func localPortAnswer(port int) string {
+	if port == 0 {
+		return ""
+	}
+	return strconv.Itoa(port)
+}
+
+// contains returns if s is one of items
+func contains(items []string, s string) bool {
+	for _, i := range items {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+// askYesNo asks a y/n question, returning def when the user just hits enter
+func (k *Kubetrbl) askYesNo(def bool, format string, args ...interface{}) (bool, error) {
+	str, err := k.ask("", format, args...)
 	if err != nil {
-		return 0, err
+		return false, err
+	}
+	switch strings.ToLower(str) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	case "n", "no":
+		return false, nil
 	}
-	return strconv.Atoi(str)
+	return false, fmt.Errorf("'%s' is not y or n", str)
 }
@@ -0,0 +1,2356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/caseyhadden/kubetrbl/report"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	fakerest "k8s.io/client-go/rest/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/portforward"
+)
+
+// testNamespace is where the fake cluster's objects live
+const testNamespace = "default"
+
+// answered answers every prompt up front, so a run needs no input
+var answered = Config{Namespace: testNamespace, Service: "web", Port: "http"}
+
+// troubleshoot runs from the state against a fake cluster holding objs, answering prompts from input, and returns
+// what was written along the way
+func troubleshoot(t *testing.T, cfg Config, state, input string, objs ...runtime.Object) (*Kubetrbl, string) {
+	t.Helper()
+	return troubleshootWith(t, cfg, state, input, &testClient{Clientset: fakeClient(objs...)})
+}
+
+// troubleshootWith works like troubleshoot against the given client
+func troubleshootWith(t *testing.T, cfg Config, state, input string, client kubernetes.Interface) (*Kubetrbl, string) {
+	t.Helper()
+	var out bytes.Buffer
+	k := NewKubetrblIO(context.Background(), cfg, strings.NewReader(input), &out)
+	k.k8sContext = NewK8sContextWithClient(client, cfg.Namespace)
+	k.Start(state)
+	return k, out.String()
+}
+
+// testClient is a fake clientset whose pods serve logs, which the plain fake can't
+type testClient struct {
+	*fake.Clientset
+	// logs are what each pod/container logged, and pod/container/previous what its previous instance did. A
+	// container without a previous instance has none to serve, as with the API server.
+	logs map[string]string
+	// hangServices has getting or listing services wait until the context is done, as an API server that's stuck
+	// would
+	hangServices bool
+	// hangPods does the same for listing pods
+	hangPods bool
+	// unreachable is what asking for the server's version fails with, as when the API server is down
+	unreachable error
+}
+
+func (c *testClient) CoreV1() typedcorev1.CoreV1Interface {
+	return testCoreV1{CoreV1Interface: c.Clientset.CoreV1(), client: c}
+}
+
+func (c *testClient) Discovery() discovery.DiscoveryInterface {
+	if c.unreachable != nil {
+		return unreachableDiscovery{DiscoveryInterface: c.Clientset.Discovery(), err: c.unreachable}
+	}
+	return c.Clientset.Discovery()
+}
+
+// unreachableDiscovery is a discovery client that can't get the server's version. The fake's ServerVersion always
+// succeeds.
+type unreachableDiscovery struct {
+	discovery.DiscoveryInterface
+	err error
+}
+
+func (d unreachableDiscovery) ServerVersion() (*version.Info, error) {
+	return nil, d.err
+}
+
+type testCoreV1 struct {
+	typedcorev1.CoreV1Interface
+	client *testClient
+}
+
+func (c testCoreV1) Pods(namespace string) typedcorev1.PodInterface {
+	return testPods{PodInterface: c.CoreV1Interface.Pods(namespace), client: c.client, namespace: namespace}
+}
+
+func (c testCoreV1) Services(namespace string) typedcorev1.ServiceInterface {
+	if c.client.hangServices {
+		return hungServices{c.CoreV1Interface.Services(namespace)}
+	}
+	return c.CoreV1Interface.Services(namespace)
+}
+
+type hungServices struct {
+	typedcorev1.ServiceInterface
+}
+
+func (hungServices) Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Service, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (hungServices) List(ctx context.Context, opts metav1.ListOptions) (*corev1.ServiceList, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+type testPods struct {
+	typedcorev1.PodInterface
+	client    *testClient
+	namespace string
+}
+
+func (p testPods) List(ctx context.Context, opts metav1.ListOptions) (*corev1.PodList, error) {
+	if p.client.hangPods {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return p.PodInterface.List(ctx, opts)
+}
+
+func (p testPods) GetLogs(name string, opts *corev1.PodLogOptions) *rest.Request {
+	// the fake records the action, so tests can see the options asked for
+	p.PodInterface.GetLogs(name, opts)
+	key := name + "/" + opts.Container
+	if opts.Previous {
+		key += "/previous"
+	}
+	logs, ok := p.client.logs[key]
+	rc := &fakerest.RESTClient{
+		GroupVersion:         corev1.SchemeGroupVersion,
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client: fakerest.CreateHTTPClient(func(*http.Request) (*http.Response, error) {
+			if !ok && opts.Previous {
+				msg := fmt.Sprintf("previous terminated container %q in pod %q not found", opts.Container, name)
+				return &http.Response{StatusCode: http.StatusBadRequest, Body: ioutil.NopCloser(strings.NewReader(msg))}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(logs))}, nil
+		}),
+	}
+	return rc.Get().Namespace(p.namespace).Resource("pods").Name(name).SubResource("log")
+}
+
+// fakeClient makes a fake clientset holding objs. Unlike the plain fake, it lists only the events the field
+// selector picks out, as the API server would.
+func fakeClient(objs ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objs...)
+	client.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selector := action.(k8stesting.ListAction).GetListRestrictions().Fields
+		obj, err := client.Tracker().List(corev1.SchemeGroupVersion.WithResource("events"), corev1.SchemeGroupVersion.WithKind("Event"), action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		list := obj.(*corev1.EventList)
+		evts := []corev1.Event{}
+		for _, e := range list.Items {
+			if selector.Matches(fields.Set{"involvedObject.kind": e.InvolvedObject.Kind, "involvedObject.name": e.InvolvedObject.Name}) {
+				evts = append(evts, e)
+			}
+		}
+		list.Items = evts
+		return true, list, nil
+	})
+	return client
+}
+
+// checksNamed returns the checks made with the name
+func checksNamed(k *Kubetrbl, name string) []report.CheckResult {
+	result := []report.CheckResult{}
+	for _, c := range k.checks {
+		if c.Name == name {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// wantCheck fails the test unless the named check was made of target with the status
+func wantCheck(t *testing.T, k *Kubetrbl, name, target string, status report.Status) report.CheckResult {
+	t.Helper()
+	for _, c := range checksNamed(k, name) {
+		if c.Target == target && c.Status == status {
+			return c
+		}
+	}
+	t.Errorf("no %s check of %s with status %s in %+v", name, target, status, k.checks)
+	return report.CheckResult{}
+}
+
+// testPod makes a pod of the web service in the phase, with a single container named app
+func testPod(name string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: map[string]string{"app": "web"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+// testService makes the web service, which sends its http port to the pods' port of the same name
+func testService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: testNamespace},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "web"},
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromString("http")}},
+		},
+	}
+}
+
+// testEndpoints makes the endpoints of the web service, with its http port on each of the ips
+func testEndpoints(ips ...string) *corev1.Endpoints {
+	eps := &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: testNamespace}}
+	if len(ips) == 0 {
+		return eps
+	}
+	subset := corev1.EndpointSubset{Ports: []corev1.EndpointPort{{Name: "http", Port: 8080}}}
+	for _, ip := range ips {
+		subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{IP: ip})
+	}
+	eps.Subsets = []corev1.EndpointSubset{subset}
+	return eps
+}
+
+// testTemplate is the pod template of the web service's controllers, whose app container serves http on 8080
+func testTemplate() corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "app",
+			Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+		}}},
+	}
+}
+
+// testDeployment makes a Deployment of the named pods, with the replicas all ready
+func testDeployment(name string, replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Generation: 1},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Template: testTemplate(),
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           replicas,
+			UpdatedReplicas:    replicas,
+			ReadyReplicas:      replicas,
+			AvailableReplicas:  replicas,
+		},
+	}
+}
+
+// testEvent makes an event about the named pod
+func testEvent(pod, reason, message string, at time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: pod + "." + reason, Namespace: testNamespace},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: pod, Namespace: testNamespace},
+		Type:           corev1.EventTypeWarning,
+		Reason:         reason,
+		Message:        message,
+		LastTimestamp:  metav1.NewTime(at),
+	}
+}
+
+func TestMatchesTargetPort(t *testing.T) {
+	named := corev1.ContainerPort{Name: "http", ContainerPort: 8080}
+	tests := []struct {
+		name string
+		tgt  intstr.IntOrString
+		port corev1.ContainerPort
+		want bool
+	}{
+		{"numeric", intstr.FromInt(8080), named, true},
+		{"named", intstr.FromString("http"), named, true},
+		{"other number", intstr.FromInt(80), named, false},
+		{"other name", intstr.FromString("metrics"), named, false},
+		{"number as name", intstr.FromString("8080"), named, false},
+		{"name of unnamed port", intstr.FromString("http"), corev1.ContainerPort{ContainerPort: 8080}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesTargetPort(tt.tgt, tt.port); got != tt.want {
+				t.Errorf("matchesTargetPort(%s, %+v) = %v, want %v", tt.tgt.String(), tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerPortFor(t *testing.T) {
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "app", Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}}},
+			{Name: "sidecar", Ports: []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9090}}},
+		}}}},
+	}
+	k := &Kubetrbl{k8sContext: &K8sContext{controller: NewController(d, appsv1.SchemeGroupVersion.WithKind("Deployment"))}}
+
+	tests := []struct {
+		name  string
+		tgt   intstr.IntOrString
+		want  int32
+		found bool
+	}{
+		{"numeric", intstr.FromInt(8080), 8080, true},
+		{"named in a later container", intstr.FromString("metrics"), 9090, true},
+		{"missing number", intstr.FromInt(80), 0, false},
+		{"missing name", intstr.FromString("grpc"), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, found := k.containerPortFor(tt.tgt)
+			if found != tt.found || p.ContainerPort != tt.want {
+				t.Errorf("containerPortFor(%s) = %d, %v, want %d, %v", tt.tgt.String(), p.ContainerPort, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+// probe makes the request checkPodPort would to url, once the port-forward is up
+func probe(k *Kubetrbl, url string) ProbeResult {
+	resp, err := k.probeClient().Get(url)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return classifyProbe(resp, err)
+}
+
+func TestClassifyProbe(t *testing.T) {
+	response := func(code int) *http.Response {
+		return &http.Response{StatusCode: code, Status: fmt.Sprintf("%d %s", code, http.StatusText(code))}
+	}
+	refused := &url.Error{Op: "Get", URL: "http://localhost:1234/", Err: syscallError("dial", syscall.ECONNREFUSED)}
+	timedOut := &url.Error{Op: "Get", URL: "http://localhost:1234/", Err: timeoutError{}}
+	tests := []struct {
+		name    string
+		resp    *http.Response
+		err     error
+		status  report.Status
+		message string
+	}{
+		{"refused", nil, refused, report.StatusFail, "Pod port inaccessible: " + refused.Error()},
+		{"timeout", nil, timedOut, report.StatusFail, "Pod port open but no response before the probe timed out."},
+		{"tls", nil, tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, report.StatusFail, "Pod port open, but the TLS handshake failed: tls: first record does not look like a TLS handshake"},
+		{"ok", response(http.StatusOK), nil, report.StatusPass, "Pod port accessible."},
+		{"no content", response(http.StatusNoContent), nil, report.StatusPass, "Pod port accessible."},
+		{"redirect", response(http.StatusFound), nil, report.StatusPass, "Pod port accessible."},
+		// an app wanting credentials is still reachable
+		{"unauthorized", response(http.StatusUnauthorized), nil, report.StatusPass, "Pod port accessible; the app responded 401 Unauthorized."},
+		{"forbidden", response(http.StatusForbidden), nil, report.StatusPass, "Pod port accessible; the app responded 403 Forbidden."},
+		{"not found", response(http.StatusNotFound), nil, report.StatusPass, "Pod port accessible; the app responded 404 Not Found."},
+		{"server error", response(http.StatusInternalServerError), nil, report.StatusWarn, "Pod port accessible, but the app is returning server errors (500 Internal Server Error)."},
+		{"unavailable", response(http.StatusServiceUnavailable), nil, report.StatusWarn, "Pod port accessible, but the app is returning server errors (503 Service Unavailable)."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := classifyProbe(tt.resp, tt.err)
+			if r.Status != tt.status || r.Message != tt.message {
+				t.Errorf("classifyProbe = %s: %q, want %s: %q", r.Status, r.Message, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+// countingTransport is an http.RoundTripper that counts the requests it makes
+type countingTransport struct {
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	codes := map[string]int{"/": http.StatusOK, "/moved": http.StatusFound, "/private": http.StatusUnauthorized, "/broken": http.StatusBadGateway}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			w.Header().Set("Location", "/private")
+		}
+		w.WriteHeader(codes[r.URL.Path])
+	}))
+	defer server.Close()
+	transport := &countingTransport{}
+	// a client that doesn't follow redirects shows what the app itself answered
+	client := &http.Client{Transport: transport, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	k := NewKubetrblIO(context.Background(), Config{}, strings.NewReader(""), ioutil.Discard, WithHTTPClient(client))
+	// even an https probe, which would otherwise skip verifying, is left to the client given
+	k.probeScheme = "https"
+	if got := k.probeClient(); got != client {
+		t.Fatalf("probeClient = %v, want the client given", got)
+	}
+
+	tests := []struct {
+		path   string
+		status report.Status
+	}{
+		{"/", report.StatusPass},
+		{"/moved", report.StatusPass},
+		{"/private", report.StatusPass},
+		{"/broken", report.StatusWarn},
+	}
+	for _, tt := range tests {
+		if r := probe(k, server.URL+tt.path); r.Status != tt.status {
+			t.Errorf("probing %s got %s: %s, want %s", tt.path, r.Status, r.Message, tt.status)
+		}
+	}
+	if transport.requests != len(tests) {
+		t.Errorf("the client given made %d requests, want %d", transport.requests, len(tests))
+	}
+
+	server.Close()
+	if r := probe(k, server.URL); r.Status != report.StatusFail || !strings.Contains(r.Message, "Pod port inaccessible") {
+		t.Errorf("probing a closed server got %s: %s, want it inaccessible", r.Status, r.Message)
+	}
+}
+
+func TestProbeHTTPS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tlsServer := httptest.NewTLSServer(ok)
+	defer tlsServer.Close()
+	plainServer := httptest.NewServer(ok)
+	defer plainServer.Close()
+
+	k := &Kubetrbl{probeScheme: "https", probeTimeout: defaultProbeTimeout}
+	// the test server's certificate is self-signed, as one behind a port-forward wouldn't be for localhost
+	if r := probe(k, tlsServer.URL); r.Status != report.StatusPass {
+		t.Errorf("probing https got %s: %s", r.Status, r.Message)
+	}
+	r := probe(k, strings.Replace(plainServer.URL, "http:", "https:", 1))
+	if r.Status != report.StatusFail || !strings.Contains(r.Message, "TLS handshake failed") {
+		t.Errorf("probing plain http over https got %s: %s, want a failed TLS handshake", r.Status, r.Message)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	k := &Kubetrbl{probeScheme: "http", probeTimeout: 50 * time.Millisecond}
+	start := time.Now()
+	r := probe(k, slow.URL)
+	if r.Status != report.StatusFail || !strings.Contains(r.Message, "timed out") {
+		t.Errorf("probing a slow server got %s: %s, want a timeout", r.Status, r.Message)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("probe took %s despite its %s timeout", elapsed, k.probeTimeout)
+	}
+}
+
+func TestDiagnosePendingPods(t *testing.T) {
+	now := time.Now()
+	k, out := troubleshoot(t, answered, "countPods", "",
+		testPod("web-1", corev1.PodPending),
+		testPod("web-2", corev1.PodPending),
+		testEvent("web-1", "FailedScheduling", "0/3 nodes are available: 3 Insufficient cpu.", now),
+	)
+
+	wantCheck(t, k, checkPendingPods, "web-1", report.StatusFail)
+	wantCheck(t, k, checkPendingPods, "web-2", report.StatusFail)
+	c := wantCheck(t, k, checkPodScheduling, "web-1", report.StatusFail)
+	if !strings.Contains(c.Message, "Insufficient cpu") {
+		t.Errorf("scheduling check said %q, want the event's message", c.Message)
+	}
+	wantCheck(t, k, checkPodScheduling, "web-2", report.StatusWarn)
+	if k.fsm.Current() != "finish" {
+		t.Errorf("ended in %q, want finish\n%s", k.fsm.Current(), out)
+	}
+}
+
+func TestDiagnoseNonrunningPods(t *testing.T) {
+	pulling := testPod("web-1", corev1.PodPending)
+	pulling.Spec.NodeName = "node-1"
+	pulling.Status.ContainerStatuses = []corev1.ContainerStatus{waiting("app", "ImagePullBackOff", `Back-off pulling image "web:nope"`)}
+	evicted := testPod("web-2", corev1.PodFailed)
+	evicted.Status.Reason, evicted.Status.Message = "Evicted", "The node was low on resource: memory."
+	done := testPod("web-3", corev1.PodSucceeded)
+	// nothing is pending, so the run gets as far as the containers
+	cfg := answered
+	cfg.Only = []string{onlyRunning}
+
+	k, out := troubleshoot(t, cfg, "countPods", "", pulling, evicted, done)
+
+	wantCheck(t, k, checkRunningPods, "web-1", report.StatusFail)
+	wantCheck(t, k, checkContainerStatus, "web-1/app", report.StatusFail)
+	if !strings.Contains(out, "the image can't be pulled") {
+		t.Errorf("no hint for the image pull in\n%s", out)
+	}
+	c := wantCheck(t, k, checkPodStatus, "web-2", report.StatusFail)
+	if !strings.Contains(c.Message, "Evicted") {
+		t.Errorf("pod status check said %q, want the reason it failed", c.Message)
+	}
+	wantCheck(t, k, checkPodStatus, "web-3", report.StatusPass)
+	if k.fsm.Current() != "finish" {
+		t.Errorf("ended in %q, want finish", k.fsm.Current())
+	}
+}
+
+// notReady makes the Ready condition of a pod that isn't
+func notReady(reason, message string) corev1.PodCondition {
+	return corev1.PodCondition{Type: corev1.PodReady, Status: corev1.ConditionFalse, Reason: reason, Message: message}
+}
+
+func TestDiagnoseNotReadyPods(t *testing.T) {
+	pod := testPod("web-1", corev1.PodRunning)
+	pod.Spec.Containers = []corev1.Container{{Name: "app", ReadinessProbe: httpProbe("/ready", intstr.FromInt(8080))}}
+	pod.Status.Conditions = []corev1.PodCondition{notReady("ContainersNotReady", "containers with unready status: [app]")}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app", Ready: false}}
+	ready := testPod("web-2", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	unscheduled := testPod("web-3", corev1.PodPending)
+	unscheduled.Spec.Containers = pod.Spec.Containers
+	unscheduled.Status.Conditions = []corev1.PodCondition{
+		{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable, Message: "0/3 nodes are available: 3 Insufficient cpu."},
+		notReady("", ""),
+	}
+	cfg := answered
+	cfg.Only = []string{onlyReady}
+
+	k, _ := troubleshoot(t, cfg, "countPods", "", pod, ready, unscheduled)
+
+	wantCheck(t, k, checkReadyPods, "web-1", report.StatusFail)
+	c := wantCheck(t, k, checkPodReadiness, "web-1", report.StatusFail)
+	if !strings.Contains(c.Message, "Ready is False (ContainersNotReady): containers with unready status: [app]") {
+		t.Errorf("readiness check said %q, want the Ready condition's reason and message", c.Message)
+	}
+	c = wantCheck(t, k, checkReadinessProbe, "web-1/app", report.StatusFail)
+	if !strings.Contains(c.Message, "HTTP GET http:8080/ready") {
+		t.Errorf("readiness probe check said %q, want the probe", c.Message)
+	}
+	if len(checksNamed(k, checkReadinessProbe)) != 1 {
+		t.Errorf("checked readiness probes %+v, want only web-1's", checksNamed(k, checkReadinessProbe))
+	}
+
+	c = wantCheck(t, k, checkPodReadiness, "web-3", report.StatusFail)
+	if want := "Pod 'web-3' is not ready because it isn't scheduled: PodScheduled is False (Unschedulable): 0/3 nodes are available: 3 Insufficient cpu.; Ready is False"; c.Message != want {
+		t.Errorf("readiness check said %q, want %q", c.Message, want)
+	}
+}
+
+func TestReadyStatus(t *testing.T) {
+	tests := []struct {
+		ready, total, threshold int
+		want                    report.Status
+	}{
+		{10, 10, 100, report.StatusPass},
+		{9, 10, 100, report.StatusFail},
+		{8, 10, 80, report.StatusWarn},
+		{7, 10, 80, report.StatusFail},
+		// 79.9% ready is short of 80%
+		{799, 1000, 80, report.StatusFail},
+		{4, 5, 80, report.StatusWarn},
+		{3, 4, 80, report.StatusFail},
+		// no pods are all of them
+		{0, 0, 100, report.StatusPass},
+		{0, 10, 1, report.StatusFail},
+		{1, 100, 1, report.StatusWarn},
+	}
+	for _, tt := range tests {
+		if got := readyStatus(tt.ready, tt.total, tt.threshold); got != tt.want {
+			t.Errorf("readyStatus(%d of %d at %d%%) = %s, want %s", tt.ready, tt.total, tt.threshold, got, tt.want)
+		}
+	}
+
+	for given, want := range map[int]int{0: 100, -5: 100, 101: 100, 80: 80, 100: 100, 1: 1} {
+		k := &Kubetrbl{config: Config{ReadyThreshold: given}}
+		if got := k.readyThreshold(); got != want {
+			t.Errorf("readyThreshold of %d = %d, want %d", given, got, want)
+		}
+	}
+}
+
+func TestPodsOf(t *testing.T) {
+	canary := trackDeployment("canary")
+	stable := testPod("web-stable-1", corev1.PodRunning)
+	stable.Labels["track"] = "stable"
+	pods := []corev1.Pod{*stable, *testPod("web-1", corev1.PodRunning)}
+	pods[1].Labels["track"] = "canary"
+
+	if got := podNames(podsOf(NewController(canary, appsv1.SchemeGroupVersion.WithKind("Deployment")), pods), func(corev1.Pod) bool { return true }); !reflect.DeepEqual(got, []string{"web-1"}) {
+		t.Errorf("podsOf the canary = %v, want only its pod", got)
+	}
+	// a controller owning none of the pods leaves them all to check
+	api := testDeployment("api", 1)
+	api.Spec.Selector.MatchLabels["app"] = "api"
+	if got := podsOf(NewController(api, appsv1.SchemeGroupVersion.WithKind("Deployment")), pods); len(got) != 2 {
+		t.Errorf("podsOf a controller owning none = %d pods, want all 2", len(got))
+	}
+}
+
+func TestReadyThreshold(t *testing.T) {
+	objs := []runtime.Object{}
+	for i := 1; i <= 5; i++ {
+		pod := testPod(fmt.Sprintf("web-%d", i), corev1.PodRunning)
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		if i == 5 {
+			pod.Status.Conditions = []corev1.PodCondition{notReady("ContainersNotReady", "containers with unready status: [app]")}
+		}
+		objs = append(objs, pod)
+	}
+	run := func(threshold int) (*Kubetrbl, string) {
+		cfg := answered
+		cfg.Only = []string{onlyReady}
+		cfg.ReadyThreshold = threshold
+		return troubleshoot(t, cfg, "countPods", "", objs...)
+	}
+
+	// 4 of 5 is 80%
+	k, out := run(80)
+	wantCheck(t, k, checkReadyPods, "web-5", report.StatusWarn)
+	if !strings.Contains(out, "  4 of 5 pods are ready, within the 80% threshold.\n") || strings.Contains(out, "containers with unready status") {
+		t.Errorf("didn't carry on within the threshold:\n%s", out)
+	}
+	if got := checksNamed(k, checkReadyPods); len(got) != 1 {
+		t.Errorf("ready checks %+v, want only web-5's warning", got)
+	}
+
+	k, out = run(81)
+	wantCheck(t, k, checkReadyPods, "web-5", report.StatusFail)
+	if !strings.Contains(out, "  4 of 5 pods are ready, short of the 81% threshold.\n") {
+		t.Errorf("didn't say how far short of the threshold:\n%s", out)
+	}
+
+	// by default every pod has to be ready
+	k, out = run(0)
+	wantCheck(t, k, checkReadyPods, "web-5", report.StatusFail)
+	if strings.Contains(out, "threshold") {
+		t.Errorf("mentioned a threshold that wasn't given:\n%s", out)
+	}
+}
+
+func TestCheckCrashLoopingPods(t *testing.T) {
+	pod := testPod("web-1", corev1.PodRunning)
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", 14, 137, "OOMKilled")}
+	cfg := answered
+	cfg.Only = []string{onlyRunning}
+
+	k, out := troubleshoot(t, cfg, "countPods", "", pod)
+
+	c := wantCheck(t, k, checkCrashLoopingPods, "web-1/app", report.StatusFail)
+	if want := "restarted 14 times, last exit code 137 (OOMKilled)"; !strings.Contains(c.Message, want) {
+		t.Errorf("crash loop check said %q, want it to say %q", c.Message, want)
+	}
+	if !strings.Contains(out, "ran out of memory") {
+		t.Errorf("OOMKilled wasn't called out in\n%s", out)
+	}
+}
+
+func TestDiagnosePod(t *testing.T) {
+	pod := testPod("web-1", corev1.PodRunning)
+	pod.Status.Conditions = []corev1.PodCondition{notReady("ContainersNotReady", "containers with unready status: [app]")}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{waiting("app", "CrashLoopBackOff", "back-off 5m0s restarting failed container")}
+	cfg := Config{Namespace: testNamespace, Pod: "web-1"}
+	objs := []runtime.Object{testNamespaceObject(), pod, testPod("web-2", corev1.PodPending), testEvent("web-1", "BackOff", "Back-off restarting failed container", time.Now())}
+
+	k, out := troubleshoot(t, cfg, "getNamespace", "", objs...)
+
+	wantCheck(t, k, checkPodStatus, "web-1", report.StatusPass)
+	c := wantCheck(t, k, checkPodReadiness, "web-1", report.StatusFail)
+	if !strings.Contains(c.Message, "Ready is False (ContainersNotReady)") {
+		t.Errorf("readiness check said %q", c.Message)
+	}
+	c = wantCheck(t, k, checkContainerStatus, "web-1/app", report.StatusFail)
+	if !strings.Contains(c.Message, "is waiting (CrashLoopBackOff)") {
+		t.Errorf("container check said %q", c.Message)
+	}
+	if !strings.Contains(out, "Recent events for pod 'web-1':\n  Warning BackOff: Back-off restarting failed container\n") {
+		t.Errorf("didn't show the pod's events:\n%s", out)
+	}
+	// only the pod asked about is diagnosed, without listing the rest
+	for _, c := range k.checks {
+		if c.Target != "web-1" && !strings.HasPrefix(c.Target, "web-1/") {
+			t.Errorf("checked %+v, which isn't about web-1", c)
+		}
+	}
+
+	cfg.Pod = "web-9"
+	k, out = troubleshoot(t, cfg, "getNamespace", "", objs...)
+	wantCheck(t, k, checkError, "diagnosePod", report.StatusFail)
+	if !strings.Contains(out, "pod 'web-9' not found in namespace 'default'\n") {
+		t.Errorf("didn't say the pod wasn't found:\n%s", out)
+	}
+}
+
+func TestCheckLivenessRestarts(t *testing.T) {
+	live := httpProbe("/healthz", intstr.FromInt(8080))
+	live.TimeoutSeconds, live.FailureThreshold = 1, 3
+	killed := testPod("web-1", corev1.PodRunning)
+	killed.Spec.Containers = []corev1.Container{{Name: "app", LivenessProbe: live}}
+	killed.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", 2, 137, "Error")}
+	oom := testPod("web-2", corev1.PodRunning)
+	oom.Spec.Containers = killed.Spec.Containers
+	oom.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", 1, 137, "OOMKilled")}
+	cfg := answered
+	cfg.Only = []string{onlyRunning}
+
+	k, out := troubleshoot(t, cfg, "countPods", "", killed, oom)
+
+	// too few restarts to be crash looping, but still worth pointing at the probe
+	if len(checksNamed(k, checkCrashLoopingPods)) != 1 {
+		t.Errorf("crash loop checks %+v, want only the pass", checksNamed(k, checkCrashLoopingPods))
+	}
+	c := wantCheck(t, k, checkLivenessProbe, "web-1/app", report.StatusWarn)
+	if want := "Pod 'web-1' container 'app' restarted 2 times and has a liveness probe: " + describeProbe(live); c.Message != want {
+		t.Errorf("liveness check said %q, want %q", c.Message, want)
+	}
+	wantCheck(t, k, checkLivenessProbe, "web-2/app", report.StatusWarn)
+	// running out of memory is why web-2 was killed, not its probe
+	if got := strings.Count(out, "which is what a failing liveness probe does"); got != 1 {
+		t.Errorf("blamed the liveness probe for %d kills, want only web-1's:\n%s", got, out)
+	}
+}
+
+func TestCrashLogs(t *testing.T) {
+	pod := testPod("web-1", corev1.PodRunning)
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", 5, 1, "Error")}
+	client := &testClient{Clientset: fakeClient(pod), logs: map[string]string{
+		"web-1/app":          "starting\n",
+		"web-1/app/previous": "panic: nil pointer dereference\n",
+	}}
+	cfg := Config{Namespace: testNamespace, Only: []string{onlyRunning}}
+
+	tests := []struct {
+		name, input, want, notWant string
+	}{
+		{"previous by default", "\n\n\n", "panic: nil pointer dereference", "starting"},
+		{"current", "\nc\n5\n", "starting", "panic"},
+		{"skipped", "\nn\n", "", "panic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, out := troubleshootWith(t, cfg, "countPods", tt.input, client)
+			if !strings.Contains(out, tt.want) || strings.Contains(out, tt.notWant) {
+				t.Errorf("answering %q printed\n%s\nwant %q and not %q", tt.input, out, tt.want, tt.notWant)
+			}
+		})
+	}
+
+	var tails []int64
+	for _, a := range client.Actions() {
+		if a.GetSubresource() == "log" {
+			tails = append(tails, *a.(k8stesting.GenericAction).GetValue().(*corev1.PodLogOptions).TailLines)
+		}
+	}
+	if want := []int64{defaultLogLines, 5}; !reflect.DeepEqual(tails, want) {
+		t.Errorf("asked for %v lines of logs, want %v", tails, want)
+	}
+}
+
+func TestCheckServiceEndpoints(t *testing.T) {
+	cfg := answered
+	cfg.Only = []string{onlyEndpoints}
+
+	k, _ := troubleshoot(t, cfg, "countPods", "", testService(), testEndpoints("10.0.0.1", "10.0.0.2"), testPod("web-1", corev1.PodRunning))
+	c := wantCheck(t, k, checkServiceEndpoints, "web", report.StatusPass)
+	if !strings.Contains(c.Message, "2 endpoints: 10.0.0.1:8080, 10.0.0.2:8080") {
+		t.Errorf("endpoints check said %q, want the addresses", c.Message)
+	}
+
+	k, out := troubleshoot(t, cfg, "countPods", "", testService(), testEndpoints(), testPod("web-1", corev1.PodRunning))
+	wantCheck(t, k, checkServiceEndpoints, "web", report.StatusFail)
+	if !strings.Contains(out, "the selector doesn't match the labels") {
+		t.Errorf("no explanation of the missing endpoints in\n%s", out)
+	}
+	// without anyone to ask, we carry on to the selector
+	wantCheck(t, k, checkServiceSelector, "web", report.StatusPass)
+
+	asked := Config{Namespace: testNamespace, Service: "web", Only: cfg.Only}
+	k, _ = troubleshoot(t, asked, "countPods", "\nhttp\nn\n", testService(), testEndpoints(), testPod("web-1", corev1.PodRunning))
+	if got := checksNamed(k, checkServiceSelector); len(got) != 0 {
+		t.Errorf("checked the selector after being told not to: %+v", got)
+	}
+}
+
+func TestCheckServiceSelector(t *testing.T) {
+	svc := testService()
+	svc.Spec.Selector["tier"] = "frontend"
+	cfg := answered
+	cfg.Only = []string{onlyEndpoints}
+
+	k, out := troubleshoot(t, cfg, "countPods", "", svc, testEndpoints(), testPod("web-1", corev1.PodRunning))
+
+	c := wantCheck(t, k, checkServiceSelector, "web", report.StatusFail)
+	if !strings.Contains(c.Message, "'app=web,tier=frontend' matches no pods") {
+		t.Errorf("selector check said %q, want the whole selector", c.Message)
+	}
+	if !strings.Contains(out, "web-1: app=web") {
+		t.Errorf("the pods' labels weren't shown to compare in\n%s", out)
+	}
+	if k.fsm.Current() != "finish" {
+		t.Errorf("ended in %q, want finish", k.fsm.Current())
+	}
+}
+
+// trackDeployment makes one of two Deployments of the web pods, told apart by their track label
+func trackDeployment(track string) *appsv1.Deployment {
+	d := testDeployment("web-"+track, 1)
+	d.Spec.Selector.MatchLabels["track"] = track
+	d.Spec.Template.Labels["track"] = track
+	return d
+}
+
+func TestMultipleControllers(t *testing.T) {
+	ready := func(name, track string) *corev1.Pod {
+		pod := testPod(name, corev1.PodRunning)
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		if track != "" {
+			pod.Labels["track"] = track
+		}
+		return pod
+	}
+	canary := trackDeployment("canary")
+	// the canary's rollout is stuck, which would be missed checking only the first Deployment
+	canary.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"}}
+	cfg := answered
+	cfg.Only = []string{onlyEndpoints}
+
+	k, out := troubleshoot(t, cfg, "getNamespace", "", testNamespaceObject(), testService(), testEndpoints("10.0.0.1", "10.0.0.2", "10.0.0.3"),
+		trackDeployment("stable"), canary, ready("web-stable-1", "stable"), ready("web-canary-1", "canary"), ready("web-manual", ""))
+
+	c := wantCheck(t, k, checkController, "web", report.StatusPass)
+	if !strings.HasPrefix(c.Message, "Found 2 backing controllers - ") || !strings.Contains(c.Message, "Deployment/web-stable") || !strings.Contains(c.Message, "Deployment/web-canary") {
+		t.Errorf("controller check said %q, want both Deployments", c.Message)
+	}
+	wantCheck(t, k, checkRollout, "web-stable", report.StatusPass)
+	wantCheck(t, k, checkRollout, "web-canary", report.StatusFail)
+	// the pods of both are checked, and one neither owns is called out
+	for _, want := range []string{"  Pod 'web-stable-1' belongs to Deployment 'web-stable'.\n", "  Pod 'web-canary-1' belongs to Deployment 'web-canary'.\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("didn't attribute the pod with %q:\n%s", want, out)
+		}
+	}
+	if len(k.k8sContext.podList) != 3 {
+		t.Errorf("checked pods %v, want all 3 the service selects", podNames(k.k8sContext.podList, func(corev1.Pod) bool { return true }))
+	}
+	wantCheck(t, k, checkController, "web-manual", report.StatusWarn)
+
+	want := map[string]string{"web-stable-1": "Deployment/web-stable", "web-canary-1": "Deployment/web-canary"}
+	if got := k.report().Controllers; !reflect.DeepEqual(got, want) {
+		t.Errorf("report attributes pods %v, want %v", got, want)
+	}
+
+	// a single controller's pods need no attributing
+	k, out = troubleshoot(t, cfg, "getNamespace", "", testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), testDeployment("web", 1), ready("web-1", ""))
+	if strings.Contains(out, "belongs to") || k.report().Controllers != nil {
+		t.Errorf("attributed the pods of the only controller: %v\n%s", k.report().Controllers, out)
+	}
+}
+
+func TestResolveChoice(t *testing.T) {
+	items := []string{"nginx", "nginx-canary", "postgres", "Redis"}
+	tests := []struct {
+		input string
+		want  int
+		err   string
+	}{
+		{"0", 0, ""},
+		{"3", 3, ""},
+		{"4", 0, "'4' is not a number between 0 and 3"},
+		{"-1", 0, "'-1' is not a number between 0 and 3"},
+		{"nginx", 0, ""},
+		{"NGINX-canary", 1, ""},
+		{"redis", 3, ""},
+		{"post", 2, ""},
+		{"nginx-", 1, ""},
+		{"ng", 0, "'ng' could be any of nginx, nginx-canary"},
+		{"mysql", 0, "'mysql' doesn't match anything listed"},
+		{"", 0, "'' doesn't match anything listed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := resolveChoice(items, tt.input)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("resolveChoice(%q) = %d, %v, want error %q", tt.input, got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("resolveChoice(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// testNamespaceObject makes the namespace the fake cluster's objects live in
+func testNamespaceObject() *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}, Status: corev1.NamespaceStatus{Phase: corev1.NamespaceActive}}
+}
+
+// testRESTConfig is enough of a rest.Config to build a port-forward's dialer with, though nothing answers at its host
+func testRESTConfig() *rest.Config {
+	return &rest.Config{Host: "http://127.0.0.1:1", APIPath: "/api", ContentConfig: rest.ContentConfig{GroupVersion: &corev1.SchemeGroupVersion, NegotiatedSerializer: scheme.Codecs.WithoutConversion()}}
+}
+
+// fakeForwarder stands in for the port-forward to a pod, "forwarding" to the local port of a server answering for
+// the pod until it's stopped
+type fakeForwarder struct {
+	f     *forwarding
+	pod   string
+	stop  <-chan struct{}
+	ready chan struct{}
+	local uint16
+	// done is closed once ForwardPorts returns
+	done chan struct{}
+}
+
+func (pf *fakeForwarder) ForwardPorts() error {
+	defer close(pf.done)
+	if err := pf.f.fail[pf.pod]; err != nil {
+		return err
+	}
+	pf.f.enter()
+	defer pf.f.leave()
+	if pf.f.gate != nil {
+		select {
+		case <-pf.f.gate:
+		case <-pf.stop:
+			return nil
+		}
+	}
+	close(pf.ready)
+	<-pf.stop
+	return nil
+}
+
+func (pf *fakeForwarder) GetPorts() ([]portforward.ForwardedPort, error) {
+	if pf.local == 0 {
+		return nil, nil
+	}
+	return []portforward.ForwardedPort{{Local: pf.local, Remote: 8080}}, nil
+}
+
+// forwarding stands in for the port-forwards of a run
+type forwarding struct {
+	t *testing.T
+	// servers answer for each pod's port; a pod without one has its port-forward listen on no local port
+	servers map[string]*httptest.Server
+	// fail is what each pod's port-forward fails with before it's ready
+	fail map[string]error
+	// gate, when set, holds the port-forwards back from being ready until it's closed
+	gate chan struct{}
+
+	mu         sync.Mutex
+	forwarders []*fakeForwarder
+	// active is how many port-forwards are waiting to be ready or being probed, and most the highest it's been
+	active, most int
+}
+
+// newForwarding stands in for the port-forwards of the run, with each pod answered by the handler
+func newForwarding(t *testing.T, k *Kubetrbl, handlers map[string]http.HandlerFunc) *forwarding {
+	f := &forwarding{t: t, servers: map[string]*httptest.Server{}, fail: map[string]error{}}
+	for pod, h := range handlers {
+		server := httptest.NewServer(h)
+		t.Cleanup(server.Close)
+		f.servers[pod] = server
+	}
+	k.k8sContext.config = testRESTConfig()
+	k.newPortForwarder = f.newPortForwarder
+	return f
+}
+
+func (f *forwarding) newPortForwarder(pod corev1.Pod, _ httpstream.Dialer, _ []string, stop <-chan struct{}, ready chan struct{}, _, _ io.Writer) (portForwarder, error) {
+	pf := &fakeForwarder{f: f, pod: pod.Name, stop: stop, ready: ready, done: make(chan struct{})}
+	if server, ok := f.servers[pod.Name]; ok {
+		u, err := url.Parse(server.URL)
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		port, err := strconv.Atoi(u.Port())
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		pf.local = uint16(port)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.forwarders = append(f.forwarders, pf)
+	return pf, nil
+}
+
+func (f *forwarding) enter() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.active++
+	if f.active > f.most {
+		f.most = f.active
+	}
+}
+
+func (f *forwarding) leave() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.active--
+}
+
+// pods returns the pods port-forwarded to, in the order the port-forwards were made
+func (f *forwarding) pods() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pods := []string{}
+	for _, pf := range f.forwarders {
+		pods = append(pods, pf.pod)
+	}
+	return pods
+}
+
+// answering is a pod's server that answers every request with the status
+func answering(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	run := func(dryRun bool) (*Kubetrbl, int) {
+		cfg := answered
+		cfg.DryRun = dryRun
+		var out bytes.Buffer
+		k := NewKubetrblIO(context.Background(), cfg, strings.NewReader(""), &out)
+		k.k8sContext = NewK8sContextWithClient(fakeClient(testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), ready, testDeployment("web", 1)), testNamespace)
+		// pods are probed at once
+		f := newForwarding(t, k, map[string]http.HandlerFunc{"web-1": answering(http.StatusOK)})
+		k.Start("getNamespace")
+		return k, len(f.pods())
+	}
+
+	k, forwards := run(true)
+	if forwards != 0 {
+		t.Errorf("dry run started %d port-forwards", forwards)
+	}
+	c := wantCheck(t, k, checkPodPort, "web-1", report.StatusSkip)
+	if want := "Dry run: would forward localhost:0 -> web-1:8080 and GET http://localhost/"; c.Message != want {
+		t.Errorf("port check said %q, want %q", c.Message, want)
+	}
+	wantCheck(t, k, checkPodPort, "svc/web", report.StatusSkip)
+	// the read-only checks are still made
+	wantCheck(t, k, checkServiceEndpoints, "web", report.StatusPass)
+	wantCheck(t, k, checkContainerPort, "web", report.StatusPass)
+
+	// without it, the same run does port-forward
+	if _, forwards := run(false); forwards == 0 {
+		t.Errorf("the run without -dry-run didn't port-forward, so the dry run shows nothing")
+	}
+}
+
+func TestOnlyPort(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	cfg := answered
+	cfg.Only = []string{onlyPort}
+	var out bytes.Buffer
+	k := NewKubetrblIO(context.Background(), cfg, strings.NewReader(""), &out)
+	// a pending pod that isn't diagnosed, since the pod checks are left out
+	k.k8sContext = NewK8sContextWithClient(fakeClient(testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), ready, testPod("web-2", corev1.PodPending), testDeployment("web", 1)), testNamespace)
+	f := newForwarding(t, k, map[string]http.HandlerFunc{"web-1": answering(http.StatusOK)})
+	// the API server won't forward to a pod that isn't running
+	f.fail["web-2"] = errors.New("unable to upgrade connection: pod web-2 is not running")
+
+	k.Start("getNamespace")
+
+	if got := f.pods(); len(got) != 3 {
+		t.Errorf("-only port forwarded to %v, want both pods and the service probed:\n%s", got, out.String())
+	}
+	for _, name := range []string{checkPendingPods, checkRunningPods, checkCrashLoopingPods, checkReadyPods, checkServiceEndpoints} {
+		checks := checksNamed(k, name)
+		if len(checks) != 1 || checks[0].Status != report.StatusSkip || !strings.Contains(checks[0].Message, "since -only leaves it out") {
+			t.Errorf("%s checks %+v, want it skipped", name, checks)
+		}
+	}
+	// the pending pod's port is found inaccessible, rather than failing the run
+	wantCheck(t, k, checkPodPort, "web-1", report.StatusPass)
+	if c := wantCheck(t, k, checkPodPort, "web-2", report.StatusFail); !strings.Contains(c.Message, "pod web-2 is not running") {
+		t.Errorf("pending pod's port check said %q", c.Message)
+	}
+	wantCheck(t, k, checkPodPort, "svc/web", report.StatusPass)
+	if !strings.Contains(out.String(), "Port 8080 isn't accessible on 1 of 2 pods: web-2\n") {
+		t.Errorf("didn't say the pending pod's port is inaccessible:\n%s", out.String())
+	}
+	// finding the port to probe still takes the service's checks
+	wantCheck(t, k, checkContainerPort, "web", report.StatusPass)
+}
+
+func TestPortForwardFails(t *testing.T) {
+	objs := []runtime.Object{testNamespaceObject(), testService(), testEndpoints("10.0.0.1", "10.0.0.2"), testDeployment("web", 2)}
+	for _, name := range []string{"web-1", "web-2"} {
+		pod := testPod(name, corev1.PodRunning)
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		objs = append(objs, pod)
+	}
+	var out bytes.Buffer
+	k := NewKubetrblIO(context.Background(), answered, strings.NewReader(""), &out)
+	k.k8sContext = NewK8sContextWithClient(fakeClient(objs...), testNamespace)
+	f := newForwarding(t, k, map[string]http.HandlerFunc{"web-1": answering(http.StatusOK), "web-2": answering(http.StatusOK)})
+	f.fail["web-1"] = errors.New("error upgrading connection: container not found")
+
+	k.Start("getNamespace")
+
+	// the pod whose port-forward failed is inaccessible, without keeping the other from being probed
+	if c := wantCheck(t, k, checkPodPort, "web-1", report.StatusFail); c.Message != "Pod port inaccessible: port-forward to pod 'web-1' failed: error upgrading connection: container not found" {
+		t.Errorf("port check said %q", c.Message)
+	}
+	wantCheck(t, k, checkPodPort, "web-2", report.StatusPass)
+	if !strings.Contains(out.String(), "Port 8080 isn't accessible on 1 of 2 pods: web-1\n") {
+		t.Errorf("portInaccessible wasn't entered with only web-1:\n%s", out.String())
+	}
+	if checks := checksNamed(k, checkError); len(checks) != 0 {
+		t.Errorf("a failed port-forward was an error: %+v", checks)
+	}
+}
+
+func TestProbeConcurrency(t *testing.T) {
+	names := []string{"web-1", "web-2", "web-3", "web-4"}
+	objs := []runtime.Object{testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), testDeployment("web", 4)}
+	for _, name := range names {
+		pod := testPod(name, corev1.PodRunning)
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		objs = append(objs, pod)
+	}
+	cfg := answered
+	cfg.Concurrency = 2
+	var out bytes.Buffer
+	k := NewKubetrblIO(context.Background(), cfg, strings.NewReader(""), &out)
+	k.k8sContext = NewK8sContextWithClient(fakeClient(objs...), testNamespace)
+	// web-1 answers only once web-3 has, so its probe finishes after a later pod's
+	answered3 := make(chan struct{})
+	var once sync.Once
+	handlers := map[string]http.HandlerFunc{
+		"web-1": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-answered3:
+			case <-time.After(5 * time.Second):
+				t.Errorf("web-3 wasn't probed while web-1's probe was waiting")
+			}
+		},
+		"web-2": answering(http.StatusOK),
+		"web-3": func(w http.ResponseWriter, r *http.Request) {
+			once.Do(func() { close(answered3) })
+		},
+		"web-4": answering(http.StatusOK),
+	}
+	f := newForwarding(t, k, handlers)
+
+	k.Start("getNamespace")
+
+	// the results are reported in pod order, however the probes finish
+	got := []string{}
+	for _, c := range checksNamed(k, checkPodPort) {
+		got = append(got, c.Target)
+		if c.Status != report.StatusPass {
+			t.Errorf("%s port check %+v, want it passed", c.Target, c)
+		}
+	}
+	if want := append(names, "svc/web"); !reflect.DeepEqual(got, want) {
+		t.Errorf("port checks for %v, want %v", got, want)
+	}
+	if f.most != cfg.Concurrency {
+		t.Errorf("%d port-forwards at once, want %d", f.most, cfg.Concurrency)
+	}
+}
+
+func TestForwardedLocalPort(t *testing.T) {
+	k := NewKubetrblIO(context.Background(), answered, strings.NewReader(""), &bytes.Buffer{})
+	k.k8sContext = NewK8sContextWithClient(fakeClient(), testNamespace)
+	k.probeScheme, k.probePath, k.probeTimeout = "http", "/healthz", time.Second
+	var host, path string
+	f := newForwarding(t, k, map[string]http.HandlerFunc{"web-1": func(w http.ResponseWriter, r *http.Request) {
+		host, path = r.Host, r.URL.Path
+	}})
+
+	// the probe goes to whichever local port the port-forward got
+	result, err := k.checkPodPort(context.Background(), *testPod("web-1", corev1.PodRunning), 8080)
+	if err != nil || result.Status != report.StatusPass {
+		t.Fatalf("checkPodPort = %+v, %v; want it passed", result, err)
+	}
+	if want := fmt.Sprintf("localhost:%d", f.forwarders[0].local); host != want || path != "/healthz" {
+		t.Errorf("probed %s%s, want %s/healthz", host, path, want)
+	}
+
+	// a port-forward that's ready without a local port has nothing to probe
+	result, err = k.checkPodPort(context.Background(), *testPod("web-2", corev1.PodRunning), 8080)
+	if err != nil || result.Status != report.StatusFail || !strings.HasSuffix(result.Message, "it's ready but isn't listening on any local port") {
+		t.Errorf("checkPodPort without a local port = %+v, %v", result, err)
+	}
+}
+
+// protocolRun troubleshoots the web service with its port and the pods' container port given protocols, failing the
+// test if a port-forward is made
+func protocolRun(t *testing.T, svcProtocol, cntProtocol corev1.Protocol) (*Kubetrbl, string) {
+	t.Helper()
+	pod := testPod("web-1", corev1.PodRunning)
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	svc := testService()
+	svc.Spec.Ports[0].Protocol = svcProtocol
+	d := testDeployment("web", 1)
+	d.Spec.Template.Spec.Containers[0].Ports[0].Protocol = cntProtocol
+	var out bytes.Buffer
+	k := NewKubetrblIO(context.Background(), answered, strings.NewReader(""), &out)
+	k.k8sContext = NewK8sContextWithClient(fakeClient(testNamespaceObject(), svc, testEndpoints("10.0.0.1"), pod, d), testNamespace)
+	k.k8sContext.config = testRESTConfig()
+	k.newPortForwarder = func(pod corev1.Pod, _ httpstream.Dialer, _ []string, _ <-chan struct{}, _ chan struct{}, _, _ io.Writer) (portForwarder, error) {
+		t.Errorf("port-forwarded to %s's %s port", pod.Name, cntProtocol)
+		return nil, errors.New("no port-forwards to a port that isn't TCP")
+	}
+	k.Start("getNamespace")
+	return k, out.String()
+}
+
+func TestUDPPort(t *testing.T) {
+	k, out := protocolRun(t, corev1.ProtocolUDP, corev1.ProtocolUDP)
+
+	if c := wantCheck(t, k, checkPodPort, "web", report.StatusSkip); c.Message != "Not probing container port 8080: UDP ports can't be validated via port-forward." {
+		t.Errorf("UDP port check said %q", c.Message)
+	}
+	if !strings.Contains(out, "nc -u <pod IP> 8080") {
+		t.Errorf("didn't say how to check the UDP port instead:\n%s", out)
+	}
+	if checks := checksNamed(k, checkContainerPort); len(checks) != 1 || checks[0].Status != report.StatusPass {
+		t.Errorf("container port checks %+v, want the matching protocols passed", checks)
+	}
+}
+
+func TestProtocolMismatch(t *testing.T) {
+	tests := []struct {
+		svc, cnt corev1.Protocol
+		want     string
+	}{
+		{corev1.ProtocolTCP, corev1.ProtocolUDP, "Service port 'http' is TCP but the container port 8080 is UDP."},
+		{corev1.ProtocolUDP, corev1.ProtocolTCP, "Service port 'http' is UDP but the container port 8080 is TCP."},
+	}
+	for _, tt := range tests {
+		k, _ := protocolRun(t, tt.svc, tt.cnt)
+
+		if c := wantCheck(t, k, checkContainerPort, "web", report.StatusWarn); c.Message != tt.want {
+			t.Errorf("%s service port to %s container port said %q, want %q", tt.svc, tt.cnt, c.Message, tt.want)
+		}
+		// traffic through the service isn't TCP all the way, so there's nothing a port-forward would show
+		wantCheck(t, k, checkPodPort, "web", report.StatusSkip)
+	}
+}
+
+func TestHeadlessServicePort(t *testing.T) {
+	for _, clusterIP := range []string{corev1.ClusterIPNone, "10.96.0.10"} {
+		pod := testPod("web-1", corev1.PodRunning)
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		svc := testService()
+		svc.Spec.ClusterIP = clusterIP
+		var out bytes.Buffer
+		k := NewKubetrblIO(context.Background(), answered, strings.NewReader(""), &out)
+		k.k8sContext = NewK8sContextWithClient(fakeClient(testNamespaceObject(), svc, testEndpoints("10.0.0.1"), pod, testDeployment("web", 1)), testNamespace)
+		newForwarding(t, k, map[string]http.HandlerFunc{"web-1": answering(http.StatusOK)})
+
+		k.Start("getNamespace")
+
+		// the service is probed through its pod either way, and only a headless one says it has no cluster IP
+		if c := wantCheck(t, k, checkPodPort, "svc/web", report.StatusPass); c.Message != "Via Service (pod 'web-1'): Pod port accessible." {
+			t.Errorf("probe via service with cluster IP %s said %q", clusterIP, c.Message)
+		}
+		isHeadless := clusterIP == corev1.ClusterIPNone
+		for _, said := range []string{"Service 'web' is headless: it has no cluster IP", "each of the headless service's pods answers for itself"} {
+			if strings.Contains(out.String(), said) != isHeadless {
+				t.Errorf("with cluster IP %s, saying %q is %v:\n%s", clusterIP, said, !isHeadless, out.String())
+			}
+		}
+	}
+}
+
+// labelledDeployment is the web Deployment with its pods labelled only with the key
+func labelledDeployment(key string) *appsv1.Deployment {
+	d := testDeployment("web", 1)
+	d.Spec.Selector.MatchLabels = map[string]string{key: "web"}
+	d.Spec.Template.Labels = map[string]string{key: "web"}
+	return d
+}
+
+// labelledRun troubleshoots a service selecting on the key and a tier its controllers' templates don't have, as when
+// something other than the controller labels the pods
+func labelledRun(t *testing.T, selectorLabel, key string, input string, objs ...runtime.Object) (*Kubetrbl, string) {
+	t.Helper()
+	selector := map[string]string{key: "web", "tier": "frontend"}
+	pod := testPod("web-1", corev1.PodRunning)
+	pod.Labels = selector
+	svc := testService()
+	svc.Spec.Selector = selector
+	cfg := Config{Namespace: testNamespace, Service: "web", Port: "http", SelectorLabel: selectorLabel, Only: []string{onlyEndpoints}}
+	if input != "" {
+		// the port is asked for, so there's someone to ask which controller it is
+		cfg.Port = ""
+	}
+	return troubleshoot(t, cfg, "getNamespace", input, append(objs, testNamespaceObject(), svc, testEndpoints("10.0.0.1"), pod)...)
+}
+
+func TestFindControllerByLabel(t *testing.T) {
+	tests := []struct {
+		selectorLabel, key string
+		found              bool
+	}{
+		{"", "app.kubernetes.io/name", true},
+		{"app", "app", true},
+		// the default label isn't in the selector, so there's nothing to match on alone
+		{"", "app", false},
+	}
+	for _, tt := range tests {
+		k, out := labelledRun(t, tt.selectorLabel, tt.key, "", labelledDeployment(tt.key))
+
+		if !tt.found {
+			if k.k8sContext.controller != nil || len(checksNamed(k, checkError)) != 1 {
+				t.Errorf("found controller %v on %s with -selector-label %q:\n%s", k.k8sContext.controller, tt.key, tt.selectorLabel, out)
+			}
+			continue
+		}
+		c := wantCheck(t, k, checkController, "web", report.StatusWarn)
+		if want := "No controller's pods match the whole selector; Deployment/web match on " + tt.key + "=web."; c.Message != want {
+			t.Errorf("controller check said %q, want %q", c.Message, want)
+		}
+		if k.k8sContext.controller == nil || k.k8sContext.controller.GetName() != "web" {
+			t.Errorf("didn't find Deployment web on %s with -selector-label %q:\n%s", tt.key, tt.selectorLabel, out)
+		}
+	}
+}
+
+func TestChooseController(t *testing.T) {
+	db := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: testNamespace}, Spec: appsv1.StatefulSetSpec{Template: testTemplate()}}
+	tests := []struct {
+		name  string
+		input string
+		// the label the service and the pods share, which the Deployment is only found by alone when it's the default
+		key  string
+		objs []runtime.Object
+		want string
+		err  string
+	}{
+		{"several to pick from", "\nhttp\n1\n", "app", []runtime.Object{labelledDeployment("app"), db}, "Using StatefulSet - db, as chosen", ""},
+		{"picking the first", "\nhttp\n0\n", "app", []runtime.Object{labelledDeployment("app"), db}, "Using Deployment - web, as chosen", ""},
+		{"no one to ask", "", "app", []runtime.Object{labelledDeployment("app"), db}, "", "no Deployment, StatefulSet, or DaemonSet in namespace 'default' has pods matching 'app=web,tier=frontend'"},
+		{"nothing to pick from", "\nhttp\n", "app", nil, "", "no Deployment, StatefulSet, or DaemonSet in namespace 'default' has pods matching 'app=web,tier=frontend'"},
+		{"found without asking", "\nhttp\n", "app.kubernetes.io/name", []runtime.Object{labelledDeployment("app.kubernetes.io/name"), db}, "No controller's pods match the whole selector; Deployment/web match on app.kubernetes.io/name=web.", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, out := labelledRun(t, "", tt.key, tt.input, tt.objs...)
+
+			if tt.err != "" {
+				errs := checksNamed(k, checkError)
+				if len(errs) != 1 || !strings.Contains(errs[0].Message, tt.err) || strings.Contains(out, "Which one backs the service? ") {
+					t.Errorf("errors %+v, want %q without asking:\n%s", errs, tt.err, out)
+				}
+				return
+			}
+			if c := checksNamed(k, checkController)[0]; c.Target != "web" || c.Message != tt.want {
+				t.Errorf("controller check %+v, want %q:\n%s", c, tt.want, out)
+			}
+			asked := strings.Contains(out, "Controllers:\n0) Deployment/web\n1) StatefulSet/db\nWhich one backs the service? ")
+			if asked != strings.HasSuffix(tt.want, "as chosen") {
+				t.Errorf("asking which controller is %v:\n%s", asked, out)
+			}
+		})
+	}
+}
+
+func TestPortForwardStops(t *testing.T) {
+	k := NewKubetrblIO(context.Background(), answered, strings.NewReader(""), &bytes.Buffer{})
+	k.k8sContext = NewK8sContextWithClient(fakeClient(), testNamespace)
+	k.probeScheme, k.probePath, k.probeTimeout = "http", "/", time.Second
+	f := newForwarding(t, k, map[string]http.HandlerFunc{"web-1": answering(http.StatusOK), "web-2": answering(http.StatusOK)})
+	f.fail["web-2"] = errors.New("lost connection to pod")
+	// stopped tells if the port-forward was stopped and has returned, so nothing's left forwarding to the pod
+	stopped := func(pf *fakeForwarder) bool {
+		select {
+		case <-pf.done:
+		default:
+			return false
+		}
+		select {
+		case <-pf.stop:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if _, err := k.checkPodPort(context.Background(), *testPod("web-1", corev1.PodRunning), 8080); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := k.checkPodPort(context.Background(), *testPod("web-2", corev1.PodRunning), 8080); err != nil || result.Status != report.StatusFail {
+		t.Errorf("checkPodPort with a failing port-forward = %+v, %v", result, err)
+	}
+	// one that isn't ready before the probe's interrupted
+	f.gate = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for len(f.pods()) < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if _, err := k.checkPodPort(ctx, *testPod("web-1", corev1.PodRunning), 8080); !errors.Is(err, context.Canceled) {
+		t.Errorf("checkPodPort once interrupted = %v", err)
+	}
+	for i, pf := range f.forwarders {
+		if !stopped(pf) {
+			t.Errorf("port-forward %d to %s is still running once checkPodPort returned", i, pf.pod)
+		}
+	}
+
+	// a port-forward that can't be made is stopped all the same
+	var stop <-chan struct{}
+	k.newPortForwarder = func(_ corev1.Pod, _ httpstream.Dialer, _ []string, stopChan <-chan struct{}, _ chan struct{}, _, _ io.Writer) (portForwarder, error) {
+		stop = stopChan
+		return nil, errors.New("no ports to forward")
+	}
+	if result, err := k.checkPodPort(context.Background(), *testPod("web-1", corev1.PodRunning), 8080); err != nil || result.Status != report.StatusFail {
+		t.Errorf("checkPodPort without a port-forward = %+v, %v", result, err)
+	}
+	select {
+	case <-stop:
+	default:
+		t.Errorf("the port-forward that couldn't be made wasn't stopped")
+	}
+}
+
+func TestAllPorts(t *testing.T) {
+	ports := []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}, {Name: "metrics", ContainerPort: 9090}}
+	objs := []runtime.Object{testNamespaceObject(), testEndpoints("10.0.0.1")}
+	for _, name := range []string{"web-1", "web-2"} {
+		pod := testPod(name, corev1.PodRunning)
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		pod.Spec.Containers[0].Ports = ports
+		objs = append(objs, pod)
+	}
+	svc := testService()
+	svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Name: "metrics", Port: 9090, TargetPort: intstr.FromInt(9090)})
+	d := testDeployment("web", 2)
+	d.Spec.Template.Spec.Containers[0].Ports = ports
+	objs = append(objs, svc, d)
+	cfg := answered
+	cfg.Port = allPorts
+	cfg.DryRun = true
+
+	k, _ := troubleshoot(t, cfg, "getNamespace", "", objs...)
+
+	// each port of each pod is probed, and each service port through the service
+	got := []string{}
+	for _, c := range checksNamed(k, checkPodPort) {
+		got = append(got, c.Target)
+	}
+	if want := []string{"web-1:8080", "web-1:9090", "web-2:8080", "web-2:9090", "svc/web:80", "svc/web:9090"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("probed %v, want %v", got, want)
+	}
+	got = []string{}
+	for _, c := range checksNamed(k, checkContainerPort) {
+		got = append(got, c.Message)
+	}
+	if want := []string{"Identified pod port: 8080", "Identified pod port: 9090"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("container port checks said %q, want %q", got, want)
+	}
+
+	// all is offered once there's more than one port to pick
+	k, out := troubleshoot(t, Config{Namespace: testNamespace, Service: "web", DryRun: true}, "getNamespace", "\nall\n", objs...)
+	if !strings.Contains(out, "Available ports: \n0) http\n1) metrics\n2) all\nWhich port? ") || len(checksNamed(k, checkContainerPort)) != 2 {
+		t.Errorf("didn't check every port when asked to:\n%s", out)
+	}
+}
+
+func TestStartFromDeployment(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	client := fakeClient(testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), ready, testDeployment("web", 1))
+	var out bytes.Buffer
+	k := NewKubetrblIO(context.Background(), Config{Namespace: testNamespace}, strings.NewReader("deployment\n0\n\n\n\n\n"), &out)
+	k.k8sContext = NewK8sContextWithClient(client, testNamespace)
+	newForwarding(t, k, map[string]http.HandlerFunc{"web-1": answering(http.StatusOK)})
+
+	k.Start("getNamespace")
+
+	// the pods are checked, and their port probed, without a service
+	if !strings.Contains(out.String(), "Available deployments:\n0) web\nWhich deployment? ") {
+		t.Errorf("didn't offer the deployments:\n%s", out.String())
+	}
+	wantCheck(t, k, checkReadyPods, testNamespace, report.StatusPass)
+	wantCheck(t, k, checkContainerPort, "web", report.StatusPass)
+	wantCheck(t, k, checkPodPort, "web-1", report.StatusPass)
+	for _, a := range client.Actions() {
+		if a.GetResource().Resource == "services" {
+			t.Errorf("starting from a deployment made a %s of %s", a.GetVerb(), a.GetResource().Resource)
+		}
+	}
+}
+
+func TestScriptedSession(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+
+	k, out := troubleshoot(t, Config{}, "getNamespace", "default\nservice\n\nweb\nq\n", testNamespaceObject(), ready, testService())
+
+	for _, want := range []string{
+		"Available namespaces:\n0) default\nKubernetes namespace? ",
+		"Start from a service, a deployment, or a single pod (enter for service)? ",
+		"There are 1 pods in the cluster+namespace.\n",
+		"[OK] No pods are pending.\n",
+		"[OK] All pods are running.\n",
+		"[OK] All pods are ready.\n",
+		"Available services: \n0) web\nWhich service? ",
+		"Available ports: \n0) http\nWhich port? ",
+		"See ya!\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("session didn't print %q:\n%s", want, out)
+		}
+	}
+	if k.k8sContext.namespace != testNamespace || k.k8sContext.svc.GetName() != "web" {
+		t.Errorf("answers chose namespace %q and service %q", k.k8sContext.namespace, k.k8sContext.svc.GetName())
+	}
+}
+
+func TestNonInteractive(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	// listed first, so picking by index rather than by name would choose it
+	api := testService()
+	api.Name = "api"
+	cfg := answered
+	cfg.Only = []string{onlyEndpoints}
+
+	k, out := troubleshoot(t, cfg, "getNamespace", "", testNamespaceObject(), api, testService(), testEndpoints(), ready, testDeployment("web", 1))
+
+	if strings.Contains(out, "? ") {
+		t.Errorf("non-interactive run prompted:\n%s", out)
+	}
+	if got := k.k8sContext.svc.GetName(); got != "web" {
+		t.Errorf("-service web chose service %q", got)
+	}
+	if got := k.k8sContext.svcPort.Name; got != "http" {
+		t.Errorf("-port http chose port %q", got)
+	}
+	if got := k.fsm.Current(); got != "finish" {
+		t.Errorf("run stopped in %q, not finish:\n%s", got, out)
+	}
+	wantCheck(t, k, checkServiceEndpoints, "web", report.StatusFail)
+	if !k.Failed() || k.ExitCode() == report.ExitOK {
+		t.Errorf("run with a failed check has Failed() %v and exit code %d", k.Failed(), k.ExitCode())
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	cfg := answered
+	cfg.Only = []string{onlyEndpoints}
+	cfg.Output = OutputJSON
+
+	_, out := troubleshoot(t, cfg, "getNamespace", "", testNamespaceObject(), testService(), testEndpoints(), ready, testDeployment("web", 1))
+
+	var r report.Report
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("output isn't a JSON report: %v\n%s", err, out)
+	}
+	if r.Namespace != testNamespace || r.Service != "web" {
+		t.Errorf("report is of namespace %q and service %q", r.Namespace, r.Service)
+	}
+	statuses := map[string]report.Status{}
+	for _, c := range r.Checks {
+		statuses[c.Name] = c.Status
+	}
+	want := map[string]report.Status{
+		checkPendingPods:      report.StatusSkip,
+		checkRunningPods:      report.StatusSkip,
+		checkCrashLoopingPods: report.StatusSkip,
+		checkReadyPods:        report.StatusSkip,
+		checkServiceEndpoints: report.StatusFail,
+		checkServiceSelector:  report.StatusPass,
+	}
+	for name, status := range want {
+		if statuses[name] != status {
+			t.Errorf("%s check has status %q, want %q", name, statuses[name], status)
+		}
+	}
+}
+
+// flushWriter is an output that notes how many lines had been written each time it was flushed
+type flushWriter struct {
+	bytes.Buffer
+	flushed []int
+}
+
+func (w *flushWriter) Flush() error {
+	w.flushed = append(w.flushed, strings.Count(w.String(), "\n"))
+	return nil
+}
+
+func TestJSONLinesOutput(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	cfg := answered
+	cfg.Only = []string{onlyEndpoints}
+	cfg.Output = OutputJSONLines
+	var out flushWriter
+	k := NewKubetrblIO(context.Background(), cfg, strings.NewReader(""), &out)
+	k.k8sContext = NewK8sContextWithClient(fakeClient(testNamespaceObject(), testService(), testEndpoints(), ready, testDeployment("web", 1)), testNamespace)
+	k.Start("getNamespace")
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(k.checks) {
+		t.Fatalf("wrote %d lines for %d checks:\n%s", len(lines), len(k.checks), out.String())
+	}
+	for i, line := range lines {
+		var c report.CheckResult
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil || dec.More() {
+			t.Fatalf("line %d isn't one JSON check result (%v): %s", i+1, err, line)
+		}
+		if c.Name != k.checks[i].Name || c.Target != k.checks[i].Target || c.Status != k.checks[i].Status || c.Message != k.checks[i].Message {
+			t.Errorf("line %d is %+v, want %+v", i+1, c, k.checks[i])
+		}
+	}
+	// each line is flushed as its check is made, rather than all at the end
+	want := []int{}
+	for i := range lines {
+		want = append(want, i+1)
+	}
+	if !reflect.DeepEqual(out.flushed, want) {
+		t.Errorf("flushed after lines %v, want %v", out.flushed, want)
+	}
+}
+
+func TestReport(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	cfg := answered
+	cfg.DryRun = true
+
+	k, _ := troubleshoot(t, cfg, "getNamespace", "", testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), ready, testDeployment("web", 1))
+
+	type result struct {
+		name, category, target string
+		status                 report.Status
+	}
+	want := []result{
+		{checkPendingPods, report.CategoryPendingPods, testNamespace, report.StatusPass},
+		{checkRunningPods, report.CategoryNotRunning, testNamespace, report.StatusPass},
+		{checkCrashLoopingPods, report.CategoryCrashLoops, testNamespace, report.StatusPass},
+		{checkReadyPods, report.CategoryNotReady, testNamespace, report.StatusPass},
+		{checkServiceEndpoints, report.CategoryService, "web", report.StatusPass},
+		{checkServiceSelector, report.CategoryService, "web", report.StatusPass},
+		{checkController, report.CategoryService, "web", report.StatusPass},
+		{checkReplicas, report.CategoryNotReady, "web", report.StatusPass},
+		{checkRollout, report.CategoryNotReady, "web", report.StatusPass},
+		{checkContainerPort, report.CategoryPort, "web", report.StatusPass},
+		{checkNetworkPolicy, report.CategoryNetworkPolicies, "web", report.StatusPass},
+		{checkPodPort, report.CategoryPort, "web-1", report.StatusSkip},
+		{checkPodPort, report.CategoryPort, "svc/web", report.StatusSkip},
+	}
+	r := k.report()
+	got := []result{}
+	for _, c := range r.Checks {
+		got = append(got, result{c.Name, c.Category, c.Target, c.Status})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("report has checks\n%+v\nwant\n%+v", got, want)
+	}
+	if r.Namespace != testNamespace || r.Service != "web" || r.ExitCode() != report.ExitOK {
+		t.Errorf("report is of namespace %q and service %q with exit code %d", r.Namespace, r.Service, r.ExitCode())
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	cfg := answered
+	cfg.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	var out bytes.Buffer
+	k := NewKubetrblIO(ctx, cfg, strings.NewReader(""), &out)
+	k.k8sContext = NewK8sContextWithClient(&testClient{Clientset: fakeClient(testNamespaceObject(), ready, testService()), hangServices: true}, testNamespace)
+
+	k.Start("getNamespace")
+	if elapsed := time.Since(start); elapsed < cfg.Timeout || elapsed > 5*time.Second {
+		t.Errorf("run took %s with a %s timeout", elapsed, cfg.Timeout)
+	}
+
+	wantCheck(t, k, checkError, "getServiceName", report.StatusFail)
+	// what was checked before the deadline is still reported
+	wantCheck(t, k, checkReadyPods, testNamespace, report.StatusPass)
+	if !strings.Contains(out.String(), "Troubleshooting timed out after 100ms.\n") || !strings.Contains(out.String(), "Summary:\n") {
+		t.Errorf("didn't finish up after timing out:\n%s", out.String())
+	}
+	if got := k.ExitCode(); got != report.ExitTimedOut {
+		t.Errorf("ExitCode = %d, want %d", got, report.ExitTimedOut)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	unready := testPod("web-1", corev1.PodRunning)
+	unready.Status.Conditions = []corev1.PodCondition{notReady("ContainersNotReady", "containers with unready status: [app]")}
+	tests := []struct {
+		name string
+		objs []runtime.Object
+		want int
+	}{
+		{"pending", []runtime.Object{testPod("web-1", corev1.PodPending)}, report.ExitPending},
+		{"not running", []runtime.Object{testPod("web-1", corev1.PodFailed)}, report.ExitNotRunning},
+		{"not ready", []runtime.Object{unready, testDeployment("web", 1)}, report.ExitNotReady},
+		{"no endpoints", []runtime.Object{ready, testEndpoints(), testDeployment("web", 1)}, report.ExitService},
+		{"healthy", []runtime.Object{ready, testEndpoints("10.0.0.1"), testDeployment("web", 1)}, report.ExitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := answered
+			// stop short of the port-forward, which needs a real cluster
+			cfg.Only = []string{onlyPending, onlyRunning, onlyReady, onlyEndpoints}
+			objs := append([]runtime.Object{testNamespaceObject(), testService()}, tt.objs...)
+			k, out := troubleshoot(t, cfg, "getNamespace", "", objs...)
+			if got := k.ExitCode(); got != tt.want {
+				t.Errorf("exit code %d, want %d:\n%s", got, tt.want, out)
+			}
+			if k.Failed() != (tt.want != report.ExitOK) {
+				t.Errorf("Failed() is %v with exit code %d", k.Failed(), tt.want)
+			}
+		})
+	}
+}
+
+// choose shows a menu of the items, answering it from input, and returns the choice and what was written
+func choose(t *testing.T, items []string, def int, input string) (int, string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	k := NewKubetrblIO(context.Background(), Config{}, strings.NewReader(input), &out)
+	i, err := k.chooseFromListDefault("Available services:", "Which service? ", items, def)
+	return i, out.String(), err
+}
+
+func TestChooseFromListPaging(t *testing.T) {
+	items := []string{}
+	for i := 0; i < 45; i++ {
+		items = append(items, fmt.Sprintf("svc-%02d", i))
+	}
+
+	// paging past either end stays put, and numbers index the whole list rather than the page
+	i, out, err := choose(t, items, -1, "n\nn\nn\np\np\np\n42\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != 42 {
+		t.Errorf("chose %d, want 42", i)
+	}
+	pages := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "Page ") {
+			pages = append(pages, line[:len("Page 1 of 3")])
+		}
+	}
+	want := []string{"Page 1 of 3", "Page 2 of 3", "Page 3 of 3", "Page 3 of 3", "Page 2 of 3", "Page 1 of 3", "Page 1 of 3"}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("showed pages %v, want %v", pages, want)
+	}
+	third := "Available services:\n40) svc-40\n41) svc-41\n42) svc-42\n43) svc-43\n44) svc-44\nPage 3 of 3"
+	if !strings.Contains(out, third) || !strings.Contains(out, "19) svc-19\nPage 1 of 3") {
+		t.Errorf("pages weren't 20 items at a time:\n%s", out)
+	}
+
+	// a single page has no paging, so n and p pick out items by name
+	i, out, err = choose(t, []string{"nginx", "postgres"}, -1, "n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != 0 || strings.Contains(out, "Page ") {
+		t.Errorf("n on a single page chose %d:\n%s", i, out)
+	}
+	if i, _, err = choose(t, []string{"nginx", "postgres"}, -1, "p\n"); err != nil || i != 1 {
+		t.Errorf("p on a single page chose %d, %v; want postgres", i, err)
+	}
+}
+
+func TestEmptyLists(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	portless := testService()
+	portless.Spec.Ports = nil
+
+	t.Run("namespaces", func(t *testing.T) {
+		k, out := troubleshoot(t, Config{}, "getNamespace", "")
+		wantCheck(t, k, checkNamespaces, "", report.StatusFail)
+		if strings.Contains(out, "Kubernetes namespace? ") {
+			t.Errorf("prompted for a namespace with none to choose:\n%s", out)
+		}
+	})
+	t.Run("services", func(t *testing.T) {
+		// picking the namespace again is no use when it was given up front
+		k, _ := troubleshoot(t, Config{Namespace: testNamespace}, "getNamespace", "service\n\n", testNamespaceObject(), ready)
+		wantCheck(t, k, checkServices, testNamespace, report.StatusFail)
+		if got := k.fsm.Current(); got != "finish" {
+			t.Errorf("run stopped in %q, not finish", got)
+		}
+	})
+	t.Run("services interactively", func(t *testing.T) {
+		k, out := troubleshoot(t, Config{}, "getNamespace", "default\nservice\n\n", testNamespaceObject(), ready)
+		if !strings.Contains(out, "No services found in namespace 'default'; pick another namespace.\nAvailable namespaces:\n") {
+			t.Errorf("didn't go back to picking a namespace:\n%s", out)
+		}
+		if len(checksNamed(k, checkServices)) != 0 {
+			t.Errorf("failed a check the user can still fix by picking again: %+v", k.checks)
+		}
+	})
+	t.Run("ports", func(t *testing.T) {
+		k, _ := troubleshoot(t, answered, "getNamespace", "", testNamespaceObject(), ready, portless)
+		wantCheck(t, k, checkServicePorts, "web", report.StatusFail)
+		if got := k.fsm.Current(); got != "finish" {
+			t.Errorf("run stopped in %q, not finish", got)
+		}
+	})
+	t.Run("ports interactively", func(t *testing.T) {
+		k, out := troubleshoot(t, Config{}, "getNamespace", "default\nservice\n\nweb\n", testNamespaceObject(), ready, portless)
+		if !strings.Contains(out, "Service 'web' has no ports; pick another service.\nAvailable services: \n") {
+			t.Errorf("didn't go back to picking a service:\n%s", out)
+		}
+		if len(checksNamed(k, checkServicePorts)) != 0 {
+			t.Errorf("failed a check the user can still fix by picking again: %+v", k.checks)
+		}
+	})
+}
+
+func TestDiagnoseTerminatedContainers(t *testing.T) {
+	pod := testPod("web-1", corev1.PodFailed)
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "sidecar"}, corev1.Container{Name: "job"})
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "app", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 143, Reason: "Error"}}},
+		{Name: "sidecar", LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}}},
+		// a container that exited cleanly isn't a problem
+		{Name: "job", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}}},
+	}
+	cfg := answered
+	cfg.Only = []string{onlyRunning}
+
+	k, out := troubleshoot(t, cfg, "countPods", "", pod)
+
+	c := wantCheck(t, k, checkContainerStatus, "web-1/app", report.StatusFail)
+	if c.Message != "Pod 'web-1' container app exited 143 (Error)" {
+		t.Errorf("app's check said %q", c.Message)
+	}
+	c = wantCheck(t, k, checkContainerStatus, "web-1/sidecar", report.StatusFail)
+	if c.Message != "Pod 'web-1' previously container sidecar OOMKilled (137)" {
+		t.Errorf("sidecar's check said %q", c.Message)
+	}
+	if len(checksNamed(k, checkContainerStatus)) != 2 {
+		t.Errorf("the job that completed failed a check: %+v", checksNamed(k, checkContainerStatus))
+	}
+	for _, hint := range []string{exitCodeHints[143], exitCodeHints[137]} {
+		if !strings.Contains(out, "  "+hint+"\n") {
+			t.Errorf("didn't explain %q in\n%s", hint, out)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	start := func(state string) string {
+		var out bytes.Buffer
+		k := NewKubetrblIO(context.Background(), Config{}, strings.NewReader("q\n"), &out)
+		k.Start(state)
+		return out.String()
+	}
+
+	if out := start(""); !strings.HasPrefix(out, "Wecome to Kubetrbl.\n") || !strings.Contains(out, "Answer q or quit at any prompt") {
+		t.Errorf("didn't welcome by default:\n%s", out)
+	}
+	// -quiet starts here
+	out := start("getKubeConfig")
+	if !strings.HasPrefix(out, "We need to start by connecting to a Kubernetes cluster.\n") || strings.Contains(out, "Kubetrbl") {
+		t.Errorf("starting at getKubeConfig didn't skip the welcome:\n%s", out)
+	}
+}
+
+func TestQuit(t *testing.T) {
+	for _, input := range []string{"q\n", "quit\n", "QUIT\n"} {
+		t.Run(strings.TrimSpace(input), func(t *testing.T) {
+			k, out := troubleshoot(t, Config{}, "getNamespace", input+"n\n", testNamespaceObject())
+			if got := k.fsm.Current(); got != "finish" {
+				t.Errorf("quitting at the namespace prompt ended in %q, not finish", got)
+			}
+			if len(k.checks) != 0 {
+				t.Errorf("quitting made checks %+v", k.checks)
+			}
+			if !strings.HasSuffix(out, "Troubleshoot another deployment? [y/N] See ya!\n") || strings.Contains(out, "An error occurred") {
+				t.Errorf("didn't finish cleanly:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestClusterOverview(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	pending := testPod("api-1", corev1.PodPending)
+	pending.Namespace = "staging"
+	pending.Status.Conditions = []corev1.PodCondition{notReady("ContainersNotReady", "containers with unready status: [app]")}
+	crashed := testPod("api-2", corev1.PodFailed)
+	crashed.Namespace = "staging"
+	cfg := answered
+	cfg.Only = []string{onlyEndpoints}
+	cfg.AllNamespaces = true
+
+	_, out := troubleshoot(t, cfg, "clusterOverview", "", testNamespaceObject(), ready, pending, crashed, testService(), testEndpoints("10.0.0.1"), testDeployment("web", 1))
+
+	// a namespace without problems isn't listed
+	want := "Across all namespaces: 3 pods, 1 pending, 2 not running, 1 not ready.\n  staging: 2 pods, 1 pending, 2 not running, 1 not ready\n\nThere are 1 pods"
+	if !strings.HasPrefix(out, want) {
+		t.Errorf("overview doesn't start with %q:\n%s", want, out)
+	}
+
+	// a namespace given up front answers whether to look across the cluster
+	cfg.AllNamespaces = false
+	_, out = troubleshoot(t, cfg, "clusterOverview", "", testNamespaceObject(), ready, pending, testService(), testEndpoints("10.0.0.1"))
+	if strings.Contains(out, "Across all namespaces") || strings.Contains(out, "Count problem pods") {
+		t.Errorf("looked across the cluster without being asked:\n%s", out)
+	}
+
+	_, out = troubleshoot(t, Config{}, "clusterOverview", "y\nq\n", testNamespaceObject(), ready, pending)
+	if !strings.Contains(out, "Count problem pods across all namespaces first (slow on big clusters)? [y/N] Across all namespaces: 2 pods, 1 pending") {
+		t.Errorf("didn't count across the cluster when asked to:\n%s", out)
+	}
+}
+
+func TestBack(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	staging := testNamespaceObject()
+	staging.Name = "staging"
+	api := testService()
+	api.Name, api.Namespace = "api", "staging"
+	cfg := Config{Only: []string{onlyEndpoints}}
+	// back at the first prompt stays there; back from picking a service in staging returns past the kind and
+	// selector prompts to picking the namespace again
+	input := "b\nstaging\nservice\n\nb\nb\nb\ndefault\nservice\n\nweb\nhttp\n"
+
+	k, out := troubleshoot(t, cfg, "getNamespace", input, testNamespaceObject(), staging, ready, api, testService(), testEndpoints("10.0.0.1"))
+
+	if !strings.Contains(out, "Kubernetes namespace? Already at the first step.\nAvailable namespaces:\n") {
+		t.Errorf("didn't stay at the first step:\n%s", out)
+	}
+	if got := strings.Count(out, "Kubernetes namespace? "); got != 3 {
+		t.Errorf("asked for the namespace %d times, want 3:\n%s", got, out)
+	}
+	if !strings.Contains(out, "Available services: \n0) api\nWhich service? Label selector") {
+		t.Errorf("didn't go back from picking a service in staging:\n%s", out)
+	}
+	if !strings.Contains(out, "Available services: \n0) web\nWhich service? Available ports: ") {
+		t.Errorf("didn't pick a service in default after going back:\n%s", out)
+	}
+	wantCheck(t, k, checkServiceEndpoints, "web", report.StatusPass)
+	// what was checked in staging is forgotten rather than reported alongside default
+	if pending := checksNamed(k, checkPendingPods); len(pending) != 1 || pending[0].Target != testNamespace {
+		t.Errorf("pending pod checks %+v, want only default's", pending)
+	}
+}
+
+func TestRecordTranscript(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	var out, transcript bytes.Buffer
+	k := NewKubetrblIO(context.Background(), Config{}, strings.NewReader("default\nservice\n\nweb\nq\n"), &out)
+	k.k8sContext = NewK8sContextWithClient(fakeClient(testNamespaceObject(), ready, testService()), "")
+	k.RecordTranscript(&transcript)
+	k.Start("getNamespace")
+
+	got := transcript.String()
+	for _, want := range []string{
+		"Context: (current)\nNamespace: (chosen below)\n\n",
+		// what was typed follows each prompt
+		"Kubernetes namespace? default\n",
+		"Which service? web\n",
+		"Which port? q\n",
+		"[OK] All pods are ready.\n",
+		"See ya!\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("transcript doesn't have %q:\n%s", want, got)
+		}
+	}
+	if !strings.HasPrefix(got, "Kubetrbl session started ") {
+		t.Errorf("transcript doesn't start with its header:\n%s", got)
+	}
+	// the answers aren't echoed to the terminal, which has them already
+	if strings.Contains(out.String(), "Kubernetes namespace? default\n") {
+		t.Errorf("answers were written to the terminal:\n%s", out.String())
+	}
+}
+
+func TestChooseFromListAnswers(t *testing.T) {
+	items := []string{"web", "web-canary", "api", "Postgres"}
+	tests := []struct {
+		name  string
+		def   int
+		input string
+		want  int
+		retry bool
+	}{
+		{"default", 2, "\n", 2, false},
+		{"number", 2, "1\n", 1, false},
+		{"exact name over a prefix", -1, "web\n", 0, false},
+		{"prefix", -1, "ap\n", 2, false},
+		{"case-insensitively", -1, "postgres\n", 3, false},
+		{"no default", -1, "\napi\n", 2, true},
+		{"ambiguous", -1, "we\nweb-c\n", 1, true},
+		{"out of range", -1, "4\n3\n", 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, out, err := choose(t, items, tt.def, tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("%q chose %d, want %d", tt.input, got, tt.want)
+			}
+			if retried := strings.Contains(out, "please enter a name or a number between 0 and 3"); retried != tt.retry {
+				t.Errorf("asked again %v, want %v:\n%s", retried, tt.retry, out)
+			}
+		})
+	}
+
+	_, out, err := choose(t, items, -1, "x\ny\nz\napi\n")
+	if err == nil || strings.Count(out, "Which service? ") != maxAttempts {
+		t.Errorf("%d bad answers gave %v after asking:\n%s", maxAttempts, err, out)
+	}
+}
+
+func TestCheckInitContainers(t *testing.T) {
+	// migrate keeps failing, and is waiting to be run again
+	failing := testPod("web-1", corev1.PodPending)
+	failing.Spec.NodeName = "node-1"
+	failing.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{
+			Name:                 "migrate",
+			State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off 40s restarting failed container"}},
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}},
+		},
+		waiting("seed", "PodInitializing", ""),
+	}
+	// migrate is done, and seed is under way
+	running := testPod("web-2", corev1.PodPending)
+	running.Spec.NodeName = "node-1"
+	running.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{Name: "migrate", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}}},
+		{Name: "seed", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+	}
+	cfg := answered
+	cfg.Only = []string{onlyPending}
+
+	k, _ := troubleshoot(t, cfg, "countPods", "", failing, running)
+
+	checks := checksNamed(k, checkInitContainers)
+	want := []string{
+		"Pod 'web-1' init container 'migrate' previously failed with exit code 1 (Error).",
+		"Pod 'web-1' is stuck at Init:0/2: init container 'migrate' is waiting (CrashLoopBackOff): back-off 40s restarting failed container",
+		"Pod 'web-2' is at Init:1/2: init container 'seed' is still running.",
+	}
+	got := []string{}
+	for _, c := range checks {
+		got = append(got, c.Message)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("init container checks said %q, want %q", got, want)
+	}
+	wantCheck(t, k, checkInitContainers, "web-1/migrate", report.StatusFail)
+	wantCheck(t, k, checkInitContainers, "web-2/seed", report.StatusWarn)
+}
+
+func TestNamespaceNotFound(t *testing.T) {
+	other := testNamespaceObject()
+	other.Name = "other"
+	cfg := answered
+	cfg.Namespace = "nope"
+
+	k, out := troubleshoot(t, cfg, "getNamespace", "", testNamespaceObject(), other)
+	if !strings.Contains(out, "namespace 'nope' not found; available: default, other\n") {
+		t.Errorf("didn't list the namespaces there are:\n%s", out)
+	}
+	wantCheck(t, k, checkError, "getNamespace", report.StatusFail)
+	if len(k.checks) != 1 || strings.Contains(out, "pods in the cluster+namespace") {
+		t.Errorf("run went on past the namespace it couldn't find:\n%s", out)
+	}
+
+	// without permission to list namespaces there's no list to offer
+	client := fakeClient(testNamespaceObject())
+	client.PrependReactor("list", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("namespaces"), "", errors.New("no"))
+	})
+	_, out = troubleshootWith(t, cfg, "getNamespace", "", &testClient{Clientset: client})
+	if !strings.Contains(out, "namespace 'nope' not found\n") {
+		t.Errorf("didn't say the namespace wasn't found:\n%s", out)
+	}
+}
+
+// terminatingNamespace makes the old namespace, which is being deleted
+func terminatingNamespace() *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "old"}, Status: corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating}}
+}
+
+func TestTerminatingNamespace(t *testing.T) {
+	objs := []runtime.Object{testNamespaceObject(), terminatingNamespace(), testPod("web-1", corev1.PodRunning)}
+	refused := "namespace 'old' is terminating: everything in it is being deleted, so there's nothing to troubleshoot"
+
+	// picking it from the list asks again
+	k, out := troubleshoot(t, Config{}, "getNamespace", "old\ndefault\nq\n", objs...)
+	if !strings.Contains(out, "1) old (terminating)\n") || strings.Contains(out, "0) default (terminating)") {
+		t.Errorf("didn't mark only the terminating namespace:\n%s", out)
+	}
+	if !strings.Contains(out, refused+"\n") || strings.Count(out, "Available namespaces:") != 2 {
+		t.Errorf("didn't refuse the terminating namespace and ask again:\n%s", out)
+	}
+	if got := k.k8sContext.namespace; got != testNamespace {
+		t.Errorf("troubleshooting namespace %q, want the one picked after", got)
+	}
+
+	// given up front, it fails the run when there's no one to ask
+	cfg := answered
+	cfg.Namespace = "old"
+	k, out = troubleshoot(t, cfg, "getNamespace", "", objs...)
+	c := wantCheck(t, k, checkError, "getNamespace", report.StatusFail)
+	if c.Message != refused || strings.Contains(out, "pods in the cluster+namespace") {
+		t.Errorf("error check said %q, want the run refused:\n%s", c.Message, out)
+	}
+
+	// and otherwise has the user pick another from the list
+	k, out = troubleshoot(t, Config{Namespace: "old"}, "getNamespace", "default\nq\n", objs...)
+	if !strings.Contains(out, refused) || !strings.Contains(out, "1) old (terminating)\n") || k.k8sContext.namespace != testNamespace {
+		t.Errorf("didn't offer another namespace in place of the terminating one:\n%s", out)
+	}
+}
+
+// writeKubeConfig writes a kubeconfig whose only context connects to the server, returning its path
+func writeKubeConfig(t *testing.T, server string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	contents := `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: ` + server + `
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+users:
+- name: test
+  user:
+    token: secret
+current-context: test
+`
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUnreachableCluster(t *testing.T) {
+	// nothing listens on port 1, so connecting is refused
+	path := writeKubeConfig(t, "http://127.0.0.1:1")
+	run := func(cfg Config, input string) (*Kubetrbl, string) {
+		var out bytes.Buffer
+		k := NewKubetrblIO(context.Background(), cfg, strings.NewReader(input), &out)
+		k.Start("getKubeConfig")
+		return k, out.String()
+	}
+
+	// asked again for a kubeconfig, rather than for a namespace we can't list
+	_, out := run(Config{KubeConfig: path}, "q\n")
+	if !strings.Contains(out, "cannot reach cluster at http://127.0.0.1:1: ") || !strings.Contains(out, "connection refused") {
+		t.Errorf("didn't say the cluster can't be reached:\n%s", out)
+	}
+	if strings.Count(out, "We need to start by connecting to a Kubernetes cluster.\n") != 2 || strings.Contains(out, "namespace") {
+		t.Errorf("didn't go back to asking for a kubeconfig:\n%s", out)
+	}
+
+	// without anyone to ask, the run fails
+	cfg := answered
+	cfg.KubeConfig = path
+	k, out := run(cfg, "")
+	c := wantCheck(t, k, checkError, "getContext", report.StatusFail)
+	if !strings.HasPrefix(c.Message, "cannot reach cluster at http://127.0.0.1:1: ") {
+		t.Errorf("error check said %q, want the host", c.Message)
+	}
+	if len(k.checks) != 1 || strings.Count(out, "We need to start by connecting") != 1 {
+		t.Errorf("run went on after failing to reach the cluster:\n%s", out)
+	}
+}
+
+func TestInClusterConfig(t *testing.T) {
+	// a pod's environment, with no kubeconfig
+	setenv(t, "HOME", t.TempDir())
+	setenv(t, "KUBECONFIG", "")
+	setenv(t, "KUBERNETES_SERVICE_HOST", "127.0.0.1")
+	setenv(t, "KUBERNETES_SERVICE_PORT", "1")
+	var out bytes.Buffer
+	k := NewKubetrblIO(context.Background(), Config{}, strings.NewReader("\nq\n"), &out)
+
+	k.Start("getKubeConfig")
+
+	if !strings.Contains(out.String(), "or in-cluster to use this pod's service account (enter for in-cluster): \n") {
+		t.Errorf("didn't offer the pod's service account:\n%s", out.String())
+	}
+	if !k.k8sContext.InCluster() || k.k8sContext.contextName != inClusterConfig {
+		t.Errorf("kubeconfig %q and context %q, want in-cluster", k.k8sContext.kubeConfigPath, k.k8sContext.contextName)
+	}
+	// there's no service account token mounted, or if there is nothing answers at the service's address
+	if !strings.Contains(out.String(), "/var/run/secrets/kubernetes.io/serviceaccount/token") && !strings.Contains(out.String(), "cannot reach cluster at https://127.0.0.1:1") {
+		t.Errorf("didn't use the in-cluster config:\n%s", out.String())
+	}
+
+	// outside a pod, there's nothing to fall back to
+	setenv(t, "KUBERNETES_SERVICE_HOST", "")
+	out.Reset()
+	k = NewKubetrblIO(context.Background(), answered, strings.NewReader(""), &out)
+	k.Start("getKubeConfig")
+	if c := wantCheck(t, k, checkError, "getKubeConfig", report.StatusFail); !strings.HasPrefix(c.Message, "no kubeconfig found in $KUBECONFIG or ~/.kube/config") {
+		t.Errorf("error check said %q", c.Message)
+	}
+}
+
+func TestCheckServerVersion(t *testing.T) {
+	var gitVersion string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"major": "1", "minor": "x", "gitVersion": %q}`, gitVersion)
+	}))
+	defer api.Close()
+	path := writeKubeConfig(t, api.URL)
+	run := func(version string) (*Kubetrbl, string) {
+		gitVersion = version
+		var out bytes.Buffer
+		k := NewKubetrblIO(context.Background(), Config{KubeConfig: path}, strings.NewReader("q\n"), &out)
+		k.Start("getKubeConfig")
+		return k, out.String()
+	}
+
+	k, out := run("v1.19.2")
+	c := wantCheck(t, k, checkServerVersion, api.URL, report.StatusPass)
+	if c.Message != "Connected to cluster v1.19.2." || !strings.Contains(out, "Connected to cluster v1.19.2.") {
+		t.Errorf("version check said %q:\n%s", c.Message, out)
+	}
+	if len(checksNamed(k, checkServerVersion)) != 1 {
+		t.Errorf("warned of a cluster one minor version from the client's: %+v", checksNamed(k, checkServerVersion))
+	}
+	// connecting leads on to choosing where to troubleshoot
+	if !strings.Contains(out, "Count problem pods across all namespaces first") {
+		t.Errorf("didn't go on after connecting:\n%s", out)
+	}
+
+	k, _ = run("v1.29.3")
+	c = wantCheck(t, k, checkServerVersion, api.URL, report.StatusWarn)
+	if want := "Cluster v1.29.3 is 11 minor versions newer than the v1.18 client libraries kubetrbl is built with; some checks may not work."; c.Message != want {
+		t.Errorf("version check warned %q, want %q", c.Message, want)
+	}
+	k, _ = run("v1.16.15")
+	c = wantCheck(t, k, checkServerVersion, api.URL, report.StatusWarn)
+	if !strings.Contains(c.Message, "is 2 minor versions older") {
+		t.Errorf("version check warned %q, want it called older", c.Message)
+	}
+}
+
+func TestInputEnds(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+
+	// the last answer has no newline, which still answers its prompt
+	k, out := troubleshoot(t, Config{}, "getNamespace", "default\nservice", testNamespaceObject(), ready, testService())
+
+	if !strings.Contains(out, "(enter for all pods)? \nNo more input; finishing up.\n") {
+		t.Errorf("didn't finish up once input ended:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "See ya!\n") || strings.Contains(out, "An error occurred") {
+		t.Errorf("didn't finish cleanly:\n%s", out)
+	}
+	if len(checksNamed(k, checkError)) != 0 {
+		t.Errorf("running out of input was an error: %+v", k.checks)
+	}
+}
+
+func TestReadStringInterrupted(t *testing.T) {
+	in, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	k := NewKubetrblIO(ctx, Config{}, in, ioutil.Discard)
+
+	cancel()
+	if _, err := k.readString(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("readString once interrupted = %v, want context.Canceled", err)
+	}
+
+	// the prompt given up on doesn't keep the line typed next from the one after, even once it's had the time to
+	// start waiting for it
+	time.Sleep(10 * time.Millisecond)
+	k.ctx = context.Background()
+	go fmt.Fprintln(w, "web")
+	done := make(chan string)
+	go func() {
+		str, _ := k.readString()
+		done <- str
+	}()
+	select {
+	case str := <-done:
+		if str != "web" {
+			t.Errorf("readString = %q, want web", str)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the line went to the prompt that was given up on")
+	}
+}
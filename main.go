@@ -1,6 +1,151 @@
 package main
 
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/caseyhadden/kubetrbl/report"
+)
+
 func main() {
-	k := NewKubetrbl()
-	k.Start()
+	cfg := Config{}
+	var help bool
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\nGuided troubleshooting of a Kubernetes deployment. Flags answer prompts up front:\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.BoolVar(&help, "help", false, "print this usage and exit")
+	flag.StringVar(&cfg.KubeConfig, "kubeconfig", "", "path to the kubeconfig file, or "+inClusterConfig+" to use the pod's service account")
+	flag.StringVar(&cfg.Context, "context", "", "kubeconfig context to use")
+	flag.StringVar(&cfg.Namespace, "namespace", "", "namespace to troubleshoot")
+	flag.StringVar(&cfg.Selector, "selector", "", "label selector limiting the pods checked")
+	flag.StringVar(&cfg.SelectorLabel, "selector-label", defaultSelectorLabel, "label key to find the service's controller by when its whole selector matches none")
+	flag.StringVar(&cfg.Service, "service", "", "name of the service to troubleshoot")
+	flag.StringVar(&cfg.Pod, "pod", "", "name of a single pod to diagnose, instead of a service")
+	flag.StringVar(&cfg.Port, "port", "", "name or number of the service port to troubleshoot, or "+allPorts+" for every one")
+	flag.StringVar(&cfg.Path, "path", "", "path to probe on the container port")
+	flag.IntVar(&cfg.LocalPort, "local-port", 0, "local port to forward from (default any free port)")
+	flag.IntVar(&cfg.ReadyThreshold, "ready-threshold", 100, "percentage of pods that have to be ready, e.g. 80 to only warn during a rollout with maxUnavailable")
+	flag.StringVar(&cfg.Output, "output", "text", "output format, text, "+OutputJSON+", or "+OutputJSONLines)
+	flag.BoolVar(&cfg.Quiet, "quiet", false, "skip the welcome text")
+	flag.BoolVar(&cfg.NoColor, "no-color", false, "print plain ASCII markers instead of colored symbols")
+	flag.BoolVar(&cfg.AllNamespaces, "all-namespaces", false, "count pending, non-running, and not ready pods in every namespace first")
+	flag.BoolVar(&cfg.CheckDNS, "dns", false, "check the service's DNS name resolves from inside one of its pods (best effort)")
+	flag.BoolVar(&cfg.DryRun, "dry-run", false, "only make read-only checks, without port-forwarding or running anything in pods")
+	flag.BoolVar(&cfg.Watch, "watch", false, "once finished, re-print which pods are pending, not running, or not ready whenever they change, until interrupted")
+	flag.BoolVar(&cfg.Metrics, "metrics", false, "print how often each troubleshooting step ran when finished")
+	flag.BoolVar(&cfg.Debug, "debug", false, "print the Kubernetes objects each step works from")
+	flag.BoolVar(&cfg.Debug, "v", false, "shorthand for -debug")
+	flag.IntVar(&cfg.Concurrency, "concurrency", defaultConcurrency, "how many pods' ports to probe at once")
+	flag.IntVar(&cfg.Retries, "retries", defaultRetryAttempts, "times to try an API call that fails with a transient error")
+	flag.DurationVar(&cfg.Timeout, "timeout", 0, "how long the whole run may take, e.g. 2m (default no limit)")
+	var only string
+	flag.StringVar(&only, "only", "", "comma separated categories of checks to make, from "+strings.Join(onlyCategories, ", ")+" (default all)")
+	var scenario string
+	flag.StringVar(&scenario, "scenario", "", "path of a YAML or JSON file answering every prompt, for repeatable runs")
+	flag.StringVar(&cfg.MetricsAddr, "metrics-addr", "", "address to serve the checks as Prometheus metrics on once a headless run finishes, e.g. :9090")
+	flag.StringVar(&cfg.Transcript, "transcript", "", "path of a file to record the session to")
+	flag.Parse()
+
+	if help {
+		flag.CommandLine.SetOutput(os.Stdout)
+		flag.Usage()
+		os.Exit(report.ExitOK)
+	}
+
+	if scenario != "" {
+		s, err := LoadScenario(scenario)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(report.ExitUsage)
+		}
+		s.apply(&cfg)
+	}
+	if only != "" {
+		var err error
+		cfg.Only, err = parseOnly(only)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-only: "+err.Error())
+			os.Exit(report.ExitUsage)
+		}
+	}
+	if cfg.Output != "text" && cfg.Output != OutputJSON && cfg.Output != OutputJSONLines {
+		fmt.Fprintln(os.Stderr, "-output must be text, "+OutputJSON+", or "+OutputJSONLines)
+		os.Exit(report.ExitUsage)
+	}
+	if cfg.Output != "text" && !cfg.NonInteractive() {
+		fmt.Fprintln(os.Stderr, "-output "+cfg.Output+" requires -namespace, and -service and -port or -pod, since there's no one to prompt")
+		os.Exit(report.ExitUsage)
+	}
+
+	if cfg.ReadyThreshold < 1 || cfg.ReadyThreshold > 100 {
+		fmt.Fprintln(os.Stderr, "-ready-threshold must be a percentage from 1 to 100")
+		os.Exit(report.ExitUsage)
+	}
+	if cfg.Watch && cfg.Output != "text" {
+		fmt.Fprintln(os.Stderr, "-watch only works with -output text")
+		os.Exit(report.ExitUsage)
+	}
+	if cfg.MetricsAddr != "" && !cfg.NonInteractive() {
+		fmt.Fprintln(os.Stderr, "-metrics-addr requires -namespace, and -service and -port or -pod, since it's for headless runs")
+		os.Exit(report.ExitUsage)
+	}
+
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx := interrupted
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	k := NewKubetrbl(ctx, cfg)
+	if path := defaultLastUsedPath(); path != "" {
+		k.RememberLastUsed(path)
+	}
+	var transcript *os.File
+	if cfg.Transcript != "" {
+		var err error
+		transcript, err = os.Create(cfg.Transcript)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "can't create transcript: "+err.Error())
+			os.Exit(report.ExitUsage)
+		}
+		k.RecordTranscript(transcript)
+	}
+	start := "welcome"
+	if cfg.Quiet {
+		start = "getKubeConfig"
+	}
+	k.Start(start)
+	k.Stop()
+	// the exit code looks at whether we were interrupted, so it has to be taken before stop cancels ctx
+	code := k.ExitCode()
+
+	if cfg.Watch && interrupted.Err() == nil {
+		if err := k.WatchPods(interrupted); err != nil {
+			fmt.Fprintln(os.Stderr, "can't watch pods: "+err.Error())
+		}
+	}
+
+	// the metrics are of a finished run, so they're served until interrupted even once -timeout has passed
+	if cfg.MetricsAddr != "" {
+		if err := k.ServeMetrics(interrupted, cfg.MetricsAddr); err != nil {
+			fmt.Fprintln(os.Stderr, "can't serve metrics: "+err.Error())
+		}
+	}
+
+	stop()
+	// os.Exit skips deferred calls, so the transcript is closed here whether or not we were interrupted
+	if transcript != nil {
+		if err := transcript.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "can't write transcript: "+err.Error())
+		}
+	}
+	os.Exit(code)
 }
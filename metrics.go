@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caseyhadden/kubetrbl/report"
+)
+
+// metricsShutdownTimeout is how long requests still being served get when the metrics server shuts down
+const metricsShutdownTimeout = 5 * time.Second
+
+// portLabels are the service and port a pod-port check's target was probed on
+type portLabels struct {
+	service, port, pod string
+}
+
+// writePrometheus writes gauges of the report's checks in the Prometheus text format. containerPort and servicePort
+// are the ports pod and service targets without one of their own were probed on.
+func writePrometheus(w io.Writer, r report.Report, containerPort, servicePort string) error {
+	pending := map[string]bool{}
+	crashLooping := map[string]bool{}
+	accessible := map[portLabels]int{}
+	statuses := map[string]map[report.Status]int{}
+	for _, c := range r.Checks {
+		if statuses[c.Name] == nil {
+			statuses[c.Name] = map[report.Status]int{}
+		}
+		statuses[c.Name][c.Status]++
+
+		switch {
+		case c.Name == checkPendingPods && c.Status == report.StatusFail:
+			pending[c.Target] = true
+		case c.Name == checkCrashLoopingPods && c.Status == report.StatusFail:
+			crashLooping[strings.SplitN(c.Target, "/", 2)[0]] = true
+		case c.Name == checkPodPort && c.Status != report.StatusSkip:
+			l := labelsFor(r, c.Target, containerPort, servicePort)
+			accessible[l] = 0
+			if c.Status != report.StatusFail {
+				accessible[l] = 1
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintln(&b, "# HELP kubetrbl_pending_pods Pods that are pending.")
+	fmt.Fprintln(&b, "# TYPE kubetrbl_pending_pods gauge")
+	fmt.Fprintf(&b, "kubetrbl_pending_pods{namespace=%s} %d\n", quoteLabel(r.Namespace), len(pending))
+	fmt.Fprintln(&b, "# HELP kubetrbl_crashlooping_pods Pods with a container that's crash looping.")
+	fmt.Fprintln(&b, "# TYPE kubetrbl_crashlooping_pods gauge")
+	fmt.Fprintf(&b, "kubetrbl_crashlooping_pods{namespace=%s} %d\n", quoteLabel(r.Namespace), len(crashLooping))
+
+	if len(accessible) > 0 {
+		fmt.Fprintln(&b, "# HELP kubetrbl_port_accessible Whether a port answered when probed, 1 if it did and 0 if not.")
+		fmt.Fprintln(&b, "# TYPE kubetrbl_port_accessible gauge")
+		keys := make([]portLabels, 0, len(accessible))
+		for l := range accessible {
+			keys = append(keys, l)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].pod != keys[j].pod {
+				return keys[i].pod < keys[j].pod
+			}
+			return keys[i].port < keys[j].port
+		})
+		for _, l := range keys {
+			fmt.Fprintf(&b, "kubetrbl_port_accessible{namespace=%s,service=%s,port=%s,pod=%s} %d\n", quoteLabel(r.Namespace), quoteLabel(l.service), quoteLabel(l.port), quoteLabel(l.pod), accessible[l])
+		}
+	}
+
+	fmt.Fprintln(&b, "# HELP kubetrbl_checks Checks made, by name and outcome.")
+	fmt.Fprintln(&b, "# TYPE kubetrbl_checks gauge")
+	names := make([]string, 0, len(statuses))
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, s := range []report.Status{report.StatusPass, report.StatusWarn, report.StatusFail, report.StatusSkip} {
+			if n, ok := statuses[name][s]; ok {
+				fmt.Fprintf(&b, "kubetrbl_checks{check=%s,status=%s} %d\n", quoteLabel(name), quoteLabel(string(s)), n)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelsFor splits a pod-port check's target, either pod or svc/name with an optional :port, into its labels
+func labelsFor(r report.Report, target, containerPort, servicePort string) portLabels {
+	l := portLabels{service: r.Service, port: containerPort}
+	if strings.HasPrefix(target, "svc/") {
+		target = strings.TrimPrefix(target, "svc/")
+		l.port = servicePort
+	} else {
+		l.pod = target
+	}
+	if i := strings.LastIndex(target, ":"); i >= 0 {
+		l.port = target[i+1:]
+		target = target[:i]
+	}
+	if l.pod != "" {
+		l.pod = target
+	} else {
+		l.service = target
+	}
+	return l
+}
+
+// quoteLabel quotes a label value, escaping what the Prometheus text format requires
+func quoteLabel(v string) string {
+	v = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+	return `"` + v + `"`
+}
+
+// MetricsHandler serves the gauges of the checks made. It's only safe to use once troubleshooting has stopped.
+func (k *Kubetrbl) MetricsHandler() http.Handler {
+	r := k.report()
+	var containerPort, servicePort string
+	if k.k8sContext != nil && len(k.k8sContext.ports) == 1 {
+		containerPort = strconv.Itoa(int(k.k8sContext.ports[0].Container.ContainerPort))
+		servicePort = strconv.Itoa(int(k.k8sContext.ports[0].Service.Port))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writePrometheus(w, r, containerPort, servicePort)
+	})
+}
+
+// ServeMetrics serves the checks made as Prometheus metrics on addr at /metrics until ctx is done
+func (k *Kubetrbl) ServeMetrics(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", k.MetricsHandler())
+	server := &http.Server{Handler: mux}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(l)
+	}()
+	fmt.Fprintf(os.Stderr, "Serving metrics on http://%s/metrics until interrupted.\n", l.Addr())
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdown)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caseyhadden/kubetrbl/report"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestLabelsFor(t *testing.T) {
+	r := report.Report{Namespace: testNamespace, Service: "web"}
+	tests := []struct {
+		target string
+		want   portLabels
+	}{
+		{"web-1", portLabels{service: "web", port: "8080", pod: "web-1"}},
+		{"web-1:9090", portLabels{service: "web", port: "9090", pod: "web-1"}},
+		{"svc/web", portLabels{service: "web", port: "80"}},
+		{"svc/web:9090", portLabels{service: "web", port: "9090"}},
+	}
+	for _, tt := range tests {
+		if got := labelsFor(r, tt.target, "8080", "80"); got != tt.want {
+			t.Errorf("labelsFor(%s) = %+v, want %+v", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	check := func(name, target string, status report.Status) report.CheckResult {
+		return report.CheckResult{Name: name, Target: target, Status: status}
+	}
+	r := report.Report{Namespace: testNamespace, Service: "web", Checks: []report.CheckResult{
+		check(checkPendingPods, "web-1", report.StatusFail),
+		check(checkCrashLoopingPods, "web-2/app", report.StatusFail),
+		// a pod with two crashing containers is one crash looping pod
+		check(checkCrashLoopingPods, "web-2/sidecar", report.StatusFail),
+		check(checkPodPort, "web-3", report.StatusPass),
+		check(checkPodPort, "web-4", report.StatusFail),
+		// a port that was only reachable with server errors is still accessible
+		check(checkPodPort, "svc/web", report.StatusWarn),
+		check(checkPodPort, "web-5", report.StatusSkip),
+	}}
+	var b bytes.Buffer
+
+	if err := writePrometheus(&b, r, "8080", "80"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP kubetrbl_pending_pods Pods that are pending.
+# TYPE kubetrbl_pending_pods gauge
+kubetrbl_pending_pods{namespace="default"} 1
+# HELP kubetrbl_crashlooping_pods Pods with a container that's crash looping.
+# TYPE kubetrbl_crashlooping_pods gauge
+kubetrbl_crashlooping_pods{namespace="default"} 1
+# HELP kubetrbl_port_accessible Whether a port answered when probed, 1 if it did and 0 if not.
+# TYPE kubetrbl_port_accessible gauge
+kubetrbl_port_accessible{namespace="default",service="web",port="80",pod=""} 1
+kubetrbl_port_accessible{namespace="default",service="web",port="8080",pod="web-3"} 1
+kubetrbl_port_accessible{namespace="default",service="web",port="8080",pod="web-4"} 0
+# HELP kubetrbl_checks Checks made, by name and outcome.
+# TYPE kubetrbl_checks gauge
+kubetrbl_checks{check="crash-looping-pods",status="fail"} 2
+kubetrbl_checks{check="pending-pods",status="fail"} 1
+kubetrbl_checks{check="pod-port",status="pass"} 1
+kubetrbl_checks{check="pod-port",status="warn"} 1
+kubetrbl_checks{check="pod-port",status="fail"} 1
+kubetrbl_checks{check="pod-port",status="skip"} 1
+`
+	if got := b.String(); got != want {
+		t.Errorf("writePrometheus wrote\n%s\nwant\n%s", got, want)
+	}
+	if got := quoteLabel("a \"b\"\\\nc"); got != `"a \"b\"\\\nc"` {
+		t.Errorf("quoteLabel = %s", got)
+	}
+}
+
+// scrape gets the metrics the handler serves
+func scrape(t *testing.T, h http.Handler) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4" {
+		t.Errorf("metrics served as %q", ct)
+	}
+	return rec.Body.String()
+}
+
+func TestMetricsHandler(t *testing.T) {
+	k, _ := troubleshoot(t, answered, "countPods", "", testPod("web-1", corev1.PodPending), testPod("web-2", corev1.PodPending))
+	if got := scrape(t, k.MetricsHandler()); !strings.Contains(got, "kubetrbl_pending_pods{namespace=\"default\"} 2\n") {
+		t.Errorf("pending run's metrics are\n%s", got)
+	}
+
+	crashing := testPod("web-1", corev1.PodRunning)
+	crashing.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", 14, 1, "Error")}
+	cfg := answered
+	cfg.Only = []string{onlyRunning}
+	k, _ = troubleshoot(t, cfg, "countPods", "", crashing, testPod("web-2", corev1.PodRunning))
+	got := scrape(t, k.MetricsHandler())
+	for _, want := range []string{"kubetrbl_pending_pods{namespace=\"default\"} 0\n", "kubetrbl_crashlooping_pods{namespace=\"default\"} 1\n", "kubetrbl_checks{check=\"crash-looping-pods\",status=\"fail\"} 1\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("crash looping run's metrics don't have %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	k, _ := troubleshoot(t, answered, "countPods", "", testPod("web-1", corev1.PodPending))
+	// find a free port to serve on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- k.ServeMetrics(ctx, addr)
+	}()
+
+	var resp *http.Response
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if resp, err = http.Get("http://" + addr + "/metrics"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("metrics served %s", resp.Status)
+	}
+
+	// the server shuts down with the context
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("ServeMetrics = %v after shutting down", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeMetrics didn't return once its context was done")
+	}
+	if _, err := http.Get("http://" + addr + "/metrics"); err == nil {
+		t.Errorf("still serving metrics after shutting down")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// PoliciesAffectingPods returns the NetworkPolicies in the namespace that restrict traffic into any of the pods
+func (k *K8sContext) PoliciesAffectingPods(ctx context.Context, pods []corev1.Pod) ([]networkingv1.NetworkPolicy, error) {
+	var policies *networkingv1.NetworkPolicyList
+	err := k.retry(ctx, func() (err error) {
+		policies, err = k.k8sClient.NetworkingV1().NetworkPolicies(k.namespace).List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return []networkingv1.NetworkPolicy{}, err
+	}
+
+	result := []networkingv1.NetworkPolicy{}
+	for _, np := range policies.Items {
+		if !restrictsIngress(np) {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+		if err != nil {
+			return []networkingv1.NetworkPolicy{}, err
+		}
+		for _, p := range pods {
+			if selector.Matches(labels.Set(p.GetLabels())) {
+				result = append(result, np)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// restrictsIngress returns if a policy limits traffic into the pods it selects. A policy without policy types
+// always does.
+func restrictsIngress(np networkingv1.NetworkPolicy) bool {
+	if len(np.Spec.PolicyTypes) == 0 {
+		return true
+	}
+	for _, t := range np.Spec.PolicyTypes {
+		if t == networkingv1.PolicyTypeIngress {
+			return true
+		}
+	}
+	return false
+}
+
+// ingressRulesForPort returns the policy's ingress rules that let traffic through to the container port. A rule
+// without ports covers every port.
+func ingressRulesForPort(np networkingv1.NetworkPolicy, port corev1.ContainerPort) []networkingv1.NetworkPolicyIngressRule {
+	result := []networkingv1.NetworkPolicyIngressRule{}
+	for _, rule := range np.Spec.Ingress {
+		if len(rule.Ports) == 0 {
+			result = append(result, rule)
+			continue
+		}
+		for _, p := range rule.Ports {
+			if policyPortMatches(p, port) {
+				result = append(result, rule)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// policyPortMatches returns if a policy port covers the container port, by number or by name
+func policyPortMatches(p networkingv1.NetworkPolicyPort, port corev1.ContainerPort) bool {
+	protocol := corev1.ProtocolTCP
+	if p.Protocol != nil {
+		protocol = *p.Protocol
+	}
+	if protocol != protocolOf(port.Protocol) {
+		return false
+	}
+	if p.Port == nil {
+		return true
+	}
+	if p.Port.Type == intstr.Int {
+		return p.Port.IntVal == port.ContainerPort
+	}
+	return p.Port.StrVal == port.Name
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// testPolicy makes a NetworkPolicy of the pods matching the labels, with the policy types and ingress rules
+func testPolicy(name string, matchLabels map[string]string, types []networkingv1.PolicyType, rules ...networkingv1.NetworkPolicyIngressRule) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: matchLabels},
+			PolicyTypes: types,
+			Ingress:     rules,
+		},
+	}
+}
+
+func TestPolicyPortMatches(t *testing.T) {
+	udp := corev1.ProtocolUDP
+	tcp := corev1.ProtocolTCP
+	http := corev1.ContainerPort{Name: "http", ContainerPort: 8080}
+	number, name, other := intstr.FromInt(8080), intstr.FromString("http"), intstr.FromInt(9090)
+	tests := []struct {
+		name string
+		port networkingv1.NetworkPolicyPort
+		want bool
+	}{
+		{"every port", networkingv1.NetworkPolicyPort{}, true},
+		{"by number", networkingv1.NetworkPolicyPort{Port: &number}, true},
+		{"by name", networkingv1.NetworkPolicyPort{Port: &name}, true},
+		{"another port", networkingv1.NetworkPolicyPort{Port: &other}, false},
+		{"tcp", networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &number}, true},
+		// the container port is TCP when it doesn't say
+		{"udp", networkingv1.NetworkPolicyPort{Protocol: &udp, Port: &number}, false},
+		{"every udp port", networkingv1.NetworkPolicyPort{Protocol: &udp}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policyPortMatches(tt.port, http); got != tt.want {
+				t.Errorf("policyPortMatches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	dns := corev1.ContainerPort{Name: "dns", ContainerPort: 53, Protocol: corev1.ProtocolUDP}
+	if port := intstr.FromInt(53); !policyPortMatches(networkingv1.NetworkPolicyPort{Protocol: &udp, Port: &port}, dns) {
+		t.Errorf("a UDP policy port doesn't match the UDP container port")
+	}
+}
+
+func TestIngressRulesForPort(t *testing.T) {
+	http, metrics := intstr.FromString("http"), intstr.FromInt(9090)
+	everything := networkingv1.NetworkPolicyIngressRule{}
+	toHTTP := networkingv1.NetworkPolicyIngressRule{Ports: []networkingv1.NetworkPolicyPort{{Port: &metrics}, {Port: &http}}}
+	toMetrics := networkingv1.NetworkPolicyIngressRule{Ports: []networkingv1.NetworkPolicyPort{{Port: &metrics}}}
+	np := testPolicy("web", nil, nil, toMetrics, toHTTP, everything)
+
+	got := ingressRulesForPort(*np, corev1.ContainerPort{Name: "http", ContainerPort: 8080})
+	if want := []networkingv1.NetworkPolicyIngressRule{toHTTP, everything}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ingressRulesForPort = %+v, want %+v", got, want)
+	}
+	if got := ingressRulesForPort(*testPolicy("deny", nil, nil), corev1.ContainerPort{ContainerPort: 8080}); len(got) != 0 {
+		t.Errorf("a default deny policy allows %+v", got)
+	}
+}
+
+func TestPoliciesAffectingPods(t *testing.T) {
+	ingress := []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	egress := []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+	k := NewK8sContextWithClient(fakeClient(
+		// an empty selector picks every pod, and no policy types means ingress
+		testPolicy("default-deny", nil, nil),
+		testPolicy("web", map[string]string{"app": "web"}, ingress),
+		testPolicy("web-egress", map[string]string{"app": "web"}, egress),
+		testPolicy("both", map[string]string{"app": "web"}, append(egress, ingress...)),
+		testPolicy("api", map[string]string{"app": "api"}, ingress),
+	), testNamespace)
+
+	policies, err := k.PoliciesAffectingPods(context.Background(), []corev1.Pod{*testPod("web-1", corev1.PodRunning)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, np := range policies {
+		got = append(got, np.Name)
+	}
+	if want := []string{"default-deny", "web", "both"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PoliciesAffectingPods = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NodeResources compares what a node can give to pods with what the pods scheduled on it request
+type NodeResources struct {
+	Name          string
+	Unschedulable bool
+
+	AllocatableCPU    resource.Quantity
+	AllocatableMemory resource.Quantity
+	RequestedCPU      resource.Quantity
+	RequestedMemory   resource.Quantity
+}
+
+// FreeCPU returns how much CPU is left to request on the node
+func (n NodeResources) FreeCPU() resource.Quantity {
+	free := n.AllocatableCPU.DeepCopy()
+	free.Sub(n.RequestedCPU)
+	return free
+}
+
+// FreeMemory returns how much memory is left to request on the node
+func (n NodeResources) FreeMemory() resource.Quantity {
+	free := n.AllocatableMemory.DeepCopy()
+	free.Sub(n.RequestedMemory)
+	return free
+}
+
+// Fits returns if the node is schedulable and has enough free to satisfy the requests
+func (n NodeResources) Fits(cpu, memory resource.Quantity) bool {
+	freeCPU, freeMemory := n.FreeCPU(), n.FreeMemory()
+	return !n.Unschedulable && freeCPU.Cmp(cpu) >= 0 && freeMemory.Cmp(memory) >= 0
+}
+
+// NodeCapacityReport returns the allocatable and requested resources of every node in the cluster
+func (k *K8sContext) NodeCapacityReport(ctx context.Context) ([]NodeResources, error) {
+	var nodes *corev1.NodeList
+	err := k.retry(ctx, func() (err error) {
+		nodes, err = k.k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return []NodeResources{}, err
+	}
+
+	// pods from every namespace count against a node
+	requested := map[string][]corev1.Pod{}
+	opts := metav1.ListOptions{Limit: listPageSize}
+	for {
+		var pods *corev1.PodList
+		err := k.retry(ctx, func() (err error) {
+			pods, err = k.k8sClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return []NodeResources{}, err
+		}
+		for _, p := range pods.Items {
+			// finished pods no longer hold on to what they requested
+			if p.Spec.NodeName == "" || p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+				continue
+			}
+			requested[p.Spec.NodeName] = append(requested[p.Spec.NodeName], p)
+		}
+		if pods.Continue == "" {
+			break
+		}
+		opts.Continue = pods.Continue
+	}
+
+	result := []NodeResources{}
+	for _, n := range nodes.Items {
+		nr := NodeResources{
+			Name:              n.GetName(),
+			Unschedulable:     n.Spec.Unschedulable,
+			AllocatableCPU:    n.Status.Allocatable[corev1.ResourceCPU],
+			AllocatableMemory: n.Status.Allocatable[corev1.ResourceMemory],
+		}
+		for _, p := range requested[n.GetName()] {
+			cpu, memory := podRequests(p)
+			nr.RequestedCPU.Add(cpu)
+			nr.RequestedMemory.Add(memory)
+		}
+		result = append(result, nr)
+	}
+	return result, nil
+}
+
+// podRequests returns the CPU and memory the scheduler needs to find for a pod. Init containers run one at a
+// time before the others, so the pod needs the larger of the biggest init container and all other containers.
+func podRequests(pod corev1.Pod) (resource.Quantity, resource.Quantity) {
+	cpu, memory := resource.Quantity{}, resource.Quantity{}
+	for _, c := range pod.Spec.Containers {
+		cpu.Add(c.Resources.Requests[corev1.ResourceCPU])
+		memory.Add(c.Resources.Requests[corev1.ResourceMemory])
+	}
+	for _, c := range pod.Spec.InitContainers {
+		if q := c.Resources.Requests[corev1.ResourceCPU]; q.Cmp(cpu) > 0 {
+			cpu = q.DeepCopy()
+		}
+		if q := c.Resources.Requests[corev1.ResourceMemory]; q.Cmp(memory) > 0 {
+			memory = q.DeepCopy()
+		}
+	}
+	return cpu, memory
+}
+
+// UntoleratedTaints returns, for each schedulable node, the NoSchedule and NoExecute taints the pod doesn't tolerate.
+// Nodes the pod could be scheduled to are left out.
+func (k *K8sContext) UntoleratedTaints(ctx context.Context, pod corev1.Pod) (map[string][]string, error) {
+	result := map[string][]string{}
+	var nodes *corev1.NodeList
+	err := k.retry(ctx, func() (err error) {
+		nodes, err = k.k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for _, n := range nodes.Items {
+		if n.Spec.Unschedulable {
+			continue
+		}
+		taints := untoleratedTaints(n.Spec.Taints, pod.Spec.Tolerations)
+		if len(taints) > 0 {
+			result[n.GetName()] = taints
+		}
+	}
+	return result, nil
+}
+
+// untoleratedTaints returns the taints that keep a pod off a node which none of the tolerations match.
+// A toleration with an empty key and the Exists operator matches every taint.
+func untoleratedTaints(taints []corev1.Taint, tolerations []corev1.Toleration) []string {
+	result := []string{}
+	for i := range taints {
+		taint := &taints[i]
+		if taint.Effect != corev1.TaintEffectNoSchedule && taint.Effect != corev1.TaintEffectNoExecute {
+			continue
+		}
+
+		tolerated := false
+		for j := range tolerations {
+			if tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			result = append(result, taint.ToString())
+		}
+	}
+	sort.Strings(result)
+	return result
+}
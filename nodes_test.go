@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/caseyhadden/kubetrbl/report"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// requests makes the resources of a container that requests the cpu and memory
+func requests(cpu, memory string) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{Requests: corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+	}}
+}
+
+// testNode makes a node with the cpu and memory allocatable to pods
+func testNode(name, cpu, memory string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}},
+	}
+}
+
+// scheduled makes a pod on the node whose containers request the cpu and memory
+func scheduled(name, node string, phase corev1.PodPhase, cpu, memory string) *corev1.Pod {
+	pod := testPod(name, phase)
+	pod.Spec.NodeName = node
+	pod.Spec.Containers[0].Resources = requests(cpu, memory)
+	return pod
+}
+
+func TestPodRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		containers  []corev1.ResourceRequirements
+		init        []corev1.ResourceRequirements
+		cpu, memory string
+	}{
+		{"none", []corev1.ResourceRequirements{{}}, nil, "0", "0"},
+		{"containers add up", []corev1.ResourceRequirements{requests("100m", "64Mi"), requests("250m", "128Mi")}, nil, "350m", "192Mi"},
+		{"smaller init containers", []corev1.ResourceRequirements{requests("500m", "256Mi")}, []corev1.ResourceRequirements{requests("100m", "64Mi"), requests("200m", "128Mi")}, "500m", "256Mi"},
+		// init containers run one at a time, so only the biggest counts, and only when it's bigger than the rest
+		{"bigger init container", []corev1.ResourceRequirements{requests("100m", "64Mi"), requests("100m", "64Mi")}, []corev1.ResourceRequirements{requests("1", "64Mi"), requests("300m", "1Gi")}, "1", "1Gi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := corev1.Pod{}
+			for _, r := range tt.containers {
+				pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Resources: r})
+			}
+			for _, r := range tt.init {
+				pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{Resources: r})
+			}
+			cpu, memory := podRequests(pod)
+			if cpu.Cmp(resource.MustParse(tt.cpu)) != 0 || memory.Cmp(resource.MustParse(tt.memory)) != 0 {
+				t.Errorf("podRequests = %s CPU / %s memory, want %s / %s", cpu.String(), memory.String(), tt.cpu, tt.memory)
+			}
+		})
+	}
+}
+
+func TestNodeCapacityReport(t *testing.T) {
+	cordoned := testNode("node-2", "4", "8Gi")
+	cordoned.Spec.Unschedulable = true
+	elsewhere := scheduled("db-1", "node-1", corev1.PodRunning, "500m", "1Gi")
+	elsewhere.Namespace = "other"
+	k := NewK8sContextWithClient(fakeClient(
+		testNode("node-1", "2", "4Gi"), cordoned,
+		scheduled("web-1", "node-1", corev1.PodRunning, "1", "1Gi"),
+		// pods in other namespaces count too, but finished and unscheduled ones don't
+		elsewhere,
+		scheduled("job-1", "node-1", corev1.PodSucceeded, "1", "1Gi"),
+		scheduled("web-2", "", corev1.PodPending, "1", "1Gi"),
+	), testNamespace)
+
+	nodes, err := k.NodeCapacityReport(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("NodeCapacityReport = %+v, want both nodes", nodes)
+	}
+	n := nodes[0]
+	if cpu, memory := n.FreeCPU(), n.FreeMemory(); cpu.Cmp(resource.MustParse("500m")) != 0 || memory.Cmp(resource.MustParse("2Gi")) != 0 {
+		t.Errorf("node-1 has %s CPU / %s memory free, want 500m / 2Gi", cpu.String(), memory.String())
+	}
+	if !n.Fits(resource.MustParse("500m"), resource.MustParse("2Gi")) || n.Fits(resource.MustParse("501m"), resource.MustParse("1Gi")) {
+		t.Errorf("node-1 doesn't fit exactly what it has free")
+	}
+	if !nodes[1].Unschedulable || nodes[1].Fits(resource.MustParse("1m"), resource.MustParse("1Mi")) {
+		t.Errorf("cordoned node-2 fits pods: %+v", nodes[1])
+	}
+}
+
+func TestCheckNodeCapacity(t *testing.T) {
+	tests := []struct {
+		name        string
+		cpu, memory string
+		fits        bool
+	}{
+		{"fits", "500m", "1Gi", true},
+		{"too much cpu", "3", "1Gi", false},
+		// the cordoned node has plenty, but nothing can be scheduled there
+		{"only on a cordoned node", "1", "6Gi", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cordoned := testNode("node-2", "8", "16Gi")
+			cordoned.Spec.Unschedulable = true
+			objs := []runtime.Object{
+				testNode("node-1", "2", "4Gi"), cordoned,
+				scheduled("web-1", "node-1", corev1.PodRunning, "1", "1Gi"),
+				scheduled("web-2", "", corev1.PodPending, tt.cpu, tt.memory),
+			}
+			k, _ := troubleshoot(t, answered, "countPods", "", objs...)
+			checks := checksNamed(k, checkNodeCapacity)
+			if tt.fits && len(checks) != 0 {
+				t.Errorf("pod that fits failed %+v", checks)
+			}
+			if !tt.fits {
+				wantCheck(t, k, checkNodeCapacity, "web-2", report.StatusFail)
+			}
+		})
+	}
+}
+
+func TestUntoleratedTaints(t *testing.T) {
+	controlPlane := corev1.Taint{Key: "node-role.kubernetes.io/control-plane", Effect: corev1.TaintEffectNoSchedule}
+	gpu := corev1.Taint{Key: "gpu", Value: "true", Effect: corev1.TaintEffectNoExecute}
+	tests := []struct {
+		name        string
+		taints      []corev1.Taint
+		tolerations []corev1.Toleration
+		want        []string
+	}{
+		{"untainted", nil, nil, []string{}},
+		{"no tolerations", []corev1.Taint{gpu, controlPlane}, nil, []string{"gpu=true:NoExecute", "node-role.kubernetes.io/control-plane:NoSchedule"}},
+		{"only prefers", []corev1.Taint{{Key: "spot", Effect: corev1.TaintEffectPreferNoSchedule}}, nil, []string{}},
+		{"exists", []corev1.Taint{controlPlane}, []corev1.Toleration{{Key: controlPlane.Key, Operator: corev1.TolerationOpExists}}, []string{}},
+		{"equal", []corev1.Taint{gpu}, []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpEqual, Value: "true"}}, []string{}},
+		{"wrong value", []corev1.Taint{gpu}, []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpEqual, Value: "false"}}, []string{"gpu=true:NoExecute"}},
+		{"wrong effect", []corev1.Taint{gpu}, []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}, []string{"gpu=true:NoExecute"}},
+		{"wildcard", []corev1.Taint{gpu, controlPlane}, []corev1.Toleration{{Operator: corev1.TolerationOpExists}}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := untoleratedTaints(tt.taints, tt.tolerations); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("untoleratedTaints = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckNodeTaints(t *testing.T) {
+	tainted := func(name string) *corev1.Node {
+		n := testNode(name, "2", "4Gi")
+		n.Spec.Taints = []corev1.Taint{{Key: "node-role.kubernetes.io/control-plane", Effect: corev1.TaintEffectNoSchedule}}
+		return n
+	}
+	cordoned := testNode("node-3", "2", "4Gi")
+	cordoned.Spec.Unschedulable = true
+
+	// a cordoned node without taints is still no place for the pod
+	k, _ := troubleshoot(t, answered, "countPods", "", tainted("node-1"), tainted("node-2"), cordoned, testPod("web-1", corev1.PodPending))
+	c := wantCheck(t, k, checkNodeTaints, "web-1", report.StatusFail)
+	if !strings.Contains(c.Message, "node-role.kubernetes.io/control-plane:NoSchedule") {
+		t.Errorf("taints check said %q, want the taint every node has", c.Message)
+	}
+
+	k, _ = troubleshoot(t, answered, "countPods", "", tainted("node-1"), testNode("node-2", "2", "4Gi"), testPod("web-1", corev1.PodPending))
+	if checks := checksNamed(k, checkNodeTaints); len(checks) != 0 {
+		t.Errorf("pod with an untainted node to go to failed %+v", checks)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import corev1 "k8s.io/api/core/v1"
+
+// crashLoopRestarts is how many restarts we take to mean a container is crash looping, even between back-offs
+const crashLoopRestarts = 3
+
+// IsPending returns if the pod hasn't been scheduled or had all its containers started
+func IsPending(pod corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodPending
+}
+
+// IsRunning returns if the pod is bound to a node with at least one container running
+func IsRunning(pod corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodRunning
+}
+
+// IsReady returns if the pod's Ready condition is true. Only the first Ready condition counts, should a pod report
+// more than one.
+func IsReady(pod corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// IsCrashLooping returns if any of the pod's containers is crash looping
+func IsCrashLooping(pod corev1.Pod) bool {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if containerCrashLooping(cs) {
+			return true
+		}
+	}
+	return false
+}
+
+// containerCrashLooping returns if the container is backing off after crashing, or has restarted repeatedly
+func containerCrashLooping(cs corev1.ContainerStatus) bool {
+	backingOff := cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff"
+	return backingOff || cs.RestartCount >= crashLoopRestarts
+}
+
+// hasCondition returns if the pod reports a condition of the type
+func hasCondition(pod corev1.Pod, t corev1.PodConditionType) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// withConditions sets the pod's Ready conditions to the statuses, in order
+func withConditions(pod *corev1.Pod, statuses ...corev1.ConditionStatus) *corev1.Pod {
+	for _, s := range statuses {
+		pod.Status.Conditions = append(pod.Status.Conditions, corev1.PodCondition{Type: corev1.PodReady, Status: s})
+	}
+	return pod
+}
+
+func TestIsPending(t *testing.T) {
+	for phase, want := range map[corev1.PodPhase]bool{
+		corev1.PodPending:   true,
+		corev1.PodRunning:   false,
+		corev1.PodSucceeded: false,
+		corev1.PodFailed:    false,
+		corev1.PodUnknown:   false,
+	} {
+		if got := IsPending(*testPod("web-1", phase)); got != want {
+			t.Errorf("IsPending of a %s pod = %v, want %v", phase, got, want)
+		}
+	}
+}
+
+func TestIsRunning(t *testing.T) {
+	for phase, want := range map[corev1.PodPhase]bool{
+		corev1.PodPending:   false,
+		corev1.PodRunning:   true,
+		corev1.PodSucceeded: false,
+		corev1.PodFailed:    false,
+		corev1.PodUnknown:   false,
+	} {
+		if got := IsRunning(*testPod("web-1", phase)); got != want {
+			t.Errorf("IsRunning of a %s pod = %v, want %v", phase, got, want)
+		}
+	}
+}
+
+func TestIsReady(t *testing.T) {
+	scheduled := corev1.PodCondition{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}
+	tests := []struct {
+		name     string
+		statuses []corev1.ConditionStatus
+		want     bool
+	}{
+		{"ready", []corev1.ConditionStatus{corev1.ConditionTrue}, true},
+		{"not ready", []corev1.ConditionStatus{corev1.ConditionFalse}, false},
+		{"unknown", []corev1.ConditionStatus{corev1.ConditionUnknown}, false},
+		{"no condition", nil, false},
+		// only the first of duplicated conditions counts
+		{"duplicated", []corev1.ConditionStatus{corev1.ConditionFalse, corev1.ConditionFalse}, false},
+		{"ready then not", []corev1.ConditionStatus{corev1.ConditionTrue, corev1.ConditionFalse}, true},
+		{"not then ready", []corev1.ConditionStatus{corev1.ConditionFalse, corev1.ConditionTrue}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod("web-1", corev1.PodRunning)
+			// other conditions don't count
+			pod.Status.Conditions = []corev1.PodCondition{scheduled}
+			if got := IsReady(*withConditions(pod, tt.statuses...)); got != tt.want {
+				t.Errorf("IsReady = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCrashLooping(t *testing.T) {
+	backingOff := corev1.ContainerStatus{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}}
+	creating := corev1.ContainerStatus{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}}
+	tests := []struct {
+		name     string
+		statuses []corev1.ContainerStatus
+		want     bool
+	}{
+		{"backing off", []corev1.ContainerStatus{backingOff}, true},
+		// restarting repeatedly is crash looping even between back-offs
+		{"restarted", []corev1.ContainerStatus{{Name: "app", RestartCount: crashLoopRestarts}}, true},
+		{"restarted less", []corev1.ContainerStatus{{Name: "app", RestartCount: crashLoopRestarts - 1}}, false},
+		{"waiting otherwise", []corev1.ContainerStatus{creating}, false},
+		{"no containers started", nil, false},
+		// any container crash looping is enough
+		{"sidecar", []corev1.ContainerStatus{{Name: "app"}, {Name: "sidecar", RestartCount: 10}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod("web-1", corev1.PodRunning)
+			pod.Status.ContainerStatuses = tt.statuses
+			if got := IsCrashLooping(*pod); got != tt.want {
+				t.Errorf("IsCrashLooping = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
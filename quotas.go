@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// QuotaStatus returns the ResourceQuotas in the namespace, with how much of each they've used
+func (k *K8sContext) QuotaStatus(ctx context.Context) ([]corev1.ResourceQuota, error) {
+	var quotas *corev1.ResourceQuotaList
+	err := k.retry(ctx, func() (err error) {
+		quotas, err = k.k8sClient.CoreV1().ResourceQuotas(k.namespace).List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return []corev1.ResourceQuota{}, err
+	}
+	return quotas.Items, nil
+}
+
+// LimitRanges returns the LimitRanges in the namespace
+func (k *K8sContext) LimitRanges(ctx context.Context) ([]corev1.LimitRange, error) {
+	var ranges *corev1.LimitRangeList
+	err := k.retry(ctx, func() (err error) {
+		ranges, err = k.k8sClient.CoreV1().LimitRanges(k.namespace).List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return []corev1.LimitRange{}, err
+	}
+	return ranges.Items, nil
+}
+
+// quotaResources are the resources whose quotas stop new pods being created once they're used up
+var quotaResources = []corev1.ResourceName{
+	corev1.ResourceCPU,
+	corev1.ResourceMemory,
+	corev1.ResourcePods,
+	corev1.ResourceRequestsCPU,
+	corev1.ResourceRequestsMemory,
+	corev1.ResourceLimitsCPU,
+	corev1.ResourceLimitsMemory,
+}
+
+// exhaustedQuota returns a description of each resource in the quota that has used all it's allowed
+func exhaustedQuota(q corev1.ResourceQuota) []string {
+	result := []string{}
+	for _, r := range quotaResources {
+		hard, ok := q.Status.Hard[r]
+		if !ok {
+			continue
+		}
+		used := q.Status.Used[r]
+		if used.Cmp(hard) >= 0 {
+			result = append(result, fmt.Sprintf("%s %s of %s used", r, used.String(), hard.String()))
+		}
+	}
+	return result
+}
+
+// limitRangeProblems returns a description of each way the LimitRange would reject the pod's containers, either
+// for requesting less than its minimum, including by setting no request it can default, or for a limit over its
+// maximum
+func limitRangeProblems(lr corev1.LimitRange, pod corev1.Pod) []string {
+	result := []string{}
+	for _, item := range lr.Spec.Limits {
+		if item.Type != corev1.LimitTypeContainer {
+			continue
+		}
+		for _, c := range pod.Spec.Containers {
+			for _, r := range sortedResourceNames(item.Min) {
+				minimum := item.Min[r]
+				// a container that limits a resource but doesn't request it requests its limit
+				request, ok := defaulted(r, c.Resources.Requests, c.Resources.Limits, item.DefaultRequest, item.Default)
+				switch {
+				case !ok:
+					result = append(result, fmt.Sprintf("container '%s' sets no %s request, and LimitRange '%s' requires at least %s", c.Name, r, lr.GetName(), minimum.String()))
+				case request.Cmp(minimum) < 0:
+					result = append(result, fmt.Sprintf("container '%s' requests %s %s, under LimitRange '%s' minimum of %s", c.Name, request.String(), r, lr.GetName(), minimum.String()))
+				}
+			}
+			for _, r := range sortedResourceNames(item.Max) {
+				maximum := item.Max[r]
+				limit, ok := defaulted(r, c.Resources.Limits, item.Default)
+				if ok && limit.Cmp(maximum) > 0 {
+					result = append(result, fmt.Sprintf("container '%s' limits %s to %s, over LimitRange '%s' maximum of %s", c.Name, r, limit.String(), lr.GetName(), maximum.String()))
+				}
+			}
+		}
+	}
+	return result
+}
+
+// defaulted returns the resource from the first of the lists to have it, such as the container's own and then the
+// LimitRange's defaults
+func defaulted(r corev1.ResourceName, lists ...corev1.ResourceList) (resource.Quantity, bool) {
+	for _, list := range lists {
+		if q, ok := list[r]; ok {
+			return q, true
+		}
+	}
+	return resource.Quantity{}, false
+}
+
+// sortedResourceNames returns the names in a resource list in a stable order
+func sortedResourceNames(list corev1.ResourceList) []corev1.ResourceName {
+	result := make([]corev1.ResourceName, 0, len(list))
+	for r := range list {
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+	return result
+}
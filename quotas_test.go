@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/caseyhadden/kubetrbl/report"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testQuota makes a ResourceQuota that has used the first of each pair of quantities out of the second
+func testQuota(name string, usedHard map[corev1.ResourceName][2]string) *corev1.ResourceQuota {
+	q := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Status:     corev1.ResourceQuotaStatus{Hard: corev1.ResourceList{}, Used: corev1.ResourceList{}},
+	}
+	for r, uh := range usedHard {
+		q.Status.Used[r] = resource.MustParse(uh[0])
+		q.Status.Hard[r] = resource.MustParse(uh[1])
+	}
+	return q
+}
+
+func TestExhaustedQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		usedHard map[corev1.ResourceName][2]string
+		want     []string
+	}{
+		{"under", map[corev1.ResourceName][2]string{corev1.ResourceRequestsCPU: {"1500m", "2"}, corev1.ResourcePods: {"9", "10"}}, []string{}},
+		{"at", map[corev1.ResourceName][2]string{corev1.ResourcePods: {"10", "10"}}, []string{"pods 10 of 10 used"}},
+		// a quota lowered below what's already used
+		{"over", map[corev1.ResourceName][2]string{corev1.ResourceLimitsMemory: {"6Gi", "4Gi"}}, []string{"limits.memory 6Gi of 4Gi used"}},
+		// units don't matter to the comparison
+		{"units", map[corev1.ResourceName][2]string{corev1.ResourceCPU: {"2000m", "2"}, corev1.ResourceMemory: {"1Gi", "1025Mi"}}, []string{"cpu 2 of 2 used"}},
+		// other quotas don't stop pods starting
+		{"services", map[corev1.ResourceName][2]string{corev1.ResourceServices: {"5", "5"}}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exhaustedQuota(*testQuota("compute", tt.usedHard)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("exhaustedQuota = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// nothing used yet isn't reported as missing
+	q := testQuota("compute", map[corev1.ResourceName][2]string{corev1.ResourcePods: {"0", "10"}})
+	delete(q.Status.Used, corev1.ResourcePods)
+	if got := exhaustedQuota(*q); len(got) != 0 {
+		t.Errorf("exhaustedQuota of a new quota = %q, want none", got)
+	}
+}
+
+func TestLimitRangeProblems(t *testing.T) {
+	lr := &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: testNamespace},
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{
+			{Type: corev1.LimitTypeContainer, Min: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}, Max: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}},
+			// pod limits are for the pod as a whole
+			{Type: corev1.LimitTypePod, Min: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}},
+		}},
+	}
+	limited := corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m"), corev1.ResourceMemory: resource.MustParse("2Gi")}}
+	tests := []struct {
+		name      string
+		resources corev1.ResourceRequirements
+		defaults  bool
+		want      []string
+	}{
+		{"within", requests("250m", "128Mi"), false, []string{}},
+		{"no requests", corev1.ResourceRequirements{}, false, []string{"container 'app' sets no cpu request, and LimitRange 'limits' requires at least 100m"}},
+		{"under", requests("50m", "128Mi"), false, []string{"container 'app' requests 50m cpu, under LimitRange 'limits' minimum of 100m"}},
+		// a limit without a request is the request too, ahead of any default request
+		{"limited", limited, true, []string{"container 'app' limits memory to 2Gi, over LimitRange 'limits' maximum of 1Gi"}},
+		{"default request", corev1.ResourceRequirements{}, true, []string{"container 'app' requests 10m cpu, under LimitRange 'limits' minimum of 100m", "container 'app' limits memory to 4Gi, over LimitRange 'limits' maximum of 1Gi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lr := lr.DeepCopy()
+			if tt.defaults {
+				lr.Spec.Limits[0].DefaultRequest = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")}
+				lr.Spec.Limits[0].Default = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("4Gi")}
+			}
+			pod := testPod("web-1", corev1.PodPending)
+			pod.Spec.Containers[0].Resources = tt.resources
+			if got := limitRangeProblems(*lr, *pod); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("limitRangeProblems = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckResourceQuotas(t *testing.T) {
+	pending := testPod("web-1", corev1.PodPending)
+	cfg := answered
+	cfg.Only = []string{onlyPending}
+	full := testQuota("compute", map[corev1.ResourceName][2]string{corev1.ResourcePods: {"10", "10"}, corev1.ResourceRequestsCPU: {"4", "4"}})
+
+	k, _ := troubleshoot(t, cfg, "countPods", "", pending, full, testQuota("spare", map[corev1.ResourceName][2]string{corev1.ResourcePods: {"1", "10"}}))
+
+	c := wantCheck(t, k, checkResourceQuota, "compute", report.StatusWarn)
+	if want := "Likely cause: ResourceQuota 'compute' is at its hard limit (pods 10 of 10 used, requests.cpu 4 of 4 used)."; c.Message != want {
+		t.Errorf("quota check said %q, want %q", c.Message, want)
+	}
+	if len(checksNamed(k, checkResourceQuota)) != 1 {
+		t.Errorf("quota checks %+v, want only compute's", checksNamed(k, checkResourceQuota))
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import "github.com/caseyhadden/kubetrbl/report"
+
+// the names of the checks we report on
+const (
+	checkError            = "error"
+	checkNamespaces       = "namespaces"
+	checkServerVersion    = "server-version"
+	checkServices         = "services"
+	checkServicePorts     = "service-ports"
+	checkPendingPods      = "pending-pods"
+	checkPodScheduling    = "pod-scheduling"
+	checkNodeCapacity     = "node-capacity"
+	checkVolumeClaims     = "volume-claims"
+	checkNodeTaints       = "node-taints"
+	checkResourceQuota    = "resource-quota"
+	checkLimitRange       = "limit-range"
+	checkRunningPods      = "running-pods"
+	checkPodStatus        = "pod-status"
+	checkContainerStatus  = "container-status"
+	checkInitContainers   = "init-containers"
+	checkConfigReferences = "config-references"
+	checkCrashLoopingPods = "crash-looping-pods"
+	checkLivenessProbe    = "liveness-probe"
+	checkResourceUsage    = "resource-usage"
+	checkReadyPods        = "ready-pods"
+	checkPodReadiness     = "pod-readiness"
+	checkReadinessProbe   = "readiness-probe"
+	checkServiceEndpoints = "service-endpoints"
+	checkServiceSelector  = "service-selector"
+	checkController       = "controller"
+	checkRollout          = "rollout"
+	checkReplicas         = "replicas"
+	checkHPA              = "hpa"
+	checkContainerPort    = "container-port"
+	checkPodPort          = "pod-port"
+	checkIngress          = "ingress"
+	checkDNS              = "dns"
+	checkNetworkPolicy    = "network-policy"
+)
+
+// checkCategories maps the names of checks to the title of their report.Category
+var checkCategories = map[string]string{
+	checkError:            report.CategoryErrors,
+	checkNamespaces:       report.CategoryErrors,
+	checkServerVersion:    report.CategoryCluster,
+	checkPendingPods:      report.CategoryPendingPods,
+	checkPodScheduling:    report.CategoryPendingPods,
+	checkNodeCapacity:     report.CategoryPendingPods,
+	checkVolumeClaims:     report.CategoryPendingPods,
+	checkNodeTaints:       report.CategoryPendingPods,
+	checkResourceQuota:    report.CategoryPendingPods,
+	checkLimitRange:       report.CategoryPendingPods,
+	checkRunningPods:      report.CategoryNotRunning,
+	checkPodStatus:        report.CategoryNotRunning,
+	checkContainerStatus:  report.CategoryNotRunning,
+	checkInitContainers:   report.CategoryNotRunning,
+	checkConfigReferences: report.CategoryNotRunning,
+	checkCrashLoopingPods: report.CategoryCrashLoops,
+	checkLivenessProbe:    report.CategoryCrashLoops,
+	checkResourceUsage:    report.CategoryCrashLoops,
+	checkReadyPods:        report.CategoryNotReady,
+	checkPodReadiness:     report.CategoryNotReady,
+	checkReadinessProbe:   report.CategoryNotReady,
+	checkRollout:          report.CategoryNotReady,
+	checkReplicas:         report.CategoryNotReady,
+	checkHPA:              report.CategoryNotReady,
+	checkServices:         report.CategoryService,
+	checkServicePorts:     report.CategoryService,
+	checkServiceEndpoints: report.CategoryService,
+	checkServiceSelector:  report.CategoryService,
+	checkController:       report.CategoryService,
+	checkContainerPort:    report.CategoryPort,
+	checkPodPort:          report.CategoryPort,
+	checkNetworkPolicy:    report.CategoryNetworkPolicies,
+	checkIngress:          report.CategoryIngress,
+	checkDNS:              report.CategoryService,
+}
+
+// categoryOf returns the title of the category the named check belongs to
+func categoryOf(name string) string {
+	if title, ok := checkCategories[name]; ok {
+		return title
+	}
+	return report.CategoryErrors
+}
+
+// OutputJSON is the output format that replaces the usual chatter with a JSON Report once we're finished
+const OutputJSON = "json"
+
+// OutputJSONLines is the output format that replaces the usual chatter with a line of JSON for each CheckResult as
+// soon as it's made
+const OutputJSONLines = "jsonl"
@@ -0,0 +1,95 @@
+// Package report is the outcome of troubleshooting: a CheckResult for each check made, gathered into a Report that's
+// rendered as a summary for people or as JSON for tools.
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+	StatusWarn Status = "warn"
+	StatusSkip Status = "skip"
+)
+
+// exit codes reflecting the outcome of troubleshooting, from the first check that failed
+const (
+	ExitOK          = 0
+	ExitError       = 1
+	ExitUsage       = 2
+	ExitPending     = 3
+	ExitNotRunning  = 4
+	ExitNotReady    = 5
+	ExitService     = 6
+	ExitPort        = 7
+	ExitIngress     = 8
+	ExitTimedOut    = 124
+	ExitInterrupted = 130
+)
+
+// CheckResult is the outcome of a single check against a pod, service, or namespace
+type CheckResult struct {
+	Name string `json:"name"`
+	// Category is the Title of the Category the check belongs to
+	Category string `json:"category"`
+	Target   string `json:"target,omitempty"`
+	Status   Status `json:"status"`
+	Message  string `json:"message"`
+	// Remediation is what to try next, for checks that failed or warned
+	Remediation string    `json:"remediation,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// NewCheckResult makes the result of the named check in the category, with the category's next action as its
+// remediation when the check found a problem
+func NewCheckResult(name, category, target string, status Status, message string) CheckResult {
+	r := CheckResult{Name: name, Category: category, Target: target, Status: status, Message: message, Timestamp: time.Now()}
+	if status == StatusFail || status == StatusWarn {
+		if cat, ok := CategoryFor(category); ok {
+			r.Remediation = cat.NextAction
+		}
+	}
+	return r
+}
+
+// Report is every check made while troubleshooting
+type Report struct {
+	Namespace string `json:"namespace,omitempty"`
+	Service   string `json:"service,omitempty"`
+	// Controllers are the Kind/name of the controller owning each pod the service sends traffic to, when there's
+	// more than one controller
+	Controllers map[string]string `json:"controllers,omitempty"`
+	Checks      []CheckResult     `json:"checks"`
+}
+
+// ExitCode returns the exit code for the category of the first failed check in the report, or ExitOK if none failed
+func (r Report) ExitCode() int {
+	for _, c := range r.Checks {
+		if c.Status != StatusFail {
+			continue
+		}
+		if cat, ok := CategoryFor(c.Category); ok {
+			return cat.ExitCode
+		}
+		return ExitError
+	}
+	return ExitOK
+}
+
+// WriteJSON writes the report as indented JSON
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteJSONLine writes the result as a single line of JSON
+func (r CheckResult) WriteJSONLine(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r)
+}
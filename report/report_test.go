@@ -0,0 +1,112 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewCheckResult(t *testing.T) {
+	before := time.Now()
+	c := NewCheckResult("pending-pods", CategoryPendingPods, "web-1", StatusFail, "Pod 'web-1' is pending.")
+	if c.Name != "pending-pods" || c.Category != CategoryPendingPods || c.Target != "web-1" || c.Status != StatusFail || c.Message != "Pod 'web-1' is pending." {
+		t.Errorf("NewCheckResult = %+v", c)
+	}
+	if c.Timestamp.Before(before) {
+		t.Errorf("timestamp %s is before the check was made", c.Timestamp)
+	}
+	if want := "Check node capacity, taints, and volume claims with 'kubectl describe pod'."; c.Remediation != want {
+		t.Errorf("remediation is %q, want the category's next action", c.Remediation)
+	}
+
+	// checks that found nothing wrong, or in no category we know, have nothing to remediate
+	for _, c := range []CheckResult{
+		NewCheckResult("pending-pods", CategoryPendingPods, "", StatusPass, "No pods are pending."),
+		NewCheckResult("pod-port", CategoryPort, "web-1", StatusSkip, "Dry run."),
+		NewCheckResult("custom", "Custom", "", StatusFail, "Something's wrong."),
+	} {
+		if c.Remediation != "" {
+			t.Errorf("%s check that's %s has remediation %q", c.Name, c.Status, c.Remediation)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	check := func(category string, status Status) CheckResult {
+		return CheckResult{Name: "check", Category: category, Status: status}
+	}
+	tests := []struct {
+		name   string
+		checks []CheckResult
+		want   int
+	}{
+		{"none", nil, ExitOK},
+		{"passed", []CheckResult{check(CategoryPendingPods, StatusPass), check(CategoryPort, StatusWarn)}, ExitOK},
+		// the first failure decides
+		{"failed", []CheckResult{check(CategoryService, StatusWarn), check(CategoryNotReady, StatusFail), check(CategoryPort, StatusFail)}, ExitNotReady},
+		{"unknown category", []CheckResult{check("Custom", StatusFail), check(CategoryPort, StatusFail)}, ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Report{Checks: tt.checks}).ExitCode(); got != tt.want {
+				t.Errorf("ExitCode = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := Report{Namespace: "default", Service: "web", Checks: []CheckResult{
+		{Name: "pending-pods", Category: CategoryPendingPods, Target: "web-1", Status: StatusFail, Message: "Pod 'web-1' is pending.", Remediation: "Check it.", Timestamp: at},
+		{Name: "service-endpoints", Category: CategoryService, Status: StatusPass, Message: "Service 'web' has endpoints.", Timestamp: at},
+	}}
+	var b bytes.Buffer
+
+	if err := r.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{
+  "namespace": "default",
+  "service": "web",
+  "checks": [
+    {
+      "name": "pending-pods",
+      "category": "Pending pods",
+      "target": "web-1",
+      "status": "fail",
+      "message": "Pod 'web-1' is pending.",
+      "remediation": "Check it.",
+      "timestamp": "2024-03-01T12:00:00Z"
+    },
+    {
+      "name": "service-endpoints",
+      "category": "Service",
+      "status": "pass",
+      "message": "Service 'web' has endpoints.",
+      "timestamp": "2024-03-01T12:00:00Z"
+    }
+  ]
+}
+`
+	if b.String() != want {
+		t.Errorf("WriteJSON wrote\n%s\nwant\n%s", b.String(), want)
+	}
+	// a report without checks still has the key, while the namespace and service are left out
+	b.Reset()
+	if err := (Report{}).WriteJSON(&b); err != nil || b.String() != "{\n  \"checks\": null\n}\n" {
+		t.Errorf("WriteJSON of an empty report wrote %s, %v", b.String(), err)
+	}
+
+	b.Reset()
+	if err := r.Checks[1].WriteJSONLine(&b); err != nil {
+		t.Fatal(err)
+	}
+	var c CheckResult
+	if err := json.Unmarshal(b.Bytes(), &c); err != nil || c != r.Checks[1] || strings.Count(b.String(), "\n") != 1 {
+		t.Errorf("WriteJSONLine wrote %q, which reads back as %+v, %v", b.String(), c, err)
+	}
+}
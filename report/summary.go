@@ -0,0 +1,123 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// titles of the categories checks are grouped under
+const (
+	CategoryErrors          = "Errors"
+	CategoryCluster         = "Cluster"
+	CategoryPendingPods     = "Pending pods"
+	CategoryNotRunning      = "Pods not running"
+	CategoryCrashLoops      = "Crash loops"
+	CategoryNotReady        = "Pods not ready"
+	CategoryService         = "Service"
+	CategoryNetworkPolicies = "Network policies"
+	CategoryPort            = "Port"
+	CategoryIngress         = "Ingress"
+)
+
+// Category groups the checks that point at the same kind of problem, with what to try next when they fail and the
+// exit code that reflects them
+type Category struct {
+	Title      string
+	NextAction string
+	ExitCode   int
+}
+
+// Categories lists the problem categories in the order we summarize them
+var Categories = []Category{
+	{CategoryErrors, "Fix the error above and run kubetrbl again.", ExitError},
+	{CategoryCluster, "Use a kubetrbl built for the cluster's Kubernetes version, or check what it reports by hand.", ExitError},
+	{CategoryPendingPods, "Check node capacity, taints, and volume claims with 'kubectl describe pod'.", ExitPending},
+	{CategoryNotRunning, "Check the container logs and any ConfigMaps and Secrets the pods reference.", ExitNotRunning},
+	{CategoryCrashLoops, "Check the previous container logs with 'kubectl logs --previous'.", ExitNotRunning},
+	{CategoryNotReady, "Check the readiness probes and that the rollout finished.", ExitNotReady},
+	{CategoryService, "Check the service's selector and ports match the pods.", ExitService},
+	{CategoryNetworkPolicies, "Check the NetworkPolicies selecting the pods allow traffic from the clients.", ExitService},
+	{CategoryPort, "Check the container listens on the port the service targets.", ExitPort},
+	{CategoryIngress, "Check the Ingress's rules and that its controller has given it an address.", ExitIngress},
+}
+
+// CategoryFor returns the category with the title
+func CategoryFor(title string) (Category, bool) {
+	for _, c := range Categories {
+		if c.Title == title {
+			return c, true
+		}
+	}
+	return Category{}, false
+}
+
+// SummaryLine is the problems found in one category
+type SummaryLine struct {
+	Title      string
+	NextAction string
+	// Status is StatusFail if any check in the category failed, otherwise StatusWarn
+	Status Status
+	// Targets are the objects with problems, in the order they were found
+	Targets []string
+}
+
+// Summary groups the failed checks and warnings in the report by category, leaving out categories without any
+func (r Report) Summary() []SummaryLine {
+	lines := map[string]*SummaryLine{}
+	for _, c := range r.Checks {
+		if c.Status != StatusFail && c.Status != StatusWarn {
+			continue
+		}
+		title := c.Category
+		if _, ok := CategoryFor(title); !ok {
+			title = CategoryErrors
+		}
+		line, ok := lines[title]
+		if !ok {
+			line = &SummaryLine{Title: title, Status: StatusWarn}
+			lines[title] = line
+		}
+		if c.Status == StatusFail {
+			line.Status = StatusFail
+		}
+		// a container's problems count against its pod
+		target := strings.SplitN(c.Target, "/", 2)[0]
+		if target != "" && !contains(line.Targets, target) {
+			line.Targets = append(line.Targets, target)
+		}
+	}
+
+	result := []SummaryLine{}
+	for _, cat := range Categories {
+		if line, ok := lines[cat.Title]; ok {
+			line.NextAction = cat.NextAction
+			result = append(result, *line)
+		}
+	}
+	return result
+}
+
+// WriteSummary writes the summary of the report, or an all-clear when nothing was wrong
+func (r Report) WriteSummary(w io.Writer, t Theme) {
+	lines := r.Summary()
+	fmt.Fprintln(w, "Summary:")
+	if len(lines) == 0 {
+		fmt.Fprintln(w, t.Marker(StatusPass)+" No problems found.")
+		return
+	}
+	for _, l := range lines {
+		fmt.Fprintf(w, "%s %s: %d — %s\n", t.Marker(l.Status), l.Title, len(l.Targets), strings.Join(l.Targets, ", "))
+		fmt.Fprintf(w, "    next: %s\n", l.NextAction)
+	}
+}
+
+// contains returns if s is one of items
+func contains(items []string, s string) bool {
+	for _, i := range items {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package report
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	check := func(category, target string, status Status) CheckResult {
+		return CheckResult{Name: "check", Category: category, Target: target, Status: status}
+	}
+	r := Report{Checks: []CheckResult{
+		check(CategoryPort, "web-1", StatusWarn),
+		check(CategoryPendingPods, "web-2", StatusFail),
+		check(CategoryPendingPods, "web-3", StatusPass),
+		// a container's problems count against its pod, once
+		check(CategoryCrashLoops, "web-1/app", StatusFail),
+		check(CategoryCrashLoops, "web-1/sidecar", StatusFail),
+		check(CategoryPort, "web-4", StatusFail),
+		// a category we don't know is an error
+		check("Custom", "getNamespace", StatusFail),
+	}}
+
+	want := []SummaryLine{
+		{Title: CategoryErrors, NextAction: "Fix the error above and run kubetrbl again.", Status: StatusFail, Targets: []string{"getNamespace"}},
+		{Title: CategoryPendingPods, NextAction: "Check node capacity, taints, and volume claims with 'kubectl describe pod'.", Status: StatusFail, Targets: []string{"web-2"}},
+		{Title: CategoryCrashLoops, NextAction: "Check the previous container logs with 'kubectl logs --previous'.", Status: StatusFail, Targets: []string{"web-1"}},
+		// a warning and a failure make a failing category, with the targets in the order found
+		{Title: CategoryPort, NextAction: "Check the container listens on the port the service targets.", Status: StatusFail, Targets: []string{"web-1", "web-4"}},
+	}
+	if got := r.Summary(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Summary =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	var b bytes.Buffer
+	r := Report{Checks: []CheckResult{
+		{Name: "service-endpoints", Category: CategoryService, Target: "web", Status: StatusWarn},
+		{Name: "pod-port", Category: CategoryPort, Target: "web-1", Status: StatusFail},
+		{Name: "pod-port", Category: CategoryPort, Target: "web-2", Status: StatusFail},
+	}}
+
+	r.WriteSummary(&b, Theme{})
+
+	want := `Summary:
+[WARN] Service: 1 — web
+    next: Check the service's selector and ports match the pods.
+[FAIL] Port: 2 — web-1, web-2
+    next: Check the container listens on the port the service targets.
+`
+	if b.String() != want {
+		t.Errorf("WriteSummary wrote\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	Report{Checks: []CheckResult{{Name: "pending-pods", Category: CategoryPendingPods, Status: StatusPass}}}.WriteSummary(&b, Theme{})
+	if want := "Summary:\n[OK] No problems found.\n"; b.String() != want {
+		t.Errorf("WriteSummary of a clean run wrote %q, want %q", b.String(), want)
+	}
+}
@@ -0,0 +1,92 @@
+package report
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// ANSI escapes for the colors we use
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+// Theme renders the marker printed before the outcome of a check. In color it's a colored symbol; otherwise it's
+// plain ASCII like [OK], which reads better in logs and CI.
+type Theme struct {
+	color bool
+}
+
+// NewTheme uses color only when it hasn't been turned off, by flag or by the NO_COLOR convention, and out is a
+// terminal
+func NewTheme(noColor bool, out io.Writer) Theme {
+	return newTheme(noColor, IsTerminal(out))
+}
+
+// newTheme works like NewTheme for output that's known to be a terminal or not
+func newTheme(noColor, terminal bool) Theme {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return Theme{}
+	}
+	return Theme{color: terminal}
+}
+
+// IsTerminal returns if w writes to a terminal
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// Marker returns what to print before a check with the status
+func (t Theme) Marker(status Status) string {
+	if !t.color {
+		switch status {
+		case StatusPass:
+			return "[OK]"
+		case StatusFail:
+			return "[FAIL]"
+		case StatusWarn:
+			return "[WARN]"
+		}
+		return "[SKIP]"
+	}
+	switch status {
+	case StatusPass:
+		return ansiGreen + "✓" + ansiReset
+	case StatusFail:
+		return ansiRed + "✗" + ansiReset
+	case StatusWarn:
+		return ansiYellow + "?" + ansiReset
+	}
+	return "-"
+}
+
+// Uncolored returns a writer to w that writes the colored marker starting each line written to it as the plain one,
+// for copies of the output like a transcript that aren't read on a terminal. Markers only ever start a line, so
+// nothing else that happens to look like one is changed.
+func Uncolored(w io.Writer) io.Writer {
+	return uncoloredWriter{w}
+}
+
+type uncoloredWriter struct {
+	w io.Writer
+}
+
+func (u uncoloredWriter) Write(p []byte) (int, error) {
+	for _, status := range []Status{StatusPass, StatusFail, StatusWarn, StatusSkip} {
+		colored := Theme{color: true}.Marker(status) + " "
+		if bytes.HasPrefix(p, []byte(colored)) {
+			plain := append([]byte(Theme{}.Marker(status)+" "), p[len(colored):]...)
+			if _, err := u.w.Write(plain); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+	}
+	return u.w.Write(p)
+}
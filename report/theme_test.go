@@ -0,0 +1,63 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestUncolored(t *testing.T) {
+	var buf bytes.Buffer
+	w := Uncolored(&buf)
+	color := Theme{color: true}
+	for _, status := range []Status{StatusPass, StatusFail, StatusWarn, StatusSkip} {
+		fmt.Fprintln(w, color.Marker(status)+" check - done")
+	}
+	// only markers starting a line are changed
+	fmt.Fprintln(w, "  - next step")
+	fmt.Fprintln(w, "no "+color.Marker(StatusPass)+" here")
+
+	want := "[OK] check - done\n[FAIL] check - done\n[WARN] check - done\n[SKIP] check - done\n  - next step\nno " + color.Marker(StatusPass) + " here\n"
+	if buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestNewTheme(t *testing.T) {
+	plain := map[Status]string{StatusPass: "[OK]", StatusFail: "[FAIL]", StatusWarn: "[WARN]", StatusSkip: "[SKIP]"}
+	tests := []struct {
+		name     string
+		noColor  bool
+		env      string
+		terminal bool
+		color    bool
+	}{
+		{"terminal", false, "", true, true},
+		{"NO_COLOR", false, "1", true, false},
+		{"-no-color", true, "", true, false},
+		{"not a terminal", false, "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env == "" {
+				os.Unsetenv("NO_COLOR")
+			} else {
+				os.Setenv("NO_COLOR", tt.env)
+			}
+			defer os.Unsetenv("NO_COLOR")
+
+			theme := newTheme(tt.noColor, tt.terminal)
+			for status, marker := range plain {
+				if got := theme.Marker(status); (got == marker) == tt.color {
+					t.Errorf("Marker(%s) = %q, want it colored %v", status, got, tt.color)
+				}
+			}
+		})
+	}
+
+	// a buffer is never a terminal
+	if theme := NewTheme(false, &bytes.Buffer{}); theme.Marker(StatusPass) != "[OK]" {
+		t.Errorf("output to a buffer is colored")
+	}
+}
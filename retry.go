@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// defaultRetryAttempts is how many times we try an API call that keeps failing in a way that may pass
+const defaultRetryAttempts = 3
+
+// retryBackoff is how long we wait before the first retry, doubling before each one after
+const retryBackoff = 500 * time.Millisecond
+
+// retry calls fn until it succeeds, fails in a way that retrying won't fix, or has been tried as many times as
+// the K8sContext allows. Errors such as NotFound and Forbidden are returned straight away.
+func (k *K8sContext) retry(ctx context.Context, fn func() error) error {
+	attempts := k.retryAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	wait := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !retryable(err) {
+			return explainForbidden(err)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		wait *= 2
+	}
+}
+
+// retryable returns if an API error is likely to be transient, such as throttling or the API server restarting
+func retryable(err error) bool {
+	if apierrors.IsTooManyRequests(err) || apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsServiceUnavailable(err) {
+		return true
+	}
+	if utilnet.IsConnectionReset(err) || utilnet.IsConnectionRefused(err) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// forbiddenError explains an API call the user has no permission to make, wrapping the API's error
+type forbiddenError struct {
+	msg string
+	err error
+}
+
+func (e *forbiddenError) Error() string {
+	return e.msg
+}
+
+func (e *forbiddenError) Unwrap() error {
+	return e.err
+}
+
+// forbiddenMessage picks the verb, resource, and namespace out of the API server's Forbidden message, like
+// `User "jane" cannot list resource "pods" in API group "" in the namespace "web"`
+var forbiddenMessage = regexp.MustCompile(`cannot (\w+) resource "([^"]+)"(?: in API group "[^"]*")?(?: in the namespace "([^"]+)")?`)
+
+// explainForbidden turns a Forbidden error into one saying what permission is missing, leaving other errors be
+func explainForbidden(err error) error {
+	if !apierrors.IsForbidden(err) {
+		return err
+	}
+
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return err
+	}
+	m := forbiddenMessage.FindStringSubmatch(status.Status().Message)
+	if m == nil {
+		return &forbiddenError{msg: "you don't have permission to do that: " + status.Status().Message, err: err}
+	}
+	verb, resource, namespace := m[1], m[2], m[3]
+	where := "across the cluster"
+	if namespace != "" {
+		where = fmt.Sprintf("in namespace %s", namespace)
+	}
+	return &forbiddenError{
+		msg: fmt.Sprintf("you don't have permission to %s %s %s; need '%s' on '%s'", verb, resource, where, verb, resource),
+		err: err,
+	}
+}
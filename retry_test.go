@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// timeoutError is a network error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// syscallError is the error a dial or read fails with when the syscall does
+func syscallError(op string, errno syscall.Errno) error {
+	return &net.OpError{Op: op, Net: "tcp", Err: os.NewSyscallError(op, errno)}
+}
+
+func TestRetryable(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"too many requests", apierrors.NewTooManyRequests("slow down", 1), true},
+		{"server timeout", apierrors.NewServerTimeout(pods, "list", 1), true},
+		{"timeout", apierrors.NewTimeoutError("took too long", 1), true},
+		{"service unavailable", apierrors.NewServiceUnavailable("restarting"), true},
+		{"connection refused", syscallError("dial", syscall.ECONNREFUSED), true},
+		{"connection reset", syscallError("read", syscall.ECONNRESET), true},
+		{"unexpected EOF", fmt.Errorf("reading response: %w", io.ErrUnexpectedEOF), true},
+		{"network timeout", &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}, true},
+		{"not found", apierrors.NewNotFound(pods, "web-1"), false},
+		{"forbidden", apierrors.NewForbidden(pods, "", errors.New("no")), false},
+		{"bad request", apierrors.NewBadRequest("bad selector"), false},
+		{"other", errors.New("something else"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// failingPods makes a K8sContext whose pod lists fail with the errors in turn before succeeding, and counts the
+// calls made
+func failingPods(errs ...error) (*K8sContext, *int) {
+	client := fakeClient(testPod("web-1", corev1.PodRunning))
+	calls := 0
+	client.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		if calls <= len(errs) {
+			return true, nil, errs[calls-1]
+		}
+		return false, nil, nil
+	})
+	return NewK8sContextWithClient(client, testNamespace), &calls
+}
+
+func TestRetry(t *testing.T) {
+	refused := syscallError("dial", syscall.ECONNREFUSED)
+
+	k, calls := failingPods(refused, apierrors.NewTooManyRequests("slow down", 1))
+	pods, err := k.GetPods(context.Background())
+	if err != nil || len(pods) != 1 {
+		t.Errorf("GetPods after two transient errors = %v, %v; want the pod", pods, err)
+	}
+	if *calls != 3 {
+		t.Errorf("made %d calls, want 3", *calls)
+	}
+
+	k, calls = failingPods(apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, testNamespace))
+	if _, err := k.GetPods(context.Background()); !apierrors.IsNotFound(err) || *calls != 1 {
+		t.Errorf("GetPods = %v after %d calls, want NotFound straight away", err, *calls)
+	}
+
+	k, calls = failingPods(refused, refused, refused)
+	k.retryAttempts = 2
+	if _, err := k.GetPods(context.Background()); !errors.Is(err, syscall.ECONNREFUSED) || *calls != 2 {
+		t.Errorf("GetPods = %v after %d calls, want the last error after 2", err, *calls)
+	}
+
+	// cancelling stops the wait for the next attempt
+	k, calls = failingPods(refused, refused, refused)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := k.GetPods(ctx); err == nil || *calls != 1 {
+		t.Errorf("GetPods once cancelled = %v after %d calls, want an error after 1", err, *calls)
+	}
+}
+
+func TestExplainForbidden(t *testing.T) {
+	forbidden := func(message string) error {
+		err := apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New("denied"))
+		err.ErrStatus.Message = message
+		return err
+	}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"namespaced", forbidden(`pods is forbidden: User "jane" cannot list resource "pods" in API group "" in the namespace "web"`),
+			"you don't have permission to list pods in namespace web; need 'list' on 'pods'"},
+		{"cluster", forbidden(`nodes is forbidden: User "jane" cannot list resource "nodes" in API group "" at the cluster scope`),
+			"you don't have permission to list nodes across the cluster; need 'list' on 'nodes'"},
+		{"grouped", forbidden(`deployments.apps "web" is forbidden: User "jane" cannot get resource "deployments" in API group "apps" in the namespace "web"`),
+			"you don't have permission to get deployments in namespace web; need 'get' on 'deployments'"},
+		{"unrecognized", forbidden("access denied by webhook"), "you don't have permission to do that: access denied by webhook"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, _ := failingPods(tt.err)
+			_, err := k.GetPods(context.Background())
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("GetPods = %v, want %q", err, tt.want)
+			}
+			// the API's error is kept for -debug
+			if !apierrors.IsForbidden(errors.Unwrap(err)) {
+				t.Errorf("%v doesn't wrap the Forbidden error", err)
+			}
+		})
+	}
+
+	other := apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "web-1")
+	if err := explainForbidden(other); err != other {
+		t.Errorf("explainForbidden changed %v to %v", other, err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Scenario is a whole troubleshooting run's answers, kept in a YAML or JSON file so the run can be repeated exactly
+type Scenario struct {
+	KubeConfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+	Namespace  string `json:"namespace"`
+	Selector   string `json:"selector,omitempty"`
+	Service    string `json:"service,omitempty"`
+	Port       string `json:"port,omitempty"`
+	Pod        string `json:"pod,omitempty"`
+	Path       string `json:"path,omitempty"`
+	LocalPort  int    `json:"localPort,omitempty"`
+}
+
+// LoadScenario reads a Scenario from a YAML or JSON file, failing on fields it doesn't know as well as on those it
+// needs but doesn't have
+func LoadScenario(path string) (Scenario, error) {
+	var s Scenario
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := yaml.UnmarshalStrict(data, &s); err != nil {
+		return s, fmt.Errorf("scenario '%s' is malformed: %w", path, err)
+	}
+	if s.Namespace == "" {
+		return s, fmt.Errorf("scenario '%s' has no namespace", path)
+	}
+	if s.Pod == "" && (s.Service == "" || s.Port == "") {
+		return s, fmt.Errorf("scenario '%s' needs a service and port, or a pod", path)
+	}
+	return s, nil
+}
+
+// apply fills in the answers in cfg that weren't already given
+func (s Scenario) apply(cfg *Config) {
+	fill := func(answer *string, value string) {
+		if *answer == "" {
+			*answer = value
+		}
+	}
+	fill(&cfg.KubeConfig, s.KubeConfig)
+	fill(&cfg.Context, s.Context)
+	fill(&cfg.Namespace, s.Namespace)
+	fill(&cfg.Selector, s.Selector)
+	fill(&cfg.Service, s.Service)
+	fill(&cfg.Port, s.Port)
+	fill(&cfg.Pod, s.Pod)
+	fill(&cfg.Path, s.Path)
+	if cfg.LocalPort == 0 {
+		cfg.LocalPort = s.LocalPort
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caseyhadden/kubetrbl/report"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// writeScenario writes the scenario file's contents to a temporary file, returning its path
+func writeScenario(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadScenario(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     Scenario
+		err      string
+	}{
+		{"yaml", "namespace: default\nservice: web\nport: http\npath: /healthz\nlocalPort: 8080\n", Scenario{Namespace: "default", Service: "web", Port: "http", Path: "/healthz", LocalPort: 8080}, ""},
+		{"json", `{"context": "prod", "namespace": "default", "pod": "web-1"}`, Scenario{Context: "prod", Namespace: "default", Pod: "web-1"}, ""},
+		{"unknown field", "namespace: default\nservice: web\nport: http\nprot: http\n", Scenario{}, "is malformed"},
+		{"malformed", "namespace: [default\n", Scenario{}, "is malformed"},
+		{"no namespace", "service: web\nport: http\n", Scenario{}, "has no namespace"},
+		{"no port", "namespace: default\nservice: web\n", Scenario{}, "needs a service and port, or a pod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeScenario(t, tt.contents)
+			s, err := LoadScenario(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) || !strings.Contains(err.Error(), path) {
+					t.Errorf("LoadScenario = %v, want an error about %s saying %q", err, path, tt.err)
+				}
+				return
+			}
+			if err != nil || s != tt.want {
+				t.Errorf("LoadScenario = %+v, %v; want %+v", s, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadScenario(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("LoadScenario of a missing file succeeded")
+	}
+}
+
+func TestScenarioApply(t *testing.T) {
+	s := Scenario{Context: "prod", Namespace: "payments", Service: "web", Port: "http", Path: "/healthz", LocalPort: 8080}
+	// what was given on the command line wins
+	cfg := Config{Namespace: "default", LocalPort: 9090}
+
+	s.apply(&cfg)
+
+	want := Config{Context: "prod", Namespace: "default", Service: "web", Port: "http", Path: "/healthz", LocalPort: 9090}
+	if cfg.Context != want.Context || cfg.Namespace != want.Namespace || cfg.Service != want.Service || cfg.Port != want.Port || cfg.Path != want.Path || cfg.LocalPort != want.LocalPort {
+		t.Errorf("apply = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestScenarioRun(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	s, err := LoadScenario(writeScenario(t, "namespace: default\nservice: web\nport: http\npath: /healthz\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{DryRun: true}
+	s.apply(&cfg)
+
+	// there's no input, so any prompt the scenario didn't answer would end the run early
+	k, out := troubleshoot(t, cfg, "getNamespace", "", testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), ready, testDeployment("web", 1))
+
+	if got := k.fsm.Current(); got != "finish" || strings.Contains(out, "No more input") || strings.Contains(out, "? ") {
+		t.Errorf("run ended in %q, want finish without prompting:\n%s", got, out)
+	}
+	c := wantCheck(t, k, checkPodPort, "web-1", report.StatusSkip)
+	if !strings.HasSuffix(c.Message, "GET http://localhost/healthz") {
+		t.Errorf("port check said %q, want the scenario's path", c.Message)
+	}
+}
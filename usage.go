@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+// errMetricsUnavailable is returned by PodMetrics when the cluster doesn't serve the metrics API, which needs an
+// add-on like metrics-server
+var errMetricsUnavailable = errors.New("metrics API unavailable")
+
+// usageNearLimit is the percentage of a limit at which usage is close enough to explain OOM kills and throttling
+const usageNearLimit = 90
+
+// PodMetrics returns the live CPU and memory usage of the named pod's containers. It's nil with no error when the
+// pod has no metrics yet, as it hasn't been running long enough, and errMetricsUnavailable when there's no metrics
+// API.
+func (k *K8sContext) PodMetrics(ctx context.Context, podName string) (*metricsv1beta1.PodMetrics, error) {
+	if k.metricsClient == nil {
+		return nil, errMetricsUnavailable
+	}
+	var m *metricsv1beta1.PodMetrics
+	err := k.retry(ctx, func() (err error) {
+		m, err = k.metricsClient.MetricsV1beta1().PodMetricses(k.namespace).Get(ctx, podName, metav1.GetOptions{})
+		return err
+	})
+	var status apierrors.APIStatus
+	if apierrors.IsNotFound(err) && errors.As(err, &status) {
+		// only a pod without metrics names itself; otherwise it's the API itself that isn't found
+		if d := status.Status().Details; d != nil && d.Name == podName {
+			return nil, nil
+		}
+	}
+	if apierrors.IsNotFound(err) || apierrors.IsServiceUnavailable(err) {
+		return nil, errMetricsUnavailable
+	}
+	return m, err
+}
+
+// ContainerUsage is how much CPU and memory a container is using against its limits, which are zero when it has none
+type ContainerUsage struct {
+	ContainerName string
+	CPU           resource.Quantity
+	CPULimit      resource.Quantity
+	Memory        resource.Quantity
+	MemoryLimit   resource.Quantity
+}
+
+// resourceUsage pairs the usage of each container in the metrics with its limits in the pod
+func resourceUsage(pod corev1.Pod, m *metricsv1beta1.PodMetrics) []ContainerUsage {
+	limits := map[string]corev1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		limits[c.Name] = c.Resources.Limits
+	}
+	result := []ContainerUsage{}
+	for _, c := range m.Containers {
+		result = append(result, ContainerUsage{
+			ContainerName: c.Name,
+			CPU:           c.Usage[corev1.ResourceCPU],
+			CPULimit:      limits[c.Name][corev1.ResourceCPU],
+			Memory:        c.Usage[corev1.ResourceMemory],
+			MemoryLimit:   limits[c.Name][corev1.ResourceMemory],
+		})
+	}
+	return result
+}
+
+// percentOf returns how much of limit the usage is as a whole percentage, false when there's no limit
+func percentOf(usage, limit resource.Quantity) (int64, bool) {
+	if limit.IsZero() {
+		return 0, false
+	}
+	return usage.MilliValue() * 100 / limit.MilliValue(), true
+}
+
+// usageProblems describes the container's usage that's near or over its limits: memory there gets it OOM killed,
+// and CPU there gets it throttled
+func usageProblems(u ContainerUsage) []string {
+	problems := []string{}
+	if pct, ok := percentOf(u.Memory, u.MemoryLimit); ok && pct >= usageNearLimit {
+		problems = append(problems, fmt.Sprintf("memory %s is %d%% of its %s limit, so it's likely being OOM killed", u.Memory.String(), pct, u.MemoryLimit.String()))
+	}
+	if pct, ok := percentOf(u.CPU, u.CPULimit); ok && pct >= usageNearLimit {
+		problems = append(problems, fmt.Sprintf("CPU %s is %d%% of its %s limit, so it's likely being throttled", u.CPU.String(), pct, u.CPULimit.String()))
+	}
+	return problems
+}
+
+// formatUsage describes a usage against its limit, like "480Mi of 512Mi"
+func formatUsage(usage, limit resource.Quantity) string {
+	if limit.IsZero() {
+		return usage.String() + " (no limit)"
+	}
+	return usage.String() + " of " + limit.String()
+}
+
+// checkResourceUsage compares the pod's live usage against its limits, once it's known whether there's a metrics
+// API to ask
+func (k *Kubetrbl) checkResourceUsage(pod corev1.Pod) error {
+	name := pod.GetName()
+	if k.metricsUnavailable {
+		return nil
+	}
+	m, err := k.k8sContext.PodMetrics(k.ctx, name)
+	if errors.Is(err, errMetricsUnavailable) {
+		// one skip says it all; the API won't appear for the next pod
+		k.metricsUnavailable = true
+		k.skip(checkResourceUsage, k.k8sContext.namespace, "Not comparing usage to limits: %s.", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		k.skip(checkResourceUsage, name, "Pod '%s' has no usage metrics yet.", name)
+		return nil
+	}
+
+	for _, u := range resourceUsage(pod, m) {
+		target := name + "/" + u.ContainerName
+		problems := usageProblems(u)
+		for _, p := range problems {
+			k.warn(checkResourceUsage, target, "Pod '%s' container '%s' %s.", name, u.ContainerName, p)
+		}
+		if len(problems) == 0 {
+			k.pass(checkResourceUsage, target, "Pod '%s' container '%s' is within its limits.", name, u.ContainerName)
+		}
+		fmt.Fprintf(k.out, "  CPU %s, memory %s\n", formatUsage(u.CPU, u.CPULimit), formatUsage(u.Memory, u.MemoryLimit))
+	}
+	return nil
+}
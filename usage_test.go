@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/caseyhadden/kubetrbl/report"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	fakemetrics "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+// metricsResource is what the metrics API serves pod metrics as
+var metricsResource = metricsv1beta1.SchemeGroupVersion.WithResource("pods").GroupResource()
+
+// testPodMetrics makes the metrics of the pod, with its app container using the cpu and memory
+func testPodMetrics(name, cpu, memory string) *metricsv1beta1.PodMetrics {
+	return &metricsv1beta1.PodMetrics{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Containers: []metricsv1beta1.ContainerMetrics{{Name: "app", Usage: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}}},
+	}
+}
+
+// metricsServing is a fake metrics API that answers getting pod metrics with the first of these with the pod's name,
+// or with err when there's none
+func metricsServing(err error, metrics ...*metricsv1beta1.PodMetrics) *fakemetrics.Clientset {
+	client := fakemetrics.NewSimpleClientset()
+	client.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		name := action.(k8stesting.GetAction).GetName()
+		for _, m := range metrics {
+			if m.Name == name {
+				return true, m, nil
+			}
+		}
+		return true, nil, err
+	})
+	return client
+}
+
+// limited makes a container's resources limit it to the cpu and memory
+func limited(cpu, memory string) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{Limits: corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+	}}
+}
+
+func TestPercentOf(t *testing.T) {
+	tests := []struct {
+		usage, limit string
+		want         int64
+		ok           bool
+	}{
+		{"460Mi", "512Mi", 89, true},
+		{"461Mi", "512Mi", 90, true},
+		{"600Mi", "512Mi", 117, true},
+		// CPU is compared in millicores
+		{"450m", "500m", 90, true},
+		{"1", "500m", 200, true},
+		{"100Mi", "0", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := percentOf(resource.MustParse(tt.usage), resource.MustParse(tt.limit))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("percentOf(%s, %s) = %d, %v; want %d, %v", tt.usage, tt.limit, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestUsageProblems(t *testing.T) {
+	usage := func(cpu, cpuLimit, memory, memoryLimit string) ContainerUsage {
+		return ContainerUsage{ContainerName: "app", CPU: resource.MustParse(cpu), CPULimit: resource.MustParse(cpuLimit), Memory: resource.MustParse(memory), MemoryLimit: resource.MustParse(memoryLimit)}
+	}
+	tests := []struct {
+		name  string
+		usage ContainerUsage
+		want  []string
+	}{
+		{"within", usage("100m", "500m", "128Mi", "512Mi"), []string{}},
+		{"near memory", usage("100m", "500m", "480Mi", "512Mi"), []string{"memory 480Mi is 93% of its 512Mi limit, so it's likely being OOM killed"}},
+		{"at cpu", usage("500m", "500m", "128Mi", "512Mi"), []string{"CPU 500m is 100% of its 500m limit, so it's likely being throttled"}},
+		{"both", usage("600m", "500m", "1Gi", "512Mi"), []string{"memory 1Gi is 200% of its 512Mi limit, so it's likely being OOM killed", "CPU 600m is 120% of its 500m limit, so it's likely being throttled"}},
+		// without limits, no usage is too much
+		{"unlimited", usage("4", "0", "8Gi", "0"), []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usageProblems(tt.usage); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("usageProblems = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := formatUsage(resource.MustParse("480Mi"), resource.MustParse("512Mi")); got != "480Mi of 512Mi" {
+		t.Errorf("formatUsage = %q", got)
+	}
+	if got := formatUsage(resource.MustParse("250m"), resource.Quantity{}); got != "250m (no limit)" {
+		t.Errorf("formatUsage without a limit = %q", got)
+	}
+}
+
+func TestResourceUsage(t *testing.T) {
+	pod := testPod("web-1", corev1.PodRunning)
+	pod.Spec.Containers = []corev1.Container{{Name: "app", Resources: limited("500m", "512Mi")}, {Name: "sidecar"}}
+	m := testPodMetrics("web-1", "250m", "480Mi")
+	m.Containers = append(m.Containers, metricsv1beta1.ContainerMetrics{Name: "sidecar", Usage: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("32Mi")}})
+
+	got := resourceUsage(*pod, m)
+
+	if len(got) != 2 {
+		t.Fatalf("resourceUsage = %+v, want the 2 containers", got)
+	}
+	if u := got[0]; u.ContainerName != "app" || u.CPU.String() != "250m" || u.CPULimit.String() != "500m" || u.Memory.String() != "480Mi" || u.MemoryLimit.String() != "512Mi" {
+		t.Errorf("app's usage is %+v", u)
+	}
+	if u := got[1]; u.ContainerName != "sidecar" || !u.MemoryLimit.IsZero() || !u.CPULimit.IsZero() || u.Memory.String() != "32Mi" {
+		t.Errorf("sidecar's usage is %+v, want it without limits", u)
+	}
+}
+
+func TestPodMetrics(t *testing.T) {
+	ctx := context.Background()
+	get := func(client *fakemetrics.Clientset, name string) (*metricsv1beta1.PodMetrics, error) {
+		k := NewK8sContextWithClient(fakeClient(), testNamespace)
+		// an unavailable API is retried first, which needn't slow the test
+		k.retryAttempts = 1
+		if client != nil {
+			k.metricsClient = client
+		}
+		return k.PodMetrics(ctx, name)
+	}
+	at := testPodMetrics("web-1", "250m", "480Mi")
+
+	m, err := get(metricsServing(nil, at), "web-1")
+	if err != nil || m == nil || m.Containers[0].Usage.Memory().String() != "480Mi" {
+		t.Errorf("PodMetrics = %+v, %v; want web-1's usage", m, err)
+	}
+	// a pod that hasn't been running long has no metrics yet, which isn't the API missing
+	if m, err := get(metricsServing(apierrors.NewNotFound(metricsResource, "web-2"), at), "web-2"); m != nil || err != nil {
+		t.Errorf("PodMetrics of a pod without metrics = %+v, %v; want none", m, err)
+	}
+
+	// without metrics-server, the API's not found at all or its APIService isn't available
+	for name, client := range map[string]*fakemetrics.Clientset{
+		"not found":   metricsServing(apierrors.NewNotFound(metricsResource, "")),
+		"unavailable": metricsServing(apierrors.NewServiceUnavailable("the server is currently unable to handle the request")),
+		"no client":   nil,
+	} {
+		if _, err := get(client, "web-1"); !errors.Is(err, errMetricsUnavailable) {
+			t.Errorf("PodMetrics with the API %s = %v, want errMetricsUnavailable", name, err)
+		}
+	}
+
+	// other errors are errors
+	forbidden := apierrors.NewForbidden(metricsResource, "web-1", errors.New("no"))
+	if _, err := get(metricsServing(forbidden), "web-1"); err == nil || errors.Is(err, errMetricsUnavailable) {
+		t.Errorf("PodMetrics when forbidden = %v, want the error", err)
+	}
+}
+
+func TestCheckResourceUsage(t *testing.T) {
+	crashing := func(name string) *corev1.Pod {
+		pod := testPod(name, corev1.PodRunning)
+		pod.Spec.Containers[0].Resources = limited("500m", "512Mi")
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{restarted("app", 14, 137, "OOMKilled")}
+		return pod
+	}
+	run := func(metrics *fakemetrics.Clientset) (*Kubetrbl, string) {
+		cfg := answered
+		cfg.Only = []string{onlyRunning}
+		var out bytes.Buffer
+		k := NewKubetrblIO(context.Background(), cfg, strings.NewReader(""), &out)
+		k.k8sContext = NewK8sContextWithClient(&testClient{Clientset: fakeClient(crashing("web-1"), crashing("web-2"))}, testNamespace)
+		k.k8sContext.metricsClient = metrics
+		k.Start("countPods")
+		return k, out.String()
+	}
+
+	k, out := run(metricsServing(apierrors.NewNotFound(metricsResource, "web-2"), testPodMetrics("web-1", "100m", "500Mi")))
+	c := wantCheck(t, k, checkResourceUsage, "web-1/app", report.StatusWarn)
+	if want := "Pod 'web-1' container 'app' memory 500Mi is 97% of its 512Mi limit, so it's likely being OOM killed."; c.Message != want {
+		t.Errorf("usage check warned %q, want %q", c.Message, want)
+	}
+	if !strings.Contains(out, "  CPU 100m of 500m, memory 500Mi of 512Mi\n") {
+		t.Errorf("didn't show web-1's usage:\n%s", out)
+	}
+	wantCheck(t, k, checkResourceUsage, "web-2", report.StatusSkip)
+
+	// without a metrics API the diagnosis carries on, saying so once
+	k, _ = run(metricsServing(apierrors.NewNotFound(metricsResource, "")))
+	skips := checksNamed(k, checkResourceUsage)
+	if len(skips) != 1 || skips[0].Status != report.StatusSkip || skips[0].Message != "Not comparing usage to limits: metrics API unavailable." {
+		t.Errorf("usage checks without a metrics API are %+v, want a single skip", skips)
+	}
+	wantCheck(t, k, checkCrashLoopingPods, "web-2/app", report.StatusFail)
+}
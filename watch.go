@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/caseyhadden/kubetrbl/report"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// clearScreen moves the cursor to the top left of a terminal and clears it
+const clearScreen = "\033[H\033[2J"
+
+// WatchPods re-prints the pending, running, and ready summary of the pods troubleshot each time one of them
+// changes, until ctx is done
+func (k *Kubetrbl) WatchPods(ctx context.Context) error {
+	if k.k8sContext == nil || k.k8sContext.k8sClient == nil || k.k8sContext.namespace == "" {
+		return errors.New("there are no pods to watch without a namespace")
+	}
+	selector, err := k.watchSelector()
+	if err != nil {
+		return err
+	}
+	return k.watchPods(ctx, k.k8sContext.podListWatch(ctx, selector), selector)
+}
+
+// watchSelector returns the label selector of the pods to watch: those of the controller if we found one, otherwise
+// those the service selects, or the ones given up front
+func (k *Kubetrbl) watchSelector() (string, error) {
+	if c := k.k8sContext.controller; c != nil && c.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(c.Selector)
+		if err != nil {
+			return "", err
+		}
+		return selector.String(), nil
+	}
+	if len(k.k8sContext.svc.Spec.Selector) > 0 {
+		return labels.SelectorFromSet(k.k8sContext.svc.Spec.Selector).String(), nil
+	}
+	return k.config.Selector, nil
+}
+
+// podListWatch lists and watches the pods in the namespace matching the label selector
+func (k *K8sContext) podListWatch(ctx context.Context, selector string) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.LabelSelector = selector
+			return k.k8sClient.CoreV1().Pods(k.namespace).List(ctx, opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.LabelSelector = selector
+			return k.k8sClient.CoreV1().Pods(k.namespace).Watch(ctx, opts)
+		},
+	}
+}
+
+// watchPods prints the summary once the pods from lw are first listed and again whenever they change. Changes that
+// arrive while a summary is printed are coalesced into the next one.
+func (k *Kubetrbl) watchPods(ctx context.Context, lw cache.ListerWatcher, selector string) error {
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	store, controller := cache.NewInformer(lw, &corev1.Pod{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { notify() },
+		UpdateFunc: func(interface{}, interface{}) { notify() },
+		DeleteFunc: func(interface{}) { notify() },
+	})
+	go controller.Run(ctx.Done())
+	// a namespace with none of the pods sends no events, so the first summary doesn't wait for one
+	if cache.WaitForCacheSync(ctx.Done(), controller.HasSynced) {
+		notify()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(k.out, "Stopped watching.")
+			return nil
+		case <-changed:
+		}
+		k.writePodSummary(storedPods(store), selector)
+	}
+}
+
+// storedPods returns the pods in the informer's store, sorted by name
+func storedPods(store cache.Store) []corev1.Pod {
+	pods := []corev1.Pod{}
+	for _, obj := range store.List() {
+		if pod, ok := obj.(*corev1.Pod); ok {
+			pods = append(pods, *pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].GetName() < pods[j].GetName()
+	})
+	return pods
+}
+
+// writePodSummary prints which of the pods are pending, not running, and not ready, clearing the terminal first
+func (k *Kubetrbl) writePodSummary(pods []corev1.Pod, selector string) {
+	if report.IsTerminal(k.out) {
+		fmt.Fprint(k.out, clearScreen)
+	}
+	what := fmt.Sprintf("namespace '%s'", k.k8sContext.namespace)
+	if selector != "" {
+		what += fmt.Sprintf(" matching '%s'", selector)
+	}
+	fmt.Fprintf(k.out, "Watching %d pods in %s, updated %s. Ctrl-C to stop.\n", len(pods), what, time.Now().Format("15:04:05"))
+	fmt.Fprintln(k.out)
+	k.writePodProblems("pending", "No pods are pending.", pendingPods(pods))
+	k.writePodProblems("not running", "All pods are running.", nonrunningPods(pods))
+	k.writePodProblems("not ready", "All pods are ready.", notReadyPods(pods))
+}
+
+// writePodProblems prints a line naming the pods with a problem, or the message saying none have it
+func (k *Kubetrbl) writePodProblems(problem, none string, names []string) {
+	if len(names) == 0 {
+		fmt.Fprintln(k.out, k.theme.Marker(report.StatusPass)+" "+none)
+		return
+	}
+	fmt.Fprintf(k.out, "%s %d %s: %s\n", k.theme.Marker(report.StatusFail), len(names), problem, strings.Join(names, ", "))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// syncBuffer is an output that can be read while another goroutine writes to it
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+// waitForSummary waits for the nth summary to be printed, returning it
+func waitForSummary(t *testing.T, out *syncBuffer, n int) string {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if summaries := strings.Split(out.String(), "Watching ")[1:]; len(summaries) >= n {
+			return summaries[n-1]
+		}
+	}
+	t.Fatalf("summary %d wasn't printed:\n%s", n, out.String())
+	return ""
+}
+
+func TestWatchSelector(t *testing.T) {
+	k := NewKubetrblIO(context.Background(), Config{Selector: "tier=frontend"}, strings.NewReader(""), &bytes.Buffer{})
+	k.k8sContext = NewK8sContextWithClient(fakeClient(), testNamespace)
+
+	// what was given up front, without a service or controller
+	if got, err := k.watchSelector(); err != nil || got != "tier=frontend" {
+		t.Errorf("watchSelector = %q, %v; want the one given", got, err)
+	}
+	k.k8sContext.svc = *testService()
+	if got, err := k.watchSelector(); err != nil || got != "app=web" {
+		t.Errorf("watchSelector = %q, %v; want the service's", got, err)
+	}
+	d := testDeployment("web", 1)
+	d.Spec.Selector.MatchLabels["track"] = "stable"
+	k.k8sContext.controller = NewController(d, appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	if got, err := k.watchSelector(); err != nil || got != "app=web,track=stable" {
+		t.Errorf("watchSelector = %q, %v; want the controller's", got, err)
+	}
+}
+
+func TestWatchPods(t *testing.T) {
+	var out syncBuffer
+	k := NewKubetrblIO(context.Background(), Config{}, strings.NewReader(""), &out)
+	k.k8sContext = NewK8sContextWithClient(fakeClient(), testNamespace)
+	pods := watch.NewFake()
+	lw := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &corev1.PodList{Items: []corev1.Pod{*testPod("web-1", corev1.PodPending)}}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return pods, nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	watched := make(chan error, 1)
+	go func() {
+		watched <- k.watchPods(ctx, lw, "app=web")
+	}()
+
+	// the pods first listed are summarized without waiting for a change
+	got := waitForSummary(t, &out, 1)
+	if !strings.HasPrefix(got, "1 pods in namespace 'default' matching 'app=web'") || !strings.Contains(got, "1 pending: web-1\n") {
+		t.Errorf("first summary is\n%s", got)
+	}
+
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	pods.Modify(ready)
+	got = waitForSummary(t, &out, 2)
+	for _, want := range []string{"No pods are pending.", "All pods are running.", "All pods are ready."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("summary once web-1 is ready doesn't say %q:\n%s", want, got)
+		}
+	}
+
+	starting := testPod("web-2", corev1.PodRunning)
+	starting.Status.Conditions = []corev1.PodCondition{notReady("ContainersNotReady", "")}
+	pods.Add(starting)
+	if got = waitForSummary(t, &out, 3); !strings.HasPrefix(got, "2 pods") || !strings.Contains(got, "1 not ready: web-2\n") {
+		t.Errorf("summary once web-2 is added is\n%s", got)
+	}
+
+	pods.Delete(starting)
+	if got = waitForSummary(t, &out, 4); !strings.HasPrefix(got, "1 pods") || !strings.Contains(got, "All pods are ready.") {
+		t.Errorf("summary once web-2 is deleted is\n%s", got)
+	}
+
+	cancel()
+	select {
+	case err := <-watched:
+		if err != nil {
+			t.Errorf("watchPods = %v once stopped", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchPods didn't return once its context was done")
+	}
+	if !strings.HasSuffix(out.String(), "Stopped watching.\n") {
+		t.Errorf("didn't say it stopped watching:\n%s", out.String())
+	}
+	// the output isn't a terminal, so it isn't cleared between summaries
+	if strings.Contains(out.String(), clearScreen) {
+		t.Errorf("cleared output that isn't a terminal")
+	}
+}
+
+func TestWatchPodsWithoutNamespace(t *testing.T) {
+	k := NewKubetrblIO(context.Background(), Config{}, strings.NewReader(""), &bytes.Buffer{})
+	k.k8sContext = NewK8sContextWithClient(fakeClient(), "")
+
+	if err := k.WatchPods(context.Background()); err == nil {
+		t.Errorf("WatchPods without a namespace succeeded")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetDeployments returns the names of the Deployments in the namespace
+func (k *K8sContext) GetDeployments(ctx context.Context) ([]string, error) {
+	result := []string{}
+	opts := metav1.ListOptions{Limit: listPageSize}
+	for {
+		var list *appsv1.DeploymentList
+		err := k.retry(ctx, func() (err error) {
+			list, err = k.k8sClient.AppsV1().Deployments(k.namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return []string{}, err
+		}
+		for _, d := range list.Items {
+			result = append(result, d.GetName())
+		}
+		if list.Continue == "" {
+			return result, nil
+		}
+		opts.Continue = list.Continue
+	}
+}
+
+// GetStatefulSets returns the names of the StatefulSets in the namespace
+func (k *K8sContext) GetStatefulSets(ctx context.Context) ([]string, error) {
+	result := []string{}
+	opts := metav1.ListOptions{Limit: listPageSize}
+	for {
+		var list *appsv1.StatefulSetList
+		err := k.retry(ctx, func() (err error) {
+			list, err = k.k8sClient.AppsV1().StatefulSets(k.namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return []string{}, err
+		}
+		for _, ss := range list.Items {
+			result = append(result, ss.GetName())
+		}
+		if list.Continue == "" {
+			return result, nil
+		}
+		opts.Continue = list.Continue
+	}
+}
+
+// GetDaemonSets returns the names of the DaemonSets in the namespace
+func (k *K8sContext) GetDaemonSets(ctx context.Context) ([]string, error) {
+	result := []string{}
+	opts := metav1.ListOptions{Limit: listPageSize}
+	for {
+		var list *appsv1.DaemonSetList
+		err := k.retry(ctx, func() (err error) {
+			list, err = k.k8sClient.AppsV1().DaemonSets(k.namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return []string{}, err
+		}
+		for _, ds := range list.Items {
+			result = append(result, ds.GetName())
+		}
+		if list.Continue == "" {
+			return result, nil
+		}
+		opts.Continue = list.Continue
+	}
+}
+
+// GetDeployment returns the named Deployment
+func (k *K8sContext) GetDeployment(ctx context.Context, name string) (*appsv1.Deployment, error) {
+	var d *appsv1.Deployment
+	err := k.retry(ctx, func() (err error) {
+		d, err = k.k8sClient.AppsV1().Deployments(k.namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	return d, err
+}
+
+// DeploymentReplicaHealth returns how many replicas the named Deployment wants, and how many are ready and available
+func (k *K8sContext) DeploymentReplicaHealth(ctx context.Context, name string) (desired, ready, available int32, err error) {
+	d, err := k.GetDeployment(ctx, name)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	desired, ready, available = replicaHealth(d)
+	return desired, ready, available, nil
+}
+
+// replicaHealth returns the desired, ready, and available replicas of a Deployment, which wants one replica when
+// it doesn't say
+func replicaHealth(d *appsv1.Deployment) (int32, int32, int32) {
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	return desired, d.Status.ReadyReplicas, d.Status.AvailableReplicas
+}
+
+// GetController returns the named Deployment, StatefulSet, or DaemonSet
+func (k *K8sContext) GetController(ctx context.Context, kind, name string) (metav1.Object, error) {
+	var obj metav1.Object
+	err := k.retry(ctx, func() (err error) {
+		switch kind {
+		case "Deployment":
+			obj, err = k.k8sClient.AppsV1().Deployments(k.namespace).Get(ctx, name, metav1.GetOptions{})
+		case "StatefulSet":
+			obj, err = k.k8sClient.AppsV1().StatefulSets(k.namespace).Get(ctx, name, metav1.GetOptions{})
+		case "DaemonSet":
+			obj, err = k.k8sClient.AppsV1().DaemonSets(k.namespace).Get(ctx, name, metav1.GetOptions{})
+		default:
+			return fmt.Errorf("unknown controller kind '%s'", kind)
+		}
+		return err
+	})
+	return obj, err
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/caseyhadden/kubetrbl/report"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetWorkloads(t *testing.T) {
+	meta := func(name, namespace string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: namespace}
+	}
+	k := NewK8sContextWithClient(fakeClient(
+		&appsv1.Deployment{ObjectMeta: meta("web", testNamespace)},
+		&appsv1.Deployment{ObjectMeta: meta("api", testNamespace)},
+		&appsv1.Deployment{ObjectMeta: meta("billing", "other")},
+		&appsv1.StatefulSet{ObjectMeta: meta("db", testNamespace)},
+		&appsv1.StatefulSet{ObjectMeta: meta("cache", testNamespace)},
+		&appsv1.DaemonSet{ObjectMeta: meta("logs", testNamespace)},
+		&appsv1.DaemonSet{ObjectMeta: meta("node-exporter", "monitoring")},
+	), testNamespace)
+
+	tests := []struct {
+		kind string
+		get  func(context.Context) ([]string, error)
+		want []string
+	}{
+		{"Deployment", k.GetDeployments, []string{"web", "api"}},
+		{"StatefulSet", k.GetStatefulSets, []string{"db", "cache"}},
+		{"DaemonSet", k.GetDaemonSets, []string{"logs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			got, err := tt.get(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	empty := NewK8sContextWithClient(fakeClient(), testNamespace)
+	if got, err := empty.GetStatefulSets(context.Background()); err != nil || got == nil || len(got) != 0 {
+		t.Errorf("GetStatefulSets with none = %#v, %v; want an empty list", got, err)
+	}
+}
+
+func TestDeploymentReplicaHealth(t *testing.T) {
+	tests := []struct {
+		name                      string
+		change                    func(*appsv1.Deployment)
+		desired, ready, available int32
+	}{
+		{"healthy", func(*appsv1.Deployment) {}, 5, 5, 5},
+		{"short", func(d *appsv1.Deployment) {
+			d.Status.ReadyReplicas, d.Status.AvailableReplicas = 2, 1
+		}, 5, 2, 1},
+		// a Deployment that doesn't say wants one replica
+		{"unset", func(d *appsv1.Deployment) {
+			d.Spec.Replicas = nil
+			d.Status.ReadyReplicas, d.Status.AvailableReplicas = 0, 0
+		}, 1, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDeployment("web", 5)
+			tt.change(d)
+			k := NewK8sContextWithClient(fakeClient(d), testNamespace)
+
+			desired, ready, available, err := k.DeploymentReplicaHealth(context.Background(), "web")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if desired != tt.desired || ready != tt.ready || available != tt.available {
+				t.Errorf("DeploymentReplicaHealth = %d, %d, %d; want %d, %d, %d", desired, ready, available, tt.desired, tt.ready, tt.available)
+			}
+		})
+	}
+}
+
+func TestCheckReplicas(t *testing.T) {
+	ready := testPod("web-1", corev1.PodRunning)
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	short := testDeployment("web", 5)
+	short.Status.ReadyReplicas, short.Status.AvailableReplicas, short.Status.UnavailableReplicas = 2, 2, 3
+	cfg := answered
+	cfg.Only = []string{onlyEndpoints}
+
+	k, out := troubleshoot(t, cfg, "getNamespace", "", testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), ready, short)
+
+	c := wantCheck(t, k, checkReplicas, "web", report.StatusWarn)
+	if c.Message != "Deployment 'web' is short of replicas: desired 5, ready 2, available 2." {
+		t.Errorf("replicas check said %q", c.Message)
+	}
+	if !strings.Contains(out, "  3 replicas are unavailable.\n") {
+		t.Errorf("didn't note the unavailable replicas:\n%s", out)
+	}
+
+	k, _ = troubleshoot(t, cfg, "getNamespace", "", testNamespaceObject(), testService(), testEndpoints("10.0.0.1"), ready, testDeployment("web", 5))
+	wantCheck(t, k, checkReplicas, "web", report.StatusPass)
+}